@@ -0,0 +1,81 @@
+package urlshort
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+const (
+	minAliasLength = 3
+	maxAliasLength = 64
+)
+
+// reservedAliases are path segments used by the application itself, which
+// would make a vanity link indistinguishable from one of its routes.
+var reservedAliases = map[string]bool{
+	"api":     true,
+	"home":    true,
+	"links":   true,
+	"short":   true,
+	"shorten": true,
+	"static":  true,
+	"stats":   true,
+}
+
+var (
+	ErrInvalidAlias = errors.New("invalid alias")
+	ErrAliasTaken   = errors.New("alias is already taken")
+)
+
+// ValidateAlias checks that alias can be used as a custom shortened URL key:
+// between 3 and 64 letters, digits, '-' or '_', and not a reserved word such
+// as home, shorten or api. The returned error wraps ErrInvalidAlias.
+func ValidateAlias(alias string) error {
+	if len(alias) < minAliasLength || len(alias) > maxAliasLength {
+		return fmt.Errorf("%w: must be between %d and %d characters long", ErrInvalidAlias, minAliasLength, maxAliasLength)
+	}
+	for _, c := range alias {
+		if !isAliasChar(c) {
+			return fmt.Errorf("%w: only letters, digits, '-' and '_' are allowed", ErrInvalidAlias)
+		}
+	}
+	if reservedAliases[strings.ToLower(alias)] {
+		return fmt.Errorf("%w: %q is reserved", ErrInvalidAlias, alias)
+	}
+	return nil
+}
+
+func isAliasChar(c rune) bool {
+	return (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9') || c == '-' || c == '_'
+}
+
+// saveShortKey saves link under alias, or under a generated key when alias is empty,
+// and returns it as stored. A taken alias is reported as ErrAliasTaken rather than
+// replaced or retried. Deduplication only applies to generated keys, an alias always
+// gets its own link.
+func saveShortKey(ctx context.Context, saver UrlShortSaver, cfg *shortenerConfig, alias string, link Link) (Link, error) {
+	if alias == "" && cfg.deduplicator != nil {
+		return saveWithRetry(ctx, cfg.keyGenerator, link, func(link Link) (Link, error) {
+			return cfg.deduplicator.SaveUnique(ctx, link)
+		})
+	}
+	if alias == "" {
+		return saveWithRetry(ctx, cfg.keyGenerator, link, func(link Link) (Link, error) {
+			return link, saver.Save(ctx, link)
+		})
+	}
+	if err := ValidateAlias(alias); err != nil {
+		return Link{}, err
+	}
+	link.Key = alias
+	err := saver.Save(ctx, link)
+	if errors.Is(err, ErrKeyExists) {
+		return Link{}, ErrAliasTaken
+	}
+	if err != nil {
+		return Link{}, err
+	}
+	return link, nil
+}
@@ -0,0 +1,43 @@
+package urlshort_test
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"urlshort"
+)
+
+func TestValidateAlias(t *testing.T) {
+	tests := map[string]struct {
+		alias string
+		valid bool
+	}{
+		"valid alias":              {alias: "spring-sale", valid: true},
+		"valid with underscore":    {alias: "Spring_Sale_2024", valid: true},
+		"minimum length":           {alias: "abc", valid: true},
+		"maximum length":           {alias: strings.Repeat("a", 64), valid: true},
+		"too short":                {alias: "ab", valid: false},
+		"too long":                 {alias: strings.Repeat("a", 65), valid: false},
+		"slash not allowed":        {alias: "spring/sale", valid: false},
+		"space not allowed":        {alias: "spring sale", valid: false},
+		"non ascii not allowed":    {alias: "señal", valid: false},
+		"reserved word":            {alias: "shorten", valid: false},
+		"reserved word any case":   {alias: "Home", valid: false},
+		"reserved word api":        {alias: "api", valid: false},
+		"reserved word links":      {alias: "links", valid: false},
+		"reserved word stats":      {alias: "stats", valid: false},
+		"reserved word as a piece": {alias: "api-docs", valid: true},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			err := urlshort.ValidateAlias(tc.alias)
+			if (err == nil) != tc.valid {
+				t.Fatalf("expected valid %v, got error %v", tc.valid, err)
+			}
+			if err != nil && !errors.Is(err, urlshort.ErrInvalidAlias) {
+				t.Fatalf("expected error to wrap ErrInvalidAlias, got %v", err)
+			}
+		})
+	}
+}
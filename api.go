@@ -0,0 +1,220 @@
+package urlshort
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// maxRequestBodySize bounds the JSON bodies accepted by the API handlers.
+const maxRequestBodySize = 1 << 20
+
+// LinkResponse is the JSON representation of a shortened URL returned by the API handlers.
+type LinkResponse struct {
+	Key       string     `json:"key"`
+	ShortURL  string     `json:"short_url"`
+	URL       string     `json:"url"`
+	ExpiresAt *time.Time `json:"expires_at"`
+	// Status is the status of redirects to the link, omitted when it uses the default one.
+	Status int `json:"status,omitempty"`
+	// Query is the QueryPolicy of the link, omitted when it uses the default one.
+	Query QueryPolicy `json:"query,omitempty"`
+	// Preview is set for links that always show their preview page.
+	Preview bool `json:"preview,omitempty"`
+	// CreatedAt is omitted for links saved before creation times were recorded.
+	CreatedAt *time.Time `json:"created_at,omitempty"`
+	// CreatedBy is the ID of the APIKey the link was created with, omitted when there was none.
+	CreatedBy string `json:"created_by,omitempty"`
+}
+
+type apiError struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// writeJSONError writes an error body of the form {"error": {"code": ..., "message": ...}}.
+func writeJSONError(w http.ResponseWriter, status int, code string, message string) {
+	writeJSON(w, status, struct {
+		Error apiError `json:"error"`
+	}{
+		Error: apiError{Code: code, Message: message},
+	})
+}
+
+// writeInternalError logs err, which happened while doing what action
+// describes, and answers 500 Internal Server Error without its details, which
+// belong to the storage and are of no use to clients.
+func writeInternalError(w http.ResponseWriter, action string, err error) {
+	log.Printf("urlshort: %s: %v", action, err)
+	writeJSONError(w, http.StatusInternalServerError, "internal_error", "internal error")
+}
+
+// internalError is writeInternalError for the pages, answering in plain text.
+func internalError(w http.ResponseWriter, action string, err error) {
+	log.Printf("urlshort: %s: %v", action, err)
+	http.Error(w, "internal error", http.StatusInternalServerError)
+}
+
+// CreateLinkHandler will return an http.HandlerFunc that accepts POST
+// requests with a JSON body such as {"url": "https://www.some-url.com"}.
+// It generates a shortened key for the url, or uses the optional "alias"
+// field instead, saves it using the provided saver and answers 201 with
+// a JSON LinkResponse. The optional "expires_in", in seconds, and "expires_at",
+// in RFC 3339 format, fields choose when the link expires, see WithMaxExpiration,
+// the optional "status" field the status of its redirects, see ValidateRedirectStatus,
+// the optional "query" field what happens to the query of requests, see QueryPolicy,
+// and an optional true "preview" field makes the link always show its preview
+// page, see WithPreview.
+//
+// Errors are answered with a JSON body of the form:
+//
+//	{"error": {"code": "invalid_url", "message": "url is not valid"}}
+func CreateLinkHandler(saver UrlShortSaver, host string, opts ...ShortenerOption) http.HandlerFunc {
+	cfg := newShortenerConfig(saver, opts)
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !allowMethods(w, r, jsonMethodNotAllowed, http.MethodPost) {
+			return
+		}
+
+		var body struct {
+			URL       string      `json:"url"`
+			Alias     string      `json:"alias"`
+			ExpiresIn *int64      `json:"expires_in"`
+			ExpiresAt *time.Time  `json:"expires_at"`
+			Status    int         `json:"status"`
+			Query     QueryPolicy `json:"query"`
+			Preview   bool        `json:"preview"`
+		}
+		decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxRequestBodySize))
+		decoder.DisallowUnknownFields()
+		if err := decoder.Decode(&body); err != nil {
+			writeJSONError(w, http.StatusBadRequest, "invalid_body", fmt.Sprintf("invalid JSON body: %s", err.Error()))
+			return
+		}
+		if body.URL == "" {
+			writeJSONError(w, http.StatusBadRequest, "missing_url", "url is missing")
+			return
+		}
+		if _, err := url.ParseRequestURI(body.URL); err != nil {
+			writeJSONError(w, http.StatusBadRequest, "invalid_url", "url is not valid")
+			return
+		}
+
+		if err := ValidateRedirectStatus(body.Status); err != nil {
+			writeJSONError(w, http.StatusBadRequest, "invalid_status", err.Error())
+			return
+		}
+		if err := ValidateQueryPolicy(body.Query); err != nil {
+			writeJSONError(w, http.StatusBadRequest, "invalid_query_policy", err.Error())
+			return
+		}
+
+		var expiresIn time.Duration
+		if body.ExpiresIn != nil {
+			if *body.ExpiresIn <= 0 || *body.ExpiresIn > math.MaxInt64/int64(time.Second) {
+				writeJSONError(w, http.StatusBadRequest, "invalid_expiration", "expires_in must be a positive number of seconds")
+				return
+			}
+			expiresIn = time.Duration(*body.ExpiresIn) * time.Second
+		}
+		var expiresAt time.Time
+		if body.ExpiresAt != nil {
+			expiresAt = *body.ExpiresAt
+		}
+		now := time.Now()
+		expiresAt, err := cfg.expiration(now, expiresIn, expiresAt)
+		if err != nil {
+			writeJSONError(w, http.StatusBadRequest, "invalid_expiration", err.Error())
+			return
+		}
+
+		link, err := saveShortKey(r.Context(), saver, cfg, body.Alias, Link{
+			URL:       body.URL,
+			ExpiresAt: expiresAt,
+			Status:    body.Status,
+			Query:     body.Query,
+			Preview:   body.Preview,
+			CreatedAt: now,
+			CreatedBy: createdBy(r.Context()),
+		})
+		if errors.Is(err, ErrInvalidAlias) {
+			writeJSONError(w, http.StatusBadRequest, "invalid_alias", err.Error())
+			return
+		}
+		if errors.Is(err, ErrAliasTaken) {
+			writeJSONError(w, http.StatusConflict, "alias_taken", err.Error())
+			return
+		}
+		if errors.Is(err, ErrKeyExists) {
+			writeJSONError(w, http.StatusInternalServerError, "key_generation_failed", "could not generate a unique short key")
+			return
+		}
+		if err != nil {
+			writeInternalError(w, "saving short url", err)
+			return
+		}
+
+		response := newLinkResponse(host, link)
+		w.Header().Set("Location", response.ShortURL)
+		writeJSON(w, http.StatusCreated, response)
+	}
+}
+
+// GetLinkHandler will return an http.HandlerFunc that answers GET and HEAD requests
+// with a JSON LinkResponse describing the key at the end of the request path,
+// without redirecting to it. Expired keys are answered with 410 Gone.
+// Handler must be attached to a route ending in /{key} or it won't work properly
+func GetLinkHandler(getter UrlShortGetter, host string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !allowMethods(w, r, jsonMethodNotAllowed, http.MethodGet, http.MethodHead) {
+			return
+		}
+		key := keyFromPath(r.URL.Path)
+		if key == "" {
+			writeJSONError(w, http.StatusBadRequest, "missing_key", "key is missing")
+			return
+		}
+
+		link, err := getter.Get(r.Context(), key)
+		if errors.Is(err, ErrMissingKey) {
+			writeJSONError(w, http.StatusNotFound, "not_found", err.Error())
+			return
+		}
+		if errors.Is(err, ErrExpiredKey) {
+			writeJSONError(w, http.StatusGone, "expired", err.Error())
+			return
+		}
+		if err != nil {
+			writeInternalError(w, "getting "+key, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, newLinkResponse(host, link))
+	}
+}
+
+// newLinkResponse describes link as served from host.
+func newLinkResponse(host string, link Link) LinkResponse {
+	response := LinkResponse{
+		Key:       link.Key,
+		ShortURL:  fmt.Sprintf("%s/short/%s", host, link.Key),
+		URL:       link.URL,
+		Status:    link.Status,
+		Query:     link.Query,
+		Preview:   link.Preview,
+		CreatedBy: link.CreatedBy,
+	}
+	if !link.ExpiresAt.IsZero() {
+		expiresAt := link.ExpiresAt.UTC()
+		response.ExpiresAt = &expiresAt
+	}
+	if !link.CreatedAt.IsZero() {
+		createdAt := link.CreatedAt.UTC()
+		response.CreatedAt = &createdAt
+	}
+	return response
+}
@@ -0,0 +1,380 @@
+package urlshort_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+	"urlshort"
+)
+
+type mockExpiringGetter struct {
+	expiresAt time.Time
+}
+
+func (m *mockExpiringGetter) Get(ctx context.Context, key string) (urlshort.Link, error) {
+	return urlshort.Link{Key: key, URL: "http://www.google.com", ExpiresAt: m.expiresAt}, nil
+}
+
+type apiErrorBody struct {
+	Error struct {
+		Code    string `json:"code"`
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+func TestCreateLinkHandler(t *testing.T) {
+	tests := map[string]struct {
+		method     string
+		body       string
+		saver      urlshort.UrlShortSaver
+		statusCode int
+		errCode    string
+	}{
+		"valid URL": {
+			method:     "POST",
+			body:       `{"url": "http://www.google.com"}`,
+			saver:      &mockSaver{},
+			statusCode: http.StatusCreated,
+		},
+		"invalid URL": {
+			method:     "POST",
+			body:       `{"url": "google.com"}`,
+			saver:      &mockSaver{},
+			statusCode: http.StatusBadRequest,
+			errCode:    "invalid_url",
+		},
+		"missing URL": {
+			method:     "POST",
+			body:       `{}`,
+			saver:      &mockSaver{},
+			statusCode: http.StatusBadRequest,
+			errCode:    "missing_url",
+		},
+		"malformed body": {
+			method:     "POST",
+			body:       `{"url":`,
+			saver:      &mockSaver{},
+			statusCode: http.StatusBadRequest,
+			errCode:    "invalid_body",
+		},
+		"unknown field": {
+			method:     "POST",
+			body:       `{"link": "http://www.google.com"}`,
+			saver:      &mockSaver{},
+			statusCode: http.StatusBadRequest,
+			errCode:    "invalid_body",
+		},
+		"valid alias": {
+			method:     "POST",
+			body:       `{"url": "http://www.google.com", "alias": "spring-sale"}`,
+			saver:      &mockSaver{},
+			statusCode: http.StatusCreated,
+		},
+		"invalid alias": {
+			method:     "POST",
+			body:       `{"url": "http://www.google.com", "alias": "api"}`,
+			saver:      &mockSaver{},
+			statusCode: http.StatusBadRequest,
+			errCode:    "invalid_alias",
+		},
+		"alias taken": {
+			method:     "POST",
+			body:       `{"url": "http://www.google.com", "alias": "spring-sale"}`,
+			saver:      &mockSaverCollision{collisions: 1},
+			statusCode: http.StatusConflict,
+			errCode:    "alias_taken",
+		},
+		"invalid method": {
+			method:     "GET",
+			body:       `{"url": "http://www.google.com"}`,
+			saver:      &mockSaver{},
+			statusCode: http.StatusMethodNotAllowed,
+			errCode:    "method_not_allowed",
+		},
+		"error saving": {
+			method:     "POST",
+			body:       `{"url": "http://www.google.com"}`,
+			saver:      &mockSaverError{},
+			statusCode: http.StatusInternalServerError,
+			errCode:    "internal_error",
+		},
+		"key collisions exhausted": {
+			method:     "POST",
+			body:       `{"url": "http://www.google.com"}`,
+			saver:      &mockSaverCollision{collisions: 100},
+			statusCode: http.StatusInternalServerError,
+			errCode:    "key_generation_failed",
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			handler := urlshort.CreateLinkHandler(tc.saver, "http://localhost:8080")
+			req, err := http.NewRequest(tc.method, "/api/v1/links", strings.NewReader(tc.body))
+			if err != nil {
+				t.Fatal(err)
+			}
+			rr := httptest.NewRecorder()
+			handler(rr, req)
+			if status := rr.Code; status != tc.statusCode {
+				t.Fatalf("handler returned wrong status code: got %v want %v", status, tc.statusCode)
+			}
+			if ct := rr.Header().Get("Content-Type"); ct != "application/json" {
+				t.Errorf("handler returned wrong content type: got %v", ct)
+			}
+
+			if tc.errCode != "" {
+				var body apiErrorBody
+				if err = json.Unmarshal(rr.Body.Bytes(), &body); err != nil {
+					t.Fatal(err)
+				}
+				if body.Error.Code != tc.errCode {
+					t.Errorf("handler returned wrong error code: got %v want %v", body.Error.Code, tc.errCode)
+				}
+				return
+			}
+
+			var link urlshort.LinkResponse
+			if err = json.Unmarshal(rr.Body.Bytes(), &link); err != nil {
+				t.Fatal(err)
+			}
+			if link.URL != "http://www.google.com" || link.Key == "" || link.ShortURL != "http://localhost:8080/short/"+link.Key {
+				t.Errorf("handler returned unexpected link: %+v", link)
+			}
+			if link.ExpiresAt != nil {
+				t.Errorf("expected no expiration, got %v", link.ExpiresAt)
+			}
+			if rr.Header().Get("Location") != link.ShortURL {
+				t.Errorf("handler returned wrong location: got %v want %v", rr.Header().Get("Location"), link.ShortURL)
+			}
+		})
+	}
+
+	t.Run("expiration included", func(t *testing.T) {
+		expiresAt := time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC)
+		saver := &mockSaverCollision{}
+		handler := urlshort.CreateLinkHandler(saver, "http://localhost:8080")
+		req, err := http.NewRequest("POST", "/api/v1/links", strings.NewReader(`{"url": "http://www.google.com", "expires_at": "2030-01-01T00:00:00Z"}`))
+		if err != nil {
+			t.Fatal(err)
+		}
+		rr := httptest.NewRecorder()
+		handler(rr, req)
+		var link urlshort.LinkResponse
+		if err = json.Unmarshal(rr.Body.Bytes(), &link); err != nil {
+			t.Fatal(err)
+		}
+		if link.ExpiresAt == nil || !link.ExpiresAt.Equal(expiresAt) {
+			t.Errorf("handler returned wrong expiration: got %v want %v", link.ExpiresAt, expiresAt)
+		}
+		if !saver.link.ExpiresAt.Equal(expiresAt) {
+			t.Errorf("saver got wrong expiration: got %v want %v", saver.link.ExpiresAt, expiresAt)
+		}
+	})
+}
+
+func TestCreateLinkHandlerExpiration(t *testing.T) {
+	tests := map[string]struct {
+		body       string
+		opts       []urlshort.ShortenerOption
+		statusCode int
+		expiresIn  time.Duration
+	}{
+		"no expiration": {
+			body:       `{"url": "http://www.google.com"}`,
+			statusCode: http.StatusCreated,
+		},
+		"expires in": {
+			body:       `{"url": "http://www.google.com", "expires_in": 3600}`,
+			statusCode: http.StatusCreated,
+			expiresIn:  time.Hour,
+		},
+		"default expiration": {
+			body:       `{"url": "http://www.google.com"}`,
+			opts:       []urlshort.ShortenerOption{urlshort.WithDefaultExpiration(time.Hour)},
+			statusCode: http.StatusCreated,
+			expiresIn:  time.Hour,
+		},
+		"max expiration used as default": {
+			body:       `{"url": "http://www.google.com"}`,
+			opts:       []urlshort.ShortenerOption{urlshort.WithMaxExpiration(2 * time.Hour)},
+			statusCode: http.StatusCreated,
+			expiresIn:  2 * time.Hour,
+		},
+		"within max expiration": {
+			body:       `{"url": "http://www.google.com", "expires_in": 60}`,
+			opts:       []urlshort.ShortenerOption{urlshort.WithMaxExpiration(time.Hour)},
+			statusCode: http.StatusCreated,
+			expiresIn:  time.Minute,
+		},
+		"beyond max expiration": {
+			body:       `{"url": "http://www.google.com", "expires_in": 7200}`,
+			opts:       []urlshort.ShortenerOption{urlshort.WithMaxExpiration(time.Hour)},
+			statusCode: http.StatusBadRequest,
+		},
+		"expires at beyond max expiration": {
+			body:       `{"url": "http://www.google.com", "expires_at": "2999-01-01T00:00:00Z"}`,
+			opts:       []urlshort.ShortenerOption{urlshort.WithMaxExpiration(time.Hour)},
+			statusCode: http.StatusBadRequest,
+		},
+		"zero expires in": {
+			body:       `{"url": "http://www.google.com", "expires_in": 0}`,
+			statusCode: http.StatusBadRequest,
+		},
+		"negative expires in": {
+			body:       `{"url": "http://www.google.com", "expires_in": -10}`,
+			statusCode: http.StatusBadRequest,
+		},
+		"expires at in the past": {
+			body:       `{"url": "http://www.google.com", "expires_at": "2000-01-01T00:00:00Z"}`,
+			statusCode: http.StatusBadRequest,
+		},
+		"both expires in and at": {
+			body:       `{"url": "http://www.google.com", "expires_in": 60, "expires_at": "2030-01-01T00:00:00Z"}`,
+			statusCode: http.StatusBadRequest,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			saver := &mockSaverCollision{}
+			handler := urlshort.CreateLinkHandler(saver, "http://localhost:8080", tc.opts...)
+			req, err := http.NewRequest("POST", "/api/v1/links", strings.NewReader(tc.body))
+			if err != nil {
+				t.Fatal(err)
+			}
+			before := time.Now()
+			rr := httptest.NewRecorder()
+			handler(rr, req)
+			if status := rr.Code; status != tc.statusCode {
+				t.Fatalf("handler returned wrong status code: got %v want %v", status, tc.statusCode)
+			}
+			if tc.statusCode != http.StatusCreated {
+				var body apiErrorBody
+				if err = json.Unmarshal(rr.Body.Bytes(), &body); err != nil {
+					t.Fatal(err)
+				}
+				if body.Error.Code != "invalid_expiration" {
+					t.Errorf("handler returned wrong error code: got %v want %v", body.Error.Code, "invalid_expiration")
+				}
+				if len(saver.keys) != 0 {
+					t.Errorf("expected nothing to be saved, got %v", saver.keys)
+				}
+				return
+			}
+
+			expiresAt := saver.link.ExpiresAt
+			if tc.expiresIn == 0 {
+				if !expiresAt.IsZero() {
+					t.Errorf("expected no expiration, got %v", expiresAt)
+				}
+				return
+			}
+			if expiresAt.Before(before.Add(tc.expiresIn)) || expiresAt.After(time.Now().Add(tc.expiresIn)) {
+				t.Errorf("expected expiration in %v, got %v", tc.expiresIn, expiresAt)
+			}
+		})
+	}
+}
+
+func TestGetLinkHandler(t *testing.T) {
+	tests := map[string]struct {
+		method     string
+		path       string
+		getter     urlshort.UrlShortGetter
+		statusCode int
+		errCode    string
+	}{
+		"correct get": {
+			method:     "GET",
+			path:       "/api/v1/links/CSl5Ow",
+			getter:     &mockGetter{},
+			statusCode: http.StatusOK,
+		},
+		"missing key": {
+			method:     "GET",
+			path:       "/api/v1/links/CSl5Ow",
+			getter:     &mockGetterMissingKey{},
+			statusCode: http.StatusNotFound,
+			errCode:    "not_found",
+		},
+		"expired key": {
+			method:     "GET",
+			path:       "/api/v1/links/CSl5Ow",
+			getter:     &mockGetterExpiredKey{},
+			statusCode: http.StatusGone,
+			errCode:    "expired",
+		},
+		"error getting key": {
+			method:     "GET",
+			path:       "/api/v1/links/CSl5Ow",
+			getter:     &mockGetterError{},
+			statusCode: http.StatusInternalServerError,
+			errCode:    "internal_error",
+		},
+		"invalid method": {
+			method:     "POST",
+			path:       "/api/v1/links/CSl5Ow",
+			getter:     &mockGetter{},
+			statusCode: http.StatusMethodNotAllowed,
+			errCode:    "method_not_allowed",
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			handler := urlshort.GetLinkHandler(tc.getter, "http://localhost:8080")
+			req, err := http.NewRequest(tc.method, tc.path, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			rr := httptest.NewRecorder()
+			handler(rr, req)
+			if status := rr.Code; status != tc.statusCode {
+				t.Fatalf("handler returned wrong status code: got %v want %v", status, tc.statusCode)
+			}
+
+			if tc.errCode != "" {
+				var body apiErrorBody
+				if err = json.Unmarshal(rr.Body.Bytes(), &body); err != nil {
+					t.Fatal(err)
+				}
+				if body.Error.Code != tc.errCode {
+					t.Errorf("handler returned wrong error code: got %v want %v", body.Error.Code, tc.errCode)
+				}
+				return
+			}
+
+			var link urlshort.LinkResponse
+			if err = json.Unmarshal(rr.Body.Bytes(), &link); err != nil {
+				t.Fatal(err)
+			}
+			want := urlshort.LinkResponse{Key: "CSl5Ow", ShortURL: "http://localhost:8080/short/CSl5Ow", URL: "http://www.google.com"}
+			if link != want {
+				t.Errorf("handler returned unexpected link: got %+v want %+v", link, want)
+			}
+		})
+	}
+}
+
+func TestGetLinkHandlerExpiration(t *testing.T) {
+	expiresAt := time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC)
+	handler := urlshort.GetLinkHandler(&mockExpiringGetter{expiresAt: expiresAt}, "http://localhost:8080")
+	req, err := http.NewRequest("GET", "/api/v1/links/CSl5Ow", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rr := httptest.NewRecorder()
+	handler(rr, req)
+	var link urlshort.LinkResponse
+	if err = json.Unmarshal(rr.Body.Bytes(), &link); err != nil {
+		t.Fatal(err)
+	}
+	if link.ExpiresAt == nil || !link.ExpiresAt.Equal(expiresAt) {
+		t.Errorf("handler returned wrong expiration: got %v want %v", link.ExpiresAt, expiresAt)
+	}
+}
@@ -0,0 +1,160 @@
+package urlshort
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	// apiKeyIDLength and apiKeySecretLength are the lengths of the base62 id and
+	// secret making up the token of an APIKey, separated by a dot.
+	apiKeyIDLength     = 8
+	apiKeySecretLength = 32
+)
+
+// ErrMissingAPIKey is returned by an APIKeyGetter for ids never stored.
+var ErrMissingAPIKey = errors.New("api key not found")
+
+// APIKey is a credential allowed through RequireAPIKey. Its token is handed out
+// once by GenerateAPIKey, only its hash is stored.
+type APIKey struct {
+	ID   string
+	Name string
+	// Hash is the hex encoded SHA-256 of the token.
+	Hash      string
+	CreatedAt time.Time
+	// RevokedAt is the moment the key was revoked, the zero time while it is valid.
+	RevokedAt time.Time
+}
+
+// Revoked reports whether the key was revoked.
+func (k APIKey) Revoked() bool {
+	return !k.RevokedAt.IsZero()
+}
+
+// APIKeyGetter defines a contract for types that know how to retrieve API keys by id.
+type APIKeyGetter interface {
+	// GetAPIKey returns the key stored under id, revoked or not, or ErrMissingAPIKey.
+	GetAPIKey(ctx context.Context, id string) (APIKey, error)
+}
+
+// APIKeyStore defines a contract for types that know how to store API keys.
+type APIKeyStore interface {
+	APIKeyGetter
+	// SaveAPIKey stores key, replacing the key stored under the same id if any.
+	SaveAPIKey(ctx context.Context, key APIKey) error
+	// ListAPIKeys returns every stored key, revoked ones included, in any order.
+	ListAPIKeys(ctx context.Context) ([]APIKey, error)
+}
+
+// GenerateAPIKey returns a new APIKey named name along with its token, which is
+// not kept anywhere else and must be handed to its owner. The key is not saved.
+func GenerateAPIKey(ctx context.Context, name string) (APIKey, string, error) {
+	id, err := NewRandomKeyGenerator(apiKeyIDLength).GenerateKey(ctx)
+	if err != nil {
+		return APIKey{}, "", fmt.Errorf("generating api key id: %w", err)
+	}
+	secret, err := NewRandomKeyGenerator(apiKeySecretLength).GenerateKey(ctx)
+	if err != nil {
+		return APIKey{}, "", fmt.Errorf("generating api key secret: %w", err)
+	}
+	token := id + "." + secret
+	return APIKey{ID: id, Name: name, Hash: hashAPIKeyToken(token), CreatedAt: time.Now()}, token, nil
+}
+
+// RevokeAPIKey revokes the key stored under id so RequireAPIKey rejects it from
+// now on. Revoking a revoked key does nothing.
+func RevokeAPIKey(ctx context.Context, store APIKeyStore, id string) error {
+	key, err := store.GetAPIKey(ctx, id)
+	if err != nil {
+		return err
+	}
+	if key.Revoked() {
+		return nil
+	}
+	key.RevokedAt = time.Now()
+	return store.SaveAPIKey(ctx, key)
+}
+
+// hashAPIKeyToken returns the hex encoded SHA-256 of token. Tokens are long and
+// random, so a slow password hash would add nothing.
+func hashAPIKeyToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// apiKeyToken returns the token r is authenticated with: the bearer token of its
+// Authorization header, its X-API-Key header or, for forms, its api_key field.
+func apiKeyToken(r *http.Request) string {
+	if token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok {
+		return strings.TrimSpace(token)
+	}
+	if token := r.Header.Get("X-API-Key"); token != "" {
+		return token
+	}
+	return r.PostFormValue("api_key")
+}
+
+type apiKeyContextKey struct{}
+
+// APIKeyFromContext returns the APIKey RequireAPIKey authenticated the request of ctx with.
+func APIKeyFromContext(ctx context.Context) (APIKey, bool) {
+	key, ok := ctx.Value(apiKeyContextKey{}).(APIKey)
+	return key, ok
+}
+
+// createdBy returns the id of the APIKey of ctx, empty when there is none.
+func createdBy(ctx context.Context) string {
+	key, _ := APIKeyFromContext(ctx)
+	return key.ID
+}
+
+// RequireAPIKey will return an http.HandlerFunc that calls next only for requests
+// carrying the token of an APIKey found by getter and not revoked, in an
+// "Authorization: Bearer <token>" or "X-API-Key: <token>" header or, for HTML
+// forms, an api_key field. The key is available to next through
+// APIKeyFromContext, and Shortener and CreateLinkHandler record it as the
+// creator of their links, see Link. Other requests are answered with 401
+// Unauthorized in the JSON error format of the API, except OPTIONS requests,
+// which are passed on so preflight requests keep working.
+func RequireAPIKey(getter APIKeyGetter, next http.Handler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodOptions {
+			next.ServeHTTP(w, r)
+			return
+		}
+		token := apiKeyToken(r)
+		id, _, ok := strings.Cut(token, ".")
+		if !ok {
+			unauthorized(w)
+			return
+		}
+		key, err := getter.GetAPIKey(r.Context(), id)
+		if errors.Is(err, ErrMissingAPIKey) {
+			unauthorized(w)
+			return
+		}
+		if err != nil {
+			writeInternalError(w, "getting api key "+id, err)
+			return
+		}
+		if key.Revoked() || subtle.ConstantTimeCompare([]byte(hashAPIKeyToken(token)), []byte(key.Hash)) != 1 {
+			unauthorized(w)
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), apiKeyContextKey{}, key)))
+	}
+}
+
+// unauthorized answers a request without a valid API key.
+func unauthorized(w http.ResponseWriter) {
+	w.Header().Set("WWW-Authenticate", "Bearer")
+	writeJSONError(w, http.StatusUnauthorized, "unauthorized", "a valid API key is required")
+}
@@ -0,0 +1,190 @@
+package urlshort_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+	"urlshort"
+)
+
+type mockAPIKeyGetter struct {
+	keys map[string]urlshort.APIKey
+	err  error
+}
+
+func (m *mockAPIKeyGetter) GetAPIKey(ctx context.Context, id string) (urlshort.APIKey, error) {
+	if m.err != nil {
+		return urlshort.APIKey{}, m.err
+	}
+	key, ok := m.keys[id]
+	if !ok {
+		return urlshort.APIKey{}, urlshort.ErrMissingAPIKey
+	}
+	return key, nil
+}
+
+// newMockAPIKeyGetter stores a valid key and a revoked one, returning their tokens.
+func newMockAPIKeyGetter(t *testing.T) (*mockAPIKeyGetter, string, string) {
+	t.Helper()
+	key, token, err := urlshort.GenerateAPIKey(context.Background(), "posters")
+	if err != nil {
+		t.Fatalf("error was not expected but got: %s", err.Error())
+	}
+	revoked, revokedToken, err := urlshort.GenerateAPIKey(context.Background(), "spammer")
+	if err != nil {
+		t.Fatalf("error was not expected but got: %s", err.Error())
+	}
+	revoked.RevokedAt = time.Now()
+	return &mockAPIKeyGetter{keys: map[string]urlshort.APIKey{key.ID: key, revoked.ID: revoked}}, token, revokedToken
+}
+
+func TestRequireAPIKey(t *testing.T) {
+	getter, token, revokedToken := newMockAPIKeyGetter(t)
+	id, _, _ := strings.Cut(token, ".")
+
+	tests := map[string]struct {
+		getter     urlshort.APIKeyGetter
+		method     string
+		header     http.Header
+		form       url.Values
+		statusCode int
+	}{
+		"bearer token": {
+			method:     "GET",
+			header:     http.Header{"Authorization": {"Bearer " + token}},
+			statusCode: http.StatusOK,
+		},
+		"api key header": {
+			method:     "GET",
+			header:     http.Header{"X-Api-Key": {token}},
+			statusCode: http.StatusOK,
+		},
+		"form field": {
+			method:     "POST",
+			header:     http.Header{"Content-Type": {"application/x-www-form-urlencoded"}},
+			form:       url.Values{"url": {"http://www.google.com"}, "api_key": {token}},
+			statusCode: http.StatusOK,
+		},
+		"no token": {
+			method:     "GET",
+			statusCode: http.StatusUnauthorized,
+		},
+		"wrong secret": {
+			method:     "GET",
+			header:     http.Header{"Authorization": {"Bearer " + id + ".wrong"}},
+			statusCode: http.StatusUnauthorized,
+		},
+		"unknown key": {
+			method:     "GET",
+			header:     http.Header{"Authorization": {"Bearer unknown.secret"}},
+			statusCode: http.StatusUnauthorized,
+		},
+		"revoked key": {
+			method:     "GET",
+			header:     http.Header{"Authorization": {"Bearer " + revokedToken}},
+			statusCode: http.StatusUnauthorized,
+		},
+		"getter failing": {
+			getter:     &mockAPIKeyGetter{err: errors.New("unavailable")},
+			method:     "GET",
+			header:     http.Header{"Authorization": {"Bearer " + token}},
+			statusCode: http.StatusInternalServerError,
+		},
+		"options": {
+			method:     "OPTIONS",
+			statusCode: http.StatusOK,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			var authenticated urlshort.APIKey
+			next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				authenticated, _ = urlshort.APIKeyFromContext(r.Context())
+			})
+			if tc.getter == nil {
+				tc.getter = getter
+			}
+			handler := urlshort.RequireAPIKey(tc.getter, next)
+			req := httptest.NewRequest(tc.method, "/api/v1/links", strings.NewReader(tc.form.Encode()))
+			for name, values := range tc.header {
+				req.Header[name] = values
+			}
+			rr := httptest.NewRecorder()
+			handler(rr, req)
+			if status := rr.Code; status != tc.statusCode {
+				t.Fatalf("handler returned wrong status code: got %v want %v", status, tc.statusCode)
+			}
+			if tc.statusCode == http.StatusUnauthorized {
+				if rr.Header().Get("WWW-Authenticate") != "Bearer" {
+					t.Errorf("expected a WWW-Authenticate header, got %q", rr.Header().Get("WWW-Authenticate"))
+				}
+				var body apiErrorBody
+				if err := json.Unmarshal(rr.Body.Bytes(), &body); err != nil {
+					t.Fatal(err)
+				}
+				if body.Error.Code != "unauthorized" {
+					t.Errorf("handler returned wrong error code: got %v want %v", body.Error.Code, "unauthorized")
+				}
+			}
+			if tc.statusCode == http.StatusOK && tc.method != "OPTIONS" && authenticated.ID != id {
+				t.Errorf("expected next to be called with key %s, got %q", id, authenticated.ID)
+			}
+		})
+	}
+}
+
+func TestRequireAPIKeyRecordsCreator(t *testing.T) {
+	getter, token, _ := newMockAPIKeyGetter(t)
+	id, _, _ := strings.Cut(token, ".")
+
+	saver := &mockSaverCollision{}
+	handler := urlshort.RequireAPIKey(getter, urlshort.CreateLinkHandler(saver, "http://localhost:8080"))
+	req := httptest.NewRequest("POST", "/api/v1/links", strings.NewReader(`{"url": "http://www.google.com"}`))
+	req.Header.Set("Authorization", "Bearer "+token)
+	rr := httptest.NewRecorder()
+	handler(rr, req)
+	if status := rr.Code; status != http.StatusCreated {
+		t.Fatalf("handler returned wrong status code: got %v want %v", status, http.StatusCreated)
+	}
+	var link urlshort.LinkResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &link); err != nil {
+		t.Fatal(err)
+	}
+	if link.CreatedBy != id || saver.link.CreatedBy != id {
+		t.Errorf("expected the link to be created by %s, got %q and %q saved", id, link.CreatedBy, saver.link.CreatedBy)
+	}
+
+	saver = &mockSaverCollision{}
+	handler = urlshort.RequireAPIKey(getter, urlshort.Shortener(saver, "http://localhost:8080", http.HandlerFunc(statusBadRequestHandlerMock)))
+	req = httptest.NewRequest("POST", "/shorten", strings.NewReader(url.Values{"url": {"http://www.google.com"}, "api_key": {token}}.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	rr = httptest.NewRecorder()
+	handler(rr, req)
+	if status := rr.Code; status != http.StatusOK {
+		t.Fatalf("handler returned wrong status code: got %v want %v", status, http.StatusOK)
+	}
+	if saver.link.CreatedBy != id {
+		t.Errorf("expected the link to be created by %s, got %q", id, saver.link.CreatedBy)
+	}
+}
+
+func TestGenerateAPIKey(t *testing.T) {
+	key, token, err := urlshort.GenerateAPIKey(context.Background(), "posters")
+	if err != nil {
+		t.Fatalf("error was not expected but got: %s", err.Error())
+	}
+	id, secret, ok := strings.Cut(token, ".")
+	if !ok || id != key.ID || len(secret) != 32 {
+		t.Errorf("expected a token made of the id %s and a 32 character secret, got %q", key.ID, token)
+	}
+	if key.Name != "posters" || key.Hash == "" || strings.Contains(key.Hash, secret) || key.CreatedAt.IsZero() || key.Revoked() {
+		t.Errorf("unexpected key %v", key)
+	}
+}
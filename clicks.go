@@ -0,0 +1,96 @@
+package urlshort
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Click describes a single redirect of a shortened URL key.
+type Click struct {
+	Key       string
+	Time      time.Time
+	Referrer  string
+	UserAgent string
+	// IPHash is the hex encoded HMAC-SHA256 of the client IP keyed with the secret
+	// given to WithClickIPHash, so visitors can be told apart without their address
+	// being recoverable by whoever reads clicks. It is empty without a secret.
+	IPHash string
+}
+
+// ClickRecorder defines a contract for types that know how to record the redirects of shortened URL keys.
+type ClickRecorder interface {
+	// RecordClick records click, aggregating it into the stats of its key.
+	RecordClick(ctx context.Context, click Click) error
+}
+
+// ClickStats are the aggregated clicks of a shortened URL key.
+type ClickStats struct {
+	Key   string `json:"key"`
+	Total int64  `json:"total"`
+	// Daily holds the clicks of every UTC day with at least one, oldest first.
+	Daily []DailyClicks `json:"daily"`
+}
+
+// DailyClicks is the number of clicks of a shortened URL key during a UTC day.
+type DailyClicks struct {
+	// Date is formatted with ClickDateFormat.
+	Date   string `json:"date"`
+	Clicks int64  `json:"clicks"`
+}
+
+// ClickDateFormat is the layout of the dates clicks are bucketed by.
+const ClickDateFormat = "2006-01-02"
+
+// ClickStatsGetter defines a contract for types that know the aggregated clicks of shortened URL keys.
+type ClickStatsGetter interface {
+	// ClickStats returns the clicks recorded for key, all zero if it was never clicked.
+	// Daily buckets may be returned in any order.
+	ClickStats(ctx context.Context, key string) (ClickStats, error)
+}
+
+// newClick describes the redirect of key answering r.
+func newClick(r *http.Request, key string, now time.Time, cfg *retrieveConfig) Click {
+	click := Click{Key: key, Time: now, Referrer: r.Referer(), UserAgent: r.UserAgent()}
+	if cfg.ipSecret != nil {
+		mac := hmac.New(sha256.New, cfg.ipSecret)
+		mac.Write([]byte(requestIP(r, cfg.ipHeader)))
+		click.IPHash = hex.EncodeToString(mac.Sum(nil))
+	}
+	return click
+}
+
+// ClickStatsHandler will return an http.HandlerFunc that answers GET and HEAD requests
+// with the JSON ClickStats of the key preceding /stats at the end of the request path.
+// Handler must be attached to a route ending in /{key}/stats or it won't work properly
+func ClickStatsHandler(getter ClickStatsGetter) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !allowMethods(w, r, jsonMethodNotAllowed, http.MethodGet, http.MethodHead) {
+			return
+		}
+		key := keyFromPath(strings.TrimSuffix(strings.TrimRight(r.URL.Path, "/ "), "/stats"))
+		if key == "" {
+			writeJSONError(w, http.StatusBadRequest, "missing_key", "key is missing")
+			return
+		}
+
+		stats, err := getter.ClickStats(r.Context(), key)
+		if err != nil {
+			writeInternalError(w, "reading clicks of "+key, err)
+			return
+		}
+		stats.Key = key
+		if stats.Daily == nil {
+			stats.Daily = []DailyClicks{}
+		}
+		sort.Slice(stats.Daily, func(i, j int) bool {
+			return stats.Daily[i].Date < stats.Daily[j].Date
+		})
+		writeJSON(w, http.StatusOK, stats)
+	}
+}
@@ -0,0 +1,211 @@
+package urlshort_test
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"urlshort"
+)
+
+type mockClickRecorder struct {
+	clicks []urlshort.Click
+	err    error
+}
+
+func (m *mockClickRecorder) RecordClick(ctx context.Context, click urlshort.Click) error {
+	m.clicks = append(m.clicks, click)
+	return m.err
+}
+
+type mockClickStatsGetter struct {
+	err error
+}
+
+func (m *mockClickStatsGetter) ClickStats(ctx context.Context, key string) (urlshort.ClickStats, error) {
+	if m.err != nil {
+		return urlshort.ClickStats{}, m.err
+	}
+	if key != "CSl5Ow" {
+		return urlshort.ClickStats{}, nil
+	}
+	return urlshort.ClickStats{Total: 3, Daily: []urlshort.DailyClicks{
+		{Date: "2023-11-02", Clicks: 2},
+		{Date: "2023-11-01", Clicks: 1},
+	}}, nil
+}
+
+func hmacHex(secret string, ip string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(ip))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func TestRetrieveHandlerRecordsClicks(t *testing.T) {
+	tests := map[string]struct {
+		getter     urlshort.UrlShortGetter
+		recorder   *mockClickRecorder
+		opts       []urlshort.RetrieveOption
+		statusCode int
+		clicks     int
+		ipHash     string
+	}{
+		"redirect": {
+			getter:     &mockGetter{},
+			recorder:   &mockClickRecorder{},
+			statusCode: http.StatusMovedPermanently,
+			clicks:     1,
+		},
+		"ip hashed": {
+			getter:     &mockGetter{},
+			recorder:   &mockClickRecorder{},
+			opts:       []urlshort.RetrieveOption{urlshort.WithClickIPHash([]byte("secret"))},
+			statusCode: http.StatusMovedPermanently,
+			clicks:     1,
+			ipHash:     hmacHex("secret", "192.0.2.1"),
+		},
+		"ip hashed from header": {
+			getter:     &mockGetter{},
+			recorder:   &mockClickRecorder{},
+			opts:       []urlshort.RetrieveOption{urlshort.WithClickIPHash([]byte("secret")), urlshort.WithClickIPHeader("X-Forwarded-For")},
+			statusCode: http.StatusMovedPermanently,
+			clicks:     1,
+			ipHash:     hmacHex("secret", "198.51.100.7"),
+		},
+		"recording fails": {
+			getter:     &mockGetter{},
+			recorder:   &mockClickRecorder{err: errors.New("some error")},
+			statusCode: http.StatusMovedPermanently,
+			clicks:     1,
+		},
+		"missing key": {
+			getter:     &mockGetterMissingKey{},
+			recorder:   &mockClickRecorder{},
+			statusCode: http.StatusBadRequest,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			opts := append([]urlshort.RetrieveOption{urlshort.WithClickRecorder(tc.recorder)}, tc.opts...)
+			handler := urlshort.RetrieveHandler(tc.getter, http.HandlerFunc(statusBadRequestHandlerMock), opts...)
+			req, err := http.NewRequest("GET", "/short/CSl5Ow", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			req.RemoteAddr = "192.0.2.1:1234"
+			req.Header.Set("X-Forwarded-For", "203.0.113.9, 198.51.100.7")
+			req.Header.Set("Referer", "http://www.example.com")
+			req.Header.Set("User-Agent", "test-agent")
+			rr := httptest.NewRecorder()
+			handler(rr, req)
+			if status := rr.Code; status != tc.statusCode {
+				t.Errorf("handler returned wrong status code: got %v want %v", status, tc.statusCode)
+			}
+			if len(tc.recorder.clicks) != tc.clicks {
+				t.Fatalf("expected %d recorded clicks but got %d", tc.clicks, len(tc.recorder.clicks))
+			}
+			if tc.clicks == 0 {
+				return
+			}
+
+			click := tc.recorder.clicks[0]
+			if click.Key != "CSl5Ow" || click.Referrer != "http://www.example.com" || click.UserAgent != "test-agent" || click.Time.IsZero() {
+				t.Errorf("recorded unexpected click %+v", click)
+			}
+			if click.IPHash != tc.ipHash {
+				t.Errorf("expected ip hash %q, got %q", tc.ipHash, click.IPHash)
+			}
+		})
+	}
+}
+
+func TestClickStatsHandler(t *testing.T) {
+	tests := map[string]struct {
+		method     string
+		path       string
+		getter     urlshort.ClickStatsGetter
+		statusCode int
+		total      int64
+		daily      []urlshort.DailyClicks
+	}{
+		"clicked key": {
+			method:     "GET",
+			path:       "/api/v1/links/CSl5Ow/stats",
+			getter:     &mockClickStatsGetter{},
+			statusCode: http.StatusOK,
+			total:      3,
+			daily: []urlshort.DailyClicks{
+				{Date: "2023-11-01", Clicks: 1},
+				{Date: "2023-11-02", Clicks: 2},
+			},
+		},
+		"never clicked key": {
+			method:     "GET",
+			path:       "/api/v1/links/other/stats",
+			getter:     &mockClickStatsGetter{},
+			statusCode: http.StatusOK,
+			daily:      []urlshort.DailyClicks{},
+		},
+		"invalid method": {
+			method:     "POST",
+			path:       "/api/v1/links/CSl5Ow/stats",
+			getter:     &mockClickStatsGetter{},
+			statusCode: http.StatusMethodNotAllowed,
+		},
+		"error getting stats": {
+			method:     "GET",
+			path:       "/api/v1/links/CSl5Ow/stats",
+			getter:     &mockClickStatsGetter{err: errors.New("some error")},
+			statusCode: http.StatusInternalServerError,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			handler := urlshort.ClickStatsHandler(tc.getter)
+			req, err := http.NewRequest(tc.method, tc.path, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			rr := httptest.NewRecorder()
+			handler(rr, req)
+			if status := rr.Code; status != tc.statusCode {
+				t.Fatalf("handler returned wrong status code: got %v want %v", status, tc.statusCode)
+			}
+			if tc.statusCode != http.StatusOK {
+				return
+			}
+
+			var stats urlshort.ClickStats
+			if err := json.NewDecoder(rr.Body).Decode(&stats); err != nil {
+				t.Fatalf("error was not expected but got: %s", err.Error())
+			}
+			if stats.Total != tc.total {
+				t.Errorf("handler returned wrong total: got %v want %v", stats.Total, tc.total)
+			}
+			if stats.Daily == nil || len(stats.Daily) != len(tc.daily) {
+				t.Fatalf("handler returned wrong daily clicks: got %v want %v", stats.Daily, tc.daily)
+			}
+			for i := range tc.daily {
+				if stats.Daily[i] != tc.daily[i] {
+					t.Errorf("handler returned wrong daily clicks: got %v want %v", stats.Daily, tc.daily)
+				}
+			}
+		})
+	}
+}
+
+func TestWithClickIPHashRequiresSecret(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("expected WithClickIPHash to panic")
+		}
+	}()
+	urlshort.WithClickIPHash(nil)
+}
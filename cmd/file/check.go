@@ -0,0 +1,79 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"urlshort"
+)
+
+// problem is a validation problem reported by -check, printed as a line of JSON.
+type problem struct {
+	// File is empty for problems not tied to a file, such as a missing one.
+	File string `json:"file,omitempty"`
+	// Index, Line and Column locate the entry at fault, see urlshort.MappingError.
+	// They are omitted for problems with the whole file.
+	Index  *int   `json:"index,omitempty"`
+	Line   int    `json:"line,omitempty"`
+	Column int    `json:"column,omitempty"`
+	Error  string `json:"error"`
+	Detail string `json:"detail,omitempty"`
+}
+
+// check validates the mapping files like the server would load them, printing
+// every problem found to w as a line of JSON. It reports whether the files are valid.
+func check(w io.Writer, yamlPaths, jsonPaths, otherPaths []string) bool {
+	var problems []problem
+	files, err := readFiles(yamlPaths, jsonPaths, otherPaths)
+	if err != nil {
+		problems = append(problems, problem{Error: err.Error()})
+	}
+
+	// files that don't parse are reported on their own, so the rest can still
+	// be validated together
+	var parsed []urlshort.MappingFile
+	for _, file := range files {
+		_, err := urlshort.FilesHandler([]urlshort.MappingFile{file}, nil)
+		var errs urlshort.MappingErrors
+		if err != nil && !errors.As(err, &errs) {
+			problems = append(problems, problem{File: file.Name, Error: fileError(err).Error()})
+			continue
+		}
+		parsed = append(parsed, file)
+	}
+
+	if _, err := urlshort.FilesHandler(parsed, nil); err != nil {
+		var errs urlshort.MappingErrors
+		if !errors.As(err, &errs) {
+			problems = append(problems, problem{Error: err.Error()})
+		}
+		for _, e := range errs {
+			index := e.Index
+			problems = append(problems, problem{
+				File:   e.File,
+				Index:  &index,
+				Line:   e.Line,
+				Column: e.Column,
+				Error:  e.Err.Error(),
+				Detail: e.Detail,
+			})
+		}
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetEscapeHTML(false)
+	for _, p := range problems {
+		enc.Encode(p)
+	}
+	return len(problems) == 0
+}
+
+// fileError strips the file name FilesHandler prefixes the errors of a file
+// with, already reported as the file of the problem, returning err as is when
+// it doesn't wrap another error.
+func fileError(err error) error {
+	if inner := errors.Unwrap(err); inner != nil {
+		return inner
+	}
+	return err
+}
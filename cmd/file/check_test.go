@@ -0,0 +1,95 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCheck(t *testing.T) {
+	dir := t.TempDir()
+	mockFiles := map[string]string{
+		"valid.yml":   "- path: /a\n  url: https://www.example.com/a\n",
+		"invalid.yml": "- path: /a\n  url: https://www.example.com/other\n- path: b\n  url: ftp://www.example.com/b\n",
+		"broken.json": `[{"path": "/c",`,
+	}
+	for name, content := range mockFiles {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatalf("error creating mock file:: %v", err)
+		}
+	}
+	valid := filepath.Join(dir, "valid.yml")
+	invalid := filepath.Join(dir, "invalid.yml")
+	broken := filepath.Join(dir, "broken.json")
+
+	tests := map[string]struct {
+		yaml   []string
+		json   []string
+		ok     bool
+		output []string
+	}{
+		"valid files": {
+			yaml: []string{valid},
+			ok:   true,
+		},
+		"no file": {
+			ok:     false,
+			output: []string{`{"error":"must provide a file"}`},
+		},
+		"every problem": {
+			yaml: []string{valid, invalid},
+			json: []string{broken},
+			ok:   false,
+			output: []string{
+				`{"file":"` + broken + `","error":"unexpected end of JSON input"}`,
+				`{"file":"` + invalid + `","index":0,"line":1,"column":3,"error":"repeated path","detail":"\"/a\" is already mapped to https://www.example.com/a by ` + valid + `[0] (line 1, column 3)"}`,
+				`{"file":"` + invalid + `","index":1,"line":3,"column":3,"error":"invalid path","detail":"\"b\" must start with /"}`,
+				`{"file":"` + invalid + `","index":1,"line":3,"column":3,"error":"unsupported url scheme","detail":"\"ftp\", expected http or https"}`,
+			},
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			var out bytes.Buffer
+			if ok := check(&out, tc.yaml, tc.json, nil); ok != tc.ok {
+				t.Fatalf("expected: %v, got: %v", tc.ok, ok)
+			}
+			var lines []string
+			if out.Len() > 0 {
+				lines = strings.Split(strings.TrimSuffix(out.String(), "\n"), "\n")
+			}
+			if len(lines) != len(tc.output) {
+				t.Fatalf("expected: %v, got: %v", tc.output, lines)
+			}
+			for i := range lines {
+				if lines[i] != tc.output[i] {
+					t.Errorf("expected: %v, got: %v", tc.output[i], lines[i])
+				}
+			}
+		})
+	}
+}
+
+func TestFileError(t *testing.T) {
+	inner := errors.New("unexpected end of JSON input")
+	tests := map[string]struct {
+		err      error
+		expected error
+	}{
+		"wrapped with the file name": {err: fmt.Errorf("paths.json: %w", inner), expected: inner},
+		"not wrapped":                {err: inner, expected: inner},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			if got := fileError(tc.err); got != tc.expected {
+				t.Errorf("expected %v, got %v", tc.expected, got)
+			}
+		})
+	}
+}
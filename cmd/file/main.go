@@ -1,49 +1,91 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
-	"io"
+	"io/fs"
 	"log"
 	"net/http"
 	"os"
+	"os/signal"
 	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
 	"urlshort/internal/server"
 
 	"urlshort"
 )
 
 func main() {
-	yaml := flag.String("yaml", "", "path YAML file")
-	json := flag.String("json", "", "path JSON file")
+	var yaml, json, files pathList
+	flag.Var(&yaml, "yaml", "path YAML file or directory, can be repeated")
+	flag.Var(&json, "json", "path JSON file or directory, can be repeated")
+	flag.Var(&files, "file", "path of a .yml, .yaml, .json, .csv or .toml file, parsed according to its extension, or directory, can be repeated")
 	listenAddress := flag.String("listen", "8080", "Listen address.")
+	reloadInterval := flag.Duration("reload", 2*time.Second, "How often to check the files for changes, 0 to only reload on SIGHUP.")
+	checkOnly := flag.Bool("check", false, "Validate the files, printing every problem as a line of JSON, and exit with status 1 if any is found.")
+	status := flag.Int("status", urlshort.DefaultRedirectStatus, "Status of the redirects of mappings without their own: 301, 302, 307 or 308.")
+	query := flag.String("query", string(urlshort.DefaultQueryPolicy), "What happens to the query of requests to mappings without their own policy: drop, append or override.")
 	flag.Parse()
 
-	filedata, err := readFile(yaml, json)
-	if err != nil {
-		log.Fatal(err)
+	if *checkOnly {
+		if !check(os.Stdout, yaml, json, files) {
+			os.Exit(1)
+		}
+		return
+	}
+
+	if err := urlshort.ValidateRedirectStatus(*status); err != nil || *status == 0 {
+		log.Fatalf("-status must be 301, 302, 307 or 308, got %d", *status)
 	}
+	statusOption := urlshort.WithMapRedirectStatus(*status)
+	if err := urlshort.ValidateQueryPolicy(urlshort.QueryPolicy(*query)); err != nil || *query == "" {
+		log.Fatalf("-query must be drop, append or override, got %q", *query)
+	}
+	queryOption := urlshort.WithMapQueryPolicy(urlshort.QueryPolicy(*query))
 
 	// fallback
 	mux := defaultMux()
-	var handlerRedirect http.HandlerFunc
-	if filedata.isYAML {
-		handlerRedirect, err = urlshort.YAMLHandler(filedata.data, mux)
-		if err != nil {
-			log.Fatal(err)
-		}
-	} else if filedata.isJSON {
-		handlerRedirect, err = urlshort.JSONHandler(filedata.data, mux)
-		if err != nil {
-			log.Fatal(err)
-		}
+	paths := append(append(append([]string{}, yaml...), json...), files...)
+	handlerRedirect, err := newReloader(paths, func() (http.HandlerFunc, error) {
+		return loadHandler(yaml, json, files, mux, statusOption, queryOption)
+	})
+	if err != nil {
+		log.Fatal(err)
 	}
 
-	router(handlerRedirect)
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	go handlerRedirect.watch(context.Background(), *reloadInterval, hup)
+
+	router(handlerRedirect.ServeHTTP)
 	svr := server.New(*listenAddress)
 	svr.Start()
 }
 
+// pathList is a flag that can be repeated, collecting every value given.
+type pathList []string
+
+func (p *pathList) String() string {
+	return strings.Join(*p, ",")
+}
+
+func (p *pathList) Set(value string) error {
+	*p = append(*p, value)
+	return nil
+}
+
+// loadHandler reads the mapping files and builds their merged redirects.
+func loadHandler(yaml, json, other []string, fallback http.Handler, opts ...urlshort.MapOption) (http.HandlerFunc, error) {
+	files, err := readFiles(yaml, json, other)
+	if err != nil {
+		return nil, err
+	}
+	return urlshort.FilesHandler(files, fallback, opts...)
+}
+
 func defaultMux() *http.ServeMux {
 	mux := http.NewServeMux()
 	mux.HandleFunc("/", hello)
@@ -54,46 +96,85 @@ func hello(w http.ResponseWriter, r *http.Request) {
 	fmt.Fprintln(w, "Hello, world!")
 }
 
-type fileData struct {
-	data   []byte
-	isJSON bool
-	isYAML bool
+// mappingFormats maps the extensions of mapping files to their format.
+var mappingFormats = map[string]urlshort.MappingFormat{
+	".yml":  urlshort.FormatYAML,
+	".yaml": urlshort.FormatYAML,
+	".json": urlshort.FormatJSON,
+	".csv":  urlshort.FormatCSV,
+	".toml": urlshort.FormatTOML,
 }
 
-func readFile(yaml, json *string) (*fileData, error) {
-	var filedata fileData
-
-	path := ""
-	if len(*yaml) > 0 && len(*json) > 0 {
-		return nil, fmt.Errorf("must provide json or yaml but not both at the same time")
-	} else if len(*yaml) > 0 {
-		path = *yaml
-		if ext := filepath.Ext(path); ext != ".yml" && ext != ".yaml" {
+// readFiles reads the YAML, JSON and other files given, parsed according to
+// their extension, and every file with an extension in mappingFormats within
+// the directories given.
+func readFiles(yaml, json, other []string) ([]urlshort.MappingFile, error) {
+	if len(yaml) == 0 && len(json) == 0 && len(other) == 0 {
+		return nil, fmt.Errorf("must provide a file")
+	}
+	for _, path := range yaml {
+		if ext := filepath.Ext(path); ext != ".yml" && ext != ".yaml" && !isDir(path) {
 			return nil, fmt.Errorf("expected yml or yaml file")
 		}
-		filedata.isYAML = true
-	} else if len(*json) > 0 {
-		path = *json
-		if ext := filepath.Ext(path); ext != ".json" {
+	}
+	for _, path := range json {
+		if ext := filepath.Ext(path); ext != ".json" && !isDir(path) {
 			return nil, fmt.Errorf("expected json file")
 		}
-		filedata.isJSON = true
-	} else {
-		return nil, fmt.Errorf("must provide a file")
+	}
+	for _, path := range other {
+		if _, ok := mappingFormats[filepath.Ext(path)]; !ok && !isDir(path) {
+			return nil, fmt.Errorf("expected yml, yaml, json, csv or toml file")
+		}
 	}
 
-	file, err := os.Open(path)
+	names, err := listFiles(append(append(append([]string{}, yaml...), json...), other...))
 	if err != nil {
 		return nil, err
 	}
-	defer file.Close()
+	files := make([]urlshort.MappingFile, 0, len(names))
+	for _, name := range names {
+		data, err := os.ReadFile(name)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, urlshort.MappingFile{
+			Name:   name,
+			Format: mappingFormats[filepath.Ext(name)],
+			Data:   data,
+		})
+	}
+	return files, nil
+}
 
-	filedata.data, err = io.ReadAll(file)
-	if err != nil {
-		return nil, err
+// listFiles returns the files at paths, expanding directories into every file
+// within them, recursively, with an extension in mappingFormats.
+func listFiles(paths []string) ([]string, error) {
+	var names []string
+	for _, path := range paths {
+		if !isDir(path) {
+			names = append(names, path)
+			continue
+		}
+		err := filepath.WalkDir(path, func(name string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if _, ok := mappingFormats[filepath.Ext(name)]; ok && !d.IsDir() {
+				names = append(names, name)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
 	}
+	return names, nil
+}
 
-	return &filedata, nil
+func isDir(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && info.IsDir()
 }
 
 func router(handlerRedirect http.HandlerFunc) {
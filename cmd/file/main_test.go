@@ -4,49 +4,20 @@ import (
 	"os"
 	"path/filepath"
 	"reflect"
+	"strings"
 	"testing"
+	"urlshort"
 )
 
-func TestReadFile(t *testing.T) {
+func TestReadFiles(t *testing.T) {
 	dir := t.TempDir()
-	tests := map[string]struct {
-		yaml            string
-		json            string
-		mockFilePath    string
-		mockFileContent []byte
-		output          *fileData
-		expectedError   bool
-		errMessage      string
-	}{
-		"no file":            {yaml: "", json: "", output: nil, expectedError: true, errMessage: "must provide a file"},
-		"two files provided": {yaml: "paths.yml", json: "paths.nil", output: nil, expectedError: true, errMessage: "must provide json or yaml but not both at the same time"},
-		"expected json file": {yaml: "", json: "paths.yml", output: nil, expectedError: true, errMessage: "expected json file"},
-		"expected yaml file": {yaml: "paths.json", json: "", output: nil, expectedError: true, errMessage: "expected yml or yaml file"},
-		"reading yaml file": {
-			yaml:         filepath.Join(dir, "paths.yml"),
-			mockFilePath: filepath.Join(dir, "paths.yml"),
-			mockFileContent: []byte(`
+	yamlContent := []byte(`
 - path: /urlshort
-	url: https://github.com/gophercises/urlshort
+  url: https://github.com/gophercises/urlshort
 - path: /urlshort-final
-	url: https://github.com/gophercises/urlshort/tree/solution
-`),
-			output: &fileData{
-				data: []byte(`
-- path: /urlshort
-	url: https://github.com/gophercises/urlshort
-- path: /urlshort-final
-	url: https://github.com/gophercises/urlshort/tree/solution
-`),
-				isJSON: false,
-				isYAML: true,
-			},
-			expectedError: false,
-		},
-		"reading json file": {
-			json:         filepath.Join(dir, "paths.json"),
-			mockFilePath: filepath.Join(dir, "paths.json"),
-			mockFileContent: []byte(`
+  url: https://github.com/gophercises/urlshort/tree/solution
+`)
+	jsonContent := []byte(`
 [
 	{
 		"path": "/urlshort",
@@ -57,37 +28,86 @@ func TestReadFile(t *testing.T) {
 		"url": "https://github.com/gophercises/urlshort/tree/solution"
 	}
 ]
-`),
-			output: &fileData{
-				data: []byte(`
-[
-	{
-		"path": "/urlshort",
-		"url": "https://github.com/gophercises/urlshort"
-	},
-	{
-		"path": "/urlshort-final",
-		"url": "https://github.com/gophercises/urlshort/tree/solution"
+`)
+	csvContent := []byte("path,url\n/urlshort,https://github.com/gophercises/urlshort\n")
+	tomlContent := []byte("[[mappings]]\npath = \"/urlshort\"\nurl = \"https://github.com/gophercises/urlshort\"\n")
+	mockFiles := map[string][]byte{
+		"paths.yml":           yamlContent,
+		"paths.json":          jsonContent,
+		"teams/a.yaml":        yamlContent,
+		"teams/README.md":     []byte("not a mapping file"),
+		"teams/nested/b.json": jsonContent,
+		"paths.csv":           csvContent,
+		"paths.toml":          tomlContent,
 	}
-]
-`),
-				isJSON: true,
-				isYAML: false,
+	for name, content := range mockFiles {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("error creating mock directory:: %v", err)
+		}
+		if err := os.WriteFile(path, content, 0644); err != nil {
+			t.Fatalf("error creating mock file:: %v", err)
+		}
+	}
+
+	tests := map[string]struct {
+		yaml          []string
+		json          []string
+		other         []string
+		output        []urlshort.MappingFile
+		expectedError bool
+		errMessage    string
+	}{
+		"no file":            {output: nil, expectedError: true, errMessage: "must provide a file"},
+		"expected json file": {json: []string{"paths.yml"}, output: nil, expectedError: true, errMessage: "expected json file"},
+		"expected yaml file": {yaml: []string{"paths.json"}, output: nil, expectedError: true, errMessage: "expected yml or yaml file"},
+		"reading yaml file": {
+			yaml: []string{filepath.Join(dir, "paths.yml")},
+			output: []urlshort.MappingFile{
+				{Name: filepath.Join(dir, "paths.yml"), Format: urlshort.FormatYAML, Data: yamlContent},
 			},
-			expectedError: false,
+		},
+		"reading json file": {
+			json: []string{filepath.Join(dir, "paths.json")},
+			output: []urlshort.MappingFile{
+				{Name: filepath.Join(dir, "paths.json"), Format: urlshort.FormatJSON, Data: jsonContent},
+			},
+		},
+		"reading yaml and json files": {
+			yaml: []string{filepath.Join(dir, "paths.yml")},
+			json: []string{filepath.Join(dir, "paths.json")},
+			output: []urlshort.MappingFile{
+				{Name: filepath.Join(dir, "paths.yml"), Format: urlshort.FormatYAML, Data: yamlContent},
+				{Name: filepath.Join(dir, "paths.json"), Format: urlshort.FormatJSON, Data: jsonContent},
+			},
+		},
+		"reading directory": {
+			yaml: []string{filepath.Join(dir, "teams")},
+			output: []urlshort.MappingFile{
+				{Name: filepath.Join(dir, "teams/a.yaml"), Format: urlshort.FormatYAML, Data: yamlContent},
+				{Name: filepath.Join(dir, "teams/nested/b.json"), Format: urlshort.FormatJSON, Data: jsonContent},
+			},
+		},
+		"reading files by extension": {
+			other: []string{filepath.Join(dir, "paths.csv"), filepath.Join(dir, "paths.toml"), filepath.Join(dir, "paths.yml")},
+			output: []urlshort.MappingFile{
+				{Name: filepath.Join(dir, "paths.csv"), Format: urlshort.FormatCSV, Data: csvContent},
+				{Name: filepath.Join(dir, "paths.toml"), Format: urlshort.FormatTOML, Data: tomlContent},
+				{Name: filepath.Join(dir, "paths.yml"), Format: urlshort.FormatYAML, Data: yamlContent},
+			},
+		},
+		"unsupported extension": {other: []string{"paths.txt"}, output: nil, expectedError: true, errMessage: "expected yml, yaml, json, csv or toml file"},
+		"missing file": {
+			yaml:          []string{filepath.Join(dir, "missing.yml")},
+			output:        nil,
+			expectedError: true,
+			errMessage:    "open " + filepath.Join(dir, "missing.yml") + ": no such file or directory",
 		},
 	}
 
 	for name, tc := range tests {
 		t.Run(name, func(t *testing.T) {
-			// create mock file if needed
-			if len(tc.mockFilePath) > 0 && len(tc.mockFileContent) > 0 {
-				if err := os.WriteFile(tc.mockFilePath, tc.mockFileContent, 0644); err != nil {
-					t.Fatalf("error creating mock file:: %v", err)
-				}
-			}
-
-			output, err := readFile(&tc.yaml, &tc.json)
+			output, err := readFiles(tc.yaml, tc.json, tc.other)
 			if (err != nil) != tc.expectedError {
 				t.Fatalf("expected: %v, got: %v", tc.expectedError, (err != nil))
 			}
@@ -102,3 +122,25 @@ func TestReadFile(t *testing.T) {
 		})
 	}
 }
+
+func TestLoadHandlerDuplicateAcrossFiles(t *testing.T) {
+	dir := t.TempDir()
+	teamA := filepath.Join(dir, "team-a.yml")
+	teamB := filepath.Join(dir, "team-b.json")
+	if err := os.WriteFile(teamA, []byte("- path: /a\n  url: https://www.example.com/a\n- path: /docs\n  url: https://www.example.com/a/docs\n"), 0644); err != nil {
+		t.Fatalf("error creating mock file:: %v", err)
+	}
+	if err := os.WriteFile(teamB, []byte(`[{"path": "/docs", "url": "https://www.example.com/b/docs"}]`), 0644); err != nil {
+		t.Fatalf("error creating mock file:: %v", err)
+	}
+
+	_, err := loadHandler([]string{dir}, nil, nil, defaultMux())
+	if err == nil {
+		t.Fatalf("expected duplicate path to be reported")
+	}
+	for _, want := range []string{`"/docs"`, teamA + "[1]", "https://www.example.com/a/docs", teamB + "[0]"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("expected error to mention %s, got: %v", want, err)
+		}
+	}
+}
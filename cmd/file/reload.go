@@ -0,0 +1,117 @@
+package main
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// reloader serves the redirects built from mapping files and rebuilds them when
+// the files change, swapping them atomically so requests never see a partial map.
+// Until a change loads cleanly the previous redirects keep being served.
+type reloader struct {
+	// paths are the files and directories watched, see listFiles.
+	paths   []string
+	load    func() (http.HandlerFunc, error)
+	handler atomic.Pointer[http.HandlerFunc]
+	// seen identifies the version of the files last loaded or attempted, so a
+	// broken file is reported once rather than on every poll.
+	seen []fileVersion
+}
+
+// fileVersion is what is compared to tell whether a file changed.
+type fileVersion struct {
+	name    string
+	modTime int64
+	size    int64
+}
+
+func newReloader(paths []string, load func() (http.HandlerFunc, error)) (*reloader, error) {
+	rl := &reloader{paths: paths, load: load}
+	if err := rl.reload(); err != nil {
+		return nil, err
+	}
+	return rl, nil
+}
+
+func (rl *reloader) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	(*rl.handler.Load())(w, r)
+}
+
+// version returns the current version of every file watched, so files added to
+// or removed from a directory are noticed too.
+func (rl *reloader) version() ([]fileVersion, error) {
+	names, err := listFiles(rl.paths)
+	if err != nil {
+		return nil, err
+	}
+	versions := make([]fileVersion, 0, len(names))
+	for _, name := range names {
+		info, err := os.Stat(name)
+		if err != nil {
+			return nil, err
+		}
+		versions = append(versions, fileVersion{name: name, modTime: info.ModTime().UnixNano(), size: info.Size()})
+	}
+	return versions, nil
+}
+
+// reload rebuilds the redirects from the files, leaving the current ones in
+// place if they can't be read or don't validate.
+func (rl *reloader) reload() error {
+	v, err := rl.version()
+	if err != nil {
+		return err
+	}
+	rl.seen = v
+	handler, err := rl.load()
+	if err != nil {
+		return err
+	}
+	rl.handler.Store(&handler)
+	return nil
+}
+
+// watch reloads the files whenever a value is received from hup or, every
+// interval, any of them was added, removed, or its modification time or size
+// changed, until ctx is done. Polling
+// is disabled when interval is 0. Failed reloads are logged.
+func (rl *reloader) watch(ctx context.Context, interval time.Duration, hup <-chan os.Signal) {
+	var tick <-chan time.Time
+	if interval > 0 {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hup:
+		case <-tick:
+			v, err := rl.version()
+			if err != nil {
+				if rl.seen != nil {
+					log.Printf("Error checking mapping files: %v", err)
+					rl.seen = nil
+				}
+				continue
+			}
+			if slices.Equal(v, rl.seen) {
+				continue
+			}
+		}
+
+		if err := rl.reload(); err != nil {
+			log.Printf("Error reloading mapping files, keeping previous mappings: %v", err)
+			continue
+		}
+		log.Printf("Reloaded mapping files %s", strings.Join(rl.paths, ", "))
+	}
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// redirectOf returns where handler redirects path to, empty if it doesn't.
+func redirectOf(handler http.Handler, path string) string {
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest("GET", path, nil))
+	return rr.Header().Get("Location")
+}
+
+// writeMapping writes content to path with a modification time distinct from
+// any previous write, so changes are noticed whatever the filesystem resolution.
+func writeMapping(t *testing.T, path, content string, modTime time.Time) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatalf("error creating mock file:: %v", err)
+	}
+	if err := os.Chtimes(path, modTime, modTime); err != nil {
+		t.Fatalf("error setting mock file time:: %v", err)
+	}
+}
+
+func TestReloader(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "paths.yml")
+	yaml := []string{path}
+	start := time.Now().Add(-time.Hour)
+	writeMapping(t, path, "- path: /a\n  url: https://www.example.com/a\n", start)
+
+	rl, err := newReloader(yaml, func() (http.HandlerFunc, error) {
+		return loadHandler(yaml, nil, nil, defaultMux())
+	})
+	if err != nil {
+		t.Fatalf("error was not expected but got: %s", err.Error())
+	}
+	if got := redirectOf(rl, "/a"); got != "https://www.example.com/a" {
+		t.Fatalf("expected redirect to https://www.example.com/a, got %q", got)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	hup := make(chan os.Signal)
+	go rl.watch(ctx, 10*time.Millisecond, hup)
+
+	waitFor := func(path, want string) {
+		t.Helper()
+		deadline := time.Now().Add(2 * time.Second)
+		for redirectOf(rl, path) != want {
+			if time.Now().After(deadline) {
+				t.Fatalf("expected %s to redirect to %q, got %q", path, want, redirectOf(rl, path))
+			}
+			time.Sleep(5 * time.Millisecond)
+		}
+	}
+
+	writeMapping(t, path, "- path: /a\n  url: https://www.example.com/b\n", start.Add(time.Second))
+	waitFor("/a", "https://www.example.com/b")
+
+	// a file that doesn't validate keeps the previous mappings
+	writeMapping(t, path, "- path: /a\n  url: https://www.example.com/c\n- path: /a\n  url: https://www.example.com/d\n", start.Add(2*time.Second))
+	time.Sleep(50 * time.Millisecond)
+	if got := redirectOf(rl, "/a"); got != "https://www.example.com/b" {
+		t.Fatalf("expected previous redirect to be kept, got %q", got)
+	}
+
+	// SIGHUP reloads even when the file looks unchanged
+	writeMapping(t, path, "- path: /a\n  url: https://www.example.com/e\n", start.Add(2*time.Second))
+	hup <- os.Interrupt
+	waitFor("/a", "https://www.example.com/e")
+}
+
+func TestNewReloaderInvalidFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "paths.json")
+	json := []string{path}
+	writeMapping(t, path, `[{"path": "/a", "url": `, time.Now())
+
+	_, err := newReloader(json, func() (http.HandlerFunc, error) {
+		return loadHandler(nil, json, nil, defaultMux())
+	})
+	if err == nil {
+		t.Fatalf("expected error loading invalid file")
+	}
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"sort"
+	"text/tabwriter"
+	"time"
+	"urlshort"
+)
+
+// apiKeyCommand runs the apikey subcommand described by args against storage,
+// writing its output to w:
+//
+//	apikey create -name NAME
+//	apikey revoke ID
+//	apikey list
+func apiKeyCommand(ctx context.Context, storage urlshort.APIKeyStore, args []string, w io.Writer) error {
+	if len(args) == 0 {
+		return errors.New("usage: apikey create -name NAME | apikey revoke ID | apikey list")
+	}
+	switch args[0] {
+	case "create":
+		flags := flag.NewFlagSet("apikey create", flag.ContinueOnError)
+		name := flags.String("name", "", "Name telling what the key is used for.")
+		if err := flags.Parse(args[1:]); err != nil {
+			return err
+		}
+		key, token, err := urlshort.GenerateAPIKey(ctx, *name)
+		if err != nil {
+			return err
+		}
+		if err = storage.SaveAPIKey(ctx, key); err != nil {
+			return fmt.Errorf("saving api key: %w", err)
+		}
+		fmt.Fprintf(w, "Created API key %s, its token is shown only once:\n%s\n", key.ID, token)
+		return nil
+	case "revoke":
+		if len(args) != 2 {
+			return errors.New("usage: apikey revoke ID")
+		}
+		if err := urlshort.RevokeAPIKey(ctx, storage, args[1]); err != nil {
+			return fmt.Errorf("revoking api key %s: %w", args[1], err)
+		}
+		fmt.Fprintf(w, "Revoked API key %s\n", args[1])
+		return nil
+	case "list":
+		keys, err := storage.ListAPIKeys(ctx)
+		if err != nil {
+			return fmt.Errorf("listing api keys: %w", err)
+		}
+		sort.Slice(keys, func(i, j int) bool { return keys[i].CreatedAt.Before(keys[j].CreatedAt) })
+		tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, "ID\tNAME\tCREATED\tREVOKED")
+		for _, key := range keys {
+			revoked := "-"
+			if key.Revoked() {
+				revoked = key.RevokedAt.UTC().Format(time.RFC3339)
+			}
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", key.ID, key.Name, key.CreatedAt.UTC().Format(time.RFC3339), revoked)
+		}
+		return tw.Flush()
+	default:
+		return fmt.Errorf("unknown apikey command %q, expected create, revoke or list", args[0])
+	}
+}
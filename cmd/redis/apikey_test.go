@@ -0,0 +1,84 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+	"time"
+	"urlshort"
+	"urlshort/internal/memory"
+)
+
+func TestAPIKeyCommand(t *testing.T) {
+	tests := map[string]struct {
+		args    []string
+		output  []string
+		err     bool
+		revoked bool
+	}{
+		"create":              {args: []string{"create", "-name", "posters"}, output: []string{"Created API key ", "shown only once"}},
+		"create unknown flag": {args: []string{"create", "-owner", "posters"}, err: true},
+		"list":                {args: []string{"list"}, output: []string{"ID", "NAME", "existing", "ci"}},
+		"revoke":              {args: []string{"revoke", "existing"}, output: []string{"Revoked API key existing"}, revoked: true},
+		"revoke missing id":   {args: []string{"revoke"}, err: true},
+		"revoke unknown key":  {args: []string{"revoke", "unknown"}, err: true},
+		"no command":          {args: []string{}, err: true},
+		"unknown command":     {args: []string{"rotate"}, err: true},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			storage := memory.New()
+			existing := urlshort.APIKey{ID: "existing", Name: "ci", Hash: "0123abcd", CreatedAt: time.Now()}
+			if err := storage.SaveAPIKey(ctx, existing); err != nil {
+				t.Fatalf("error was not expected but got: %s", err.Error())
+			}
+
+			var out bytes.Buffer
+			err := apiKeyCommand(ctx, storage, tc.args, &out)
+			if (err != nil) != tc.err {
+				t.Fatalf("expected error %v, got %v", tc.err, err)
+			}
+			for _, s := range tc.output {
+				if !strings.Contains(out.String(), s) {
+					t.Errorf("expected output to contain %q, got %q", s, out.String())
+				}
+			}
+
+			keys, err := storage.ListAPIKeys(ctx)
+			if err != nil {
+				t.Fatalf("error was not expected but got: %s", err.Error())
+			}
+			for _, key := range keys {
+				if key.ID == "existing" && key.Revoked() != tc.revoked {
+					t.Errorf("expected the existing key to be revoked %v, got %v", tc.revoked, key.Revoked())
+				}
+				if key.ID != "existing" && (tc.args[0] != "create" || key.Name != "posters" || !strings.Contains(out.String(), key.ID)) {
+					t.Errorf("unexpected key %v", key)
+				}
+			}
+		})
+	}
+}
+
+func TestAPIKeyCommandListHidesTokens(t *testing.T) {
+	ctx := context.Background()
+	storage := memory.New()
+	var out bytes.Buffer
+	if err := apiKeyCommand(ctx, storage, []string{"create", "-name", "posters"}, &out); err != nil {
+		t.Fatalf("error was not expected but got: %s", err.Error())
+	}
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	token := lines[len(lines)-1]
+	id, _, _ := strings.Cut(token, ".")
+
+	var listed bytes.Buffer
+	if err := apiKeyCommand(ctx, storage, []string{"list"}, &listed); err != nil {
+		t.Fatalf("error was not expected but got: %s", err.Error())
+	}
+	if !strings.Contains(listed.String(), id) || strings.Contains(listed.String(), token) {
+		t.Errorf("expected the key to be listed without its token, got %q", listed.String())
+	}
+}
@@ -1,46 +1,433 @@
 package main
 
 import (
+	"context"
+	"fmt"
+	"io"
 	"log"
 	"net/http"
 	"os"
 	"strconv"
+	"strings"
+	"time"
 	"urlshort"
+	"urlshort/internal/disk"
+	"urlshort/internal/memory"
 	"urlshort/internal/redis"
 	"urlshort/internal/server"
 )
 
+type storage interface {
+	urlshort.UrlShortSaver
+	urlshort.UrlShortGetter
+	urlshort.UrlShortDeleter
+	urlshort.UrlShortUpdater
+	urlshort.UrlShortExister
+	urlshort.UrlShortLister
+	urlshort.KeyCounter
+	urlshort.UrlShortDeduplicator
+	urlshort.APIKeyStore
+}
+
+// legacyMigrator is implemented by storages that can move links saved by older
+// versions to where they are looked up now.
+type legacyMigrator interface {
+	MigrateLegacyKeys(ctx context.Context) (int, error)
+}
+
 func main() {
-	expirationMinutes, err := strconv.Atoi(os.Getenv("REDIS_EXPIRATION_MINUTES"))
+	defaultExpiration, err := minutesFromEnv("REDIS_EXPIRATION_MINUTES")
+	if err != nil {
+		log.Fatal(err)
+	}
+	maxExpiration, err := minutesFromEnv("MAX_EXPIRATION_MINUTES")
+	if err != nil {
+		log.Fatal(err)
+	}
+	if maxExpiration > 0 && defaultExpiration > maxExpiration {
+		log.Fatal("REDIS_EXPIRATION_MINUTES can't be greater than MAX_EXPIRATION_MINUTES")
+	}
+
+	redirectStatus, err := redirectStatusFromEnv("REDIRECT_STATUS")
+	if err != nil {
+		log.Fatal(err)
+	}
+	queryPolicy, err := queryPolicyFromEnv("QUERY_POLICY")
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	pages, err := pagesFromEnv("PAGES_DIR")
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	createLimit, err := rateLimitFromEnv("create", "CREATE_RATE_LIMIT", "CREATE_RATE_BURST")
+	if err != nil {
+		log.Fatal(err)
+	}
+	redirectLimit, err := rateLimitFromEnv("redirect", "REDIRECT_RATE_LIMIT", "REDIRECT_RATE_BURST")
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if os.Getenv("STORAGE") == "memory" && os.Getenv("REQUIRE_API_KEY") == "true" {
+		log.Fatal("REQUIRE_API_KEY can't be used with in-memory storage, whose API keys can't be created")
+	}
+
+	storage, err := newStorage(os.Getenv("STORAGE"))
 	if err != nil {
 		log.Fatal(err)
 	}
-	storage := redis.New(&redis.Options{
-		Host:              os.Getenv("REDIS_HOST"),
-		Port:              os.Getenv("REDIS_PORT"),
-		Username:          os.Getenv("REDIS_USERNAME"),
-		Password:          os.Getenv("REDIS_PASSWORD"),
-		ExpirationMinutes: expirationMinutes,
-	})
 
-	shortenerHandler := urlshort.Shortener(storage, os.Getenv("HOST"), invalidUrlMux())
-	retrieverHandler := urlshort.RetrieveHandler(storage, missingUrlMux())
+	if len(os.Args) > 1 && os.Args[1] == "apikey" {
+		if os.Getenv("STORAGE") == "memory" {
+			log.Fatal("API keys can't be managed from the command line with in-memory storage")
+		}
+		err = apiKeyCommand(context.Background(), storage, os.Args[2:], os.Stdout)
+		closeStorage(storage)
+		if err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		migrator, ok := storage.(legacyMigrator)
+		if !ok {
+			log.Fatal("only the Redis storage has links to migrate")
+		}
+		moved, err := migrator.MigrateLegacyKeys(context.Background())
+		closeStorage(storage)
+		if err != nil {
+			log.Fatal(err)
+		}
+		fmt.Printf("Moved %d links stored under their bare key\n", moved)
+		return
+	}
+
+	keyGenerator, err := newKeyGenerator(os.Getenv("KEY_STRATEGY"), storage)
+	if err != nil {
+		log.Fatal(err)
+	}
+	shortenerOptions := []urlshort.ShortenerOption{
+		urlshort.WithKeyGenerator(keyGenerator),
+		urlshort.WithDefaultExpiration(defaultExpiration),
+		urlshort.WithMaxExpiration(maxExpiration),
+		urlshort.WithPages(pages),
+	}
+	if os.Getenv("DEDUPLICATE") == "true" {
+		shortenerOptions = append(shortenerOptions, urlshort.WithDeduplication())
+	}
 
-	http.HandleFunc("/home", urlshort.ShortenerHome)
-	http.HandleFunc("/shorten", shortenerHandler)
-	http.HandleFunc("/short/", retrieverHandler)
+	shortenerHandler := urlshort.Shortener(storage, os.Getenv("HOST"), invalidUrlMux(pages), shortenerOptions...)
+	retrieveOptions := []urlshort.RetrieveOption{
+		urlshort.WithExpiredHandler(expiredUrlMux(pages)),
+		urlshort.WithRedirectStatus(redirectStatus),
+		urlshort.WithQueryPolicy(queryPolicy),
+	}
+	if recorder, ok := storage.(urlshort.ClickRecorder); ok {
+		retrieveOptions = append(retrieveOptions, urlshort.WithClickRecorder(recorder))
+		if secret := os.Getenv("CLICK_IP_SECRET"); secret != "" {
+			retrieveOptions = append(retrieveOptions, urlshort.WithClickIPHash([]byte(secret)))
+		}
+		if header := os.Getenv("CLIENT_IP_HEADER"); header != "" {
+			retrieveOptions = append(retrieveOptions, urlshort.WithClickIPHeader(header))
+		}
+	}
+	previewOptions := []urlshort.PreviewOption{
+		urlshort.WithPreviewExpiredHandler(expiredUrlMux(pages)),
+		urlshort.WithPreviewPages(pages),
+	}
+	if getter, ok := storage.(urlshort.ClickStatsGetter); ok {
+		previewOptions = append(previewOptions, urlshort.WithPreviewClickStats(getter))
+	}
+	previewHandler := urlshort.PreviewHandler(storage, missingUrlMux(pages), previewOptions...)
+	qrHandler := urlshort.QRCodeHandler(storage, os.Getenv("HOST"), missingUrlMux(pages))
+	retrieveOptions = append(retrieveOptions, urlshort.WithPreview(previewHandler), urlshort.WithQRCode(qrHandler))
+	retrieverHandler := urlshort.RetrieveHandler(storage, missingUrlMux(pages), retrieveOptions...)
+
+	// authenticate guards link creation and management when REQUIRE_API_KEY is true.
+	// Without it links can still be created and read, but not listed, updated or
+	// deleted, as anyone could.
+	requireAPIKey := os.Getenv("REQUIRE_API_KEY") == "true"
+	authenticate := func(h http.HandlerFunc) http.HandlerFunc { return h }
+	if requireAPIKey {
+		authenticate = func(h http.HandlerFunc) http.HandlerFunc { return urlshort.RequireAPIKey(storage, h) }
+	}
+
+	limitCreate := rateLimiter(storage, createLimit)
+	limitRedirect := rateLimiter(storage, redirectLimit)
+
+	// guardCreate limits link creation per client IP before authenticating, so
+	// failed attempts count too, then per API key, whatever the addresses it is
+	// used from.
+	guardCreate := limitCreate
+	if requireAPIKey {
+		guardCreate = func(h http.HandlerFunc) http.HandlerFunc { return limitCreate(authenticate(limitCreate(h))) }
+	}
+
+	http.HandleFunc("/home", pages.ShortenerHome)
+	http.HandleFunc("/shorten", guardCreate(shortenerHandler))
+	http.HandleFunc("/short/", limitRedirect(retrieverHandler))
+	http.HandleFunc("/api/v1/links", linksHandler(storage, os.Getenv("HOST"), shortenerOptions, authenticate, guardCreate, requireAPIKey))
+	http.HandleFunc("/api/v1/links/", authenticate(linkHandler(storage, os.Getenv("HOST"), requireAPIKey)))
 	svr := server.New(os.Getenv("PORT"))
 	svr.Start()
+
+	closeStorage(storage)
+}
+
+// closeStorage closes storage if it holds resources, logging failures.
+func closeStorage(storage storage) {
+	if closer, ok := storage.(io.Closer); ok {
+		if err := closer.Close(); err != nil {
+			log.Printf("Error closing storage: %v", err)
+		}
+	}
+}
+
+// minutesFromEnv reads the environment variable name as a number of minutes,
+// zero when it is not set.
+func minutesFromEnv(name string) (time.Duration, error) {
+	v := os.Getenv(name)
+	if v == "" {
+		return 0, nil
+	}
+	minutes, err := strconv.Atoi(v)
+	if err != nil || minutes < 0 {
+		return 0, fmt.Errorf("%s must be a non negative number of minutes", name)
+	}
+	return time.Duration(minutes) * time.Minute, nil
+}
+
+// pagesFromEnv parses the pages found in the directory named by the environment
+// variable name, falling back to the embedded ones for missing pages or when it is not set.
+func pagesFromEnv(name string) (*urlshort.Pages, error) {
+	dir := os.Getenv(name)
+	if dir == "" {
+		return urlshort.ParsePages(nil)
+	}
+	pages, err := urlshort.ParsePages(os.DirFS(dir))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+	return pages, nil
+}
+
+// redirectStatusFromEnv reads the environment variable name as the status of
+// redirects to links without their own, DefaultRedirectStatus when it is not set.
+func redirectStatusFromEnv(name string) (int, error) {
+	v := os.Getenv(name)
+	if v == "" {
+		return urlshort.DefaultRedirectStatus, nil
+	}
+	status, err := strconv.Atoi(v)
+	if err != nil || status == 0 || urlshort.ValidateRedirectStatus(status) != nil {
+		return 0, fmt.Errorf("%s must be 301, 302, 307 or 308", name)
+	}
+	return status, nil
+}
+
+// queryPolicyFromEnv reads the environment variable name as the query policy of
+// links without their own, DefaultQueryPolicy when it is not set.
+func queryPolicyFromEnv(name string) (urlshort.QueryPolicy, error) {
+	policy := urlshort.QueryPolicy(os.Getenv(name))
+	if policy == "" {
+		return urlshort.DefaultQueryPolicy, nil
+	}
+	if urlshort.ValidateQueryPolicy(policy) != nil {
+		return "", fmt.Errorf("%s must be drop, append or override", name)
+	}
+	return policy, nil
+}
+
+// rateLimitFromEnv reads the environment variable limitName as a number of
+// requests per minute and burstName as the number of requests allowed at once,
+// the former when it is not set. It returns a zero RateLimit when limitName is
+// not set or 0, meaning no limit.
+func rateLimitFromEnv(name string, limitName string, burstName string) (urlshort.RateLimit, error) {
+	v := os.Getenv(limitName)
+	if v == "" {
+		return urlshort.RateLimit{}, nil
+	}
+	perMinute, err := strconv.Atoi(v)
+	if err != nil || perMinute < 0 {
+		return urlshort.RateLimit{}, fmt.Errorf("%s must be a non negative number of requests per minute", limitName)
+	}
+	if perMinute == 0 {
+		return urlshort.RateLimit{}, nil
+	}
+	burst := perMinute
+	if b := os.Getenv(burstName); b != "" {
+		if burst, err = strconv.Atoi(b); err != nil || burst <= 0 {
+			return urlshort.RateLimit{}, fmt.Errorf("%s must be a positive number of requests", burstName)
+		}
+	}
+	return urlshort.RateLimit{Name: name, Rate: float64(perMinute) / 60, Burst: burst}, nil
+}
+
+// rateLimiter returns a middleware applying limit per client, or nothing when it
+// is zero. Buckets are kept in storage when it can, so they are shared by every
+// instance, or in memory otherwise. CLIENT_IP_HEADER names the header holding
+// the client IP when running behind a proxy.
+func rateLimiter(storage storage, limit urlshort.RateLimit) func(http.HandlerFunc) http.HandlerFunc {
+	if limit.Rate == 0 {
+		return func(h http.HandlerFunc) http.HandlerFunc { return h }
+	}
+	limiter, ok := storage.(urlshort.RateLimiter)
+	if !ok {
+		limiter = memory.NewRateLimiter()
+	}
+	var opts []urlshort.RateLimitOption
+	if header := os.Getenv("CLIENT_IP_HEADER"); header != "" {
+		opts = append(opts, urlshort.WithClientIPHeader(header))
+	}
+	return func(h http.HandlerFunc) http.HandlerFunc { return urlshort.LimitRate(limiter, limit, h, opts...) }
+}
+
+// newStorage returns the storage selected by kind: "redis" (default), "memory" or "disk".
+func newStorage(kind string) (storage, error) {
+	switch kind {
+	case "", "redis":
+		return redis.New(&redis.Options{
+			Host:     os.Getenv("REDIS_HOST"),
+			Port:     os.Getenv("REDIS_PORT"),
+			Username: os.Getenv("REDIS_USERNAME"),
+			Password: os.Getenv("REDIS_PASSWORD"),
+		}), nil
+	case "memory":
+		log.Printf("Using in-memory storage, shortened urls will be lost on restart")
+		return memory.New(), nil
+	case "disk":
+		path := os.Getenv("DISK_PATH")
+		if path == "" {
+			path = "urlshort.db"
+		}
+		return disk.Open(&disk.Options{
+			Path: path,
+		})
+	default:
+		return nil, fmt.Errorf("unknown storage %q, expected redis, memory or disk", kind)
+	}
+}
+
+// newKeyGenerator returns the key generator selected by strategy: "random" (default),
+// "counter" or "obfuscated". KEY_LENGTH sets the length of random keys and the minimum
+// length of obfuscated ones, and KEY_SALT the salt of obfuscated keys.
+func newKeyGenerator(strategy string, counter urlshort.KeyCounter) (urlshort.KeyGenerator, error) {
+	length := urlshort.DefaultKeyLength
+	if l := os.Getenv("KEY_LENGTH"); l != "" {
+		var err error
+		if length, err = strconv.Atoi(l); err != nil {
+			return nil, fmt.Errorf("KEY_LENGTH not numeric: %w", err)
+		}
+	}
+
+	switch strategy {
+	case "", "random":
+		return urlshort.NewRandomKeyGenerator(length), nil
+	case "counter":
+		return urlshort.NewCounterKeyGenerator(counter), nil
+	case "obfuscated":
+		return urlshort.NewObfuscatedKeyGenerator(counter, os.Getenv("KEY_SALT"), length), nil
+	default:
+		return nil, fmt.Errorf("unknown key strategy %q, expected random, counter or obfuscated", strategy)
+	}
+}
+
+// linksHandler dispatches requests for /api/v1/links by method, behind
+// creating links behind guardCreate and listing them behind authenticate. Links
+// are listed only when list is true, which requires requests to be authenticated.
+func linksHandler(storage storage, host string, opts []urlshort.ShortenerOption, authenticate, guardCreate func(http.HandlerFunc) http.HandlerFunc, list bool) http.HandlerFunc {
+	createHandler := guardCreate(urlshort.CreateLinkHandler(storage, host, opts...))
+	if !list {
+		return func(w http.ResponseWriter, r *http.Request) {
+			if r.Method != http.MethodPost {
+				methodNotAllowed(w, r, http.MethodPost)
+				return
+			}
+			createHandler(w, r)
+		}
+	}
+	listHandler := authenticate(urlshort.ListHandler(storage, host))
+	return func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodPost:
+			createHandler(w, r)
+		case http.MethodGet, http.MethodHead:
+			listHandler(w, r)
+		default:
+			methodNotAllowed(w, r, http.MethodGet, http.MethodHead, http.MethodPost)
+		}
+	}
+}
+
+// linkHandler dispatches requests for /api/v1/links/{key} by method, and requests
+// for /api/v1/links/{key}/stats when storage records clicks. Links are updated and
+// deleted only when manage is true, which requires requests to be authenticated.
+func linkHandler(storage storage, host string, manage bool) http.HandlerFunc {
+	getHandler := urlshort.GetLinkHandler(storage, host)
+	deleteHandler := urlshort.DeleteHandler(storage)
+	updateHandler := urlshort.UpdateHandler(storage)
+	existsHandler := urlshort.ExistsHandler(storage)
+	var statsHandler http.HandlerFunc
+	if getter, ok := storage.(urlshort.ClickStatsGetter); ok {
+		statsHandler = urlshort.ClickStatsHandler(getter)
+	}
+	methods := []string{http.MethodGet, http.MethodHead}
+	if manage {
+		methods = append(methods, http.MethodPut, http.MethodDelete)
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		key := strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/v1/links/"), "/")
+		if statsHandler != nil && strings.HasSuffix(key, "/stats") {
+			statsHandler(w, r)
+			return
+		}
+		switch {
+		case r.Method == http.MethodGet:
+			getHandler(w, r)
+		case r.Method == http.MethodHead:
+			existsHandler(w, r)
+		case r.Method == http.MethodDelete && manage:
+			deleteHandler(w, r)
+		case r.Method == http.MethodPut && manage:
+			updateHandler(w, r)
+		default:
+			methodNotAllowed(w, r, methods...)
+		}
+	}
+}
+
+// methodNotAllowed answers requests to a route serving methods, setting the Allow
+// header to them and OPTIONS. OPTIONS requests get 204 No Content and any other
+// method 405 Method Not Allowed in the JSON error format of the API.
+func methodNotAllowed(w http.ResponseWriter, r *http.Request, methods ...string) {
+	w.Header().Set("Allow", strings.Join(append(methods, http.MethodOptions), ", "))
+	if r.Method == http.MethodOptions {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusMethodNotAllowed)
+	fmt.Fprintln(w, `{"error":{"code":"method_not_allowed","message":"Invalid request method"}}`)
+}
+
+func missingUrlMux(pages *urlshort.Pages) *http.ServeMux {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", pages.MissingUrlHandler)
+	return mux
 }
 
-func missingUrlMux() *http.ServeMux {
+func expiredUrlMux(pages *urlshort.Pages) *http.ServeMux {
 	mux := http.NewServeMux()
-	mux.HandleFunc("/", urlshort.MissingUrlHandler)
+	mux.HandleFunc("/", pages.ExpiredUrlHandler)
 	return mux
 }
 
-func invalidUrlMux() *http.ServeMux {
+func invalidUrlMux(pages *urlshort.Pages) *http.ServeMux {
 	mux := http.NewServeMux()
-	mux.HandleFunc("/", urlshort.InvalidUrlHandler)
+	mux.HandleFunc("/", pages.InvalidUrlHandler)
 	return mux
 }
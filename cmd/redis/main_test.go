@@ -0,0 +1,101 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"urlshort"
+	"urlshort/internal/memory"
+)
+
+func TestRateLimitFromEnv(t *testing.T) {
+	tests := map[string]struct {
+		limit    string
+		burst    string
+		expected urlshort.RateLimit
+		err      bool
+	}{
+		"unset":            {expected: urlshort.RateLimit{}},
+		"zero":             {limit: "0", burst: "10", expected: urlshort.RateLimit{}},
+		"per minute":       {limit: "120", expected: urlshort.RateLimit{Name: "create", Rate: 2, Burst: 120}},
+		"with burst":       {limit: "30", burst: "5", expected: urlshort.RateLimit{Name: "create", Rate: 0.5, Burst: 5}},
+		"negative limit":   {limit: "-1", err: true},
+		"invalid limit":    {limit: "fast", err: true},
+		"fractional limit": {limit: "1.5", err: true},
+		"zero burst":       {limit: "30", burst: "0", err: true},
+		"invalid burst":    {limit: "30", burst: "many", err: true},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Setenv("TEST_RATE_LIMIT", tc.limit)
+			t.Setenv("TEST_RATE_BURST", tc.burst)
+			limit, err := rateLimitFromEnv("create", "TEST_RATE_LIMIT", "TEST_RATE_BURST")
+			if (err != nil) != tc.err {
+				t.Fatalf("expected error %v, got %v", tc.err, err)
+			}
+			if limit != tc.expected {
+				t.Errorf("expected %+v, got %+v", tc.expected, limit)
+			}
+		})
+	}
+}
+
+func TestLinkHandlerManage(t *testing.T) {
+	tests := map[string]struct {
+		method   string
+		manage   bool
+		expected int
+	}{
+		"get":                 {method: http.MethodGet, expected: http.StatusOK},
+		"head":                {method: http.MethodHead, expected: http.StatusOK},
+		"update unmanaged":    {method: http.MethodPut, expected: http.StatusMethodNotAllowed},
+		"delete unmanaged":    {method: http.MethodDelete, expected: http.StatusMethodNotAllowed},
+		"update managed":      {method: http.MethodPut, manage: true, expected: http.StatusOK},
+		"delete managed":      {method: http.MethodDelete, manage: true, expected: http.StatusNoContent},
+		"options unmanaged":   {method: http.MethodOptions, expected: http.StatusNoContent},
+		"unsupported managed": {method: http.MethodPatch, manage: true, expected: http.StatusMethodNotAllowed},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			storage := memory.New()
+			if err := storage.Save(context.Background(), urlshort.Link{Key: "my-key", URL: "http://www.google.com"}); err != nil {
+				t.Fatalf("error was not expected but got: %s", err.Error())
+			}
+
+			req := httptest.NewRequest(tc.method, "/api/v1/links/my-key", strings.NewReader(`{"url": "http://www.example.com"}`))
+			w := httptest.NewRecorder()
+			linkHandler(storage, "localhost", tc.manage)(w, req)
+			if w.Code != tc.expected {
+				t.Fatalf("expected status %d, got %d: %s", tc.expected, w.Code, w.Body.String())
+			}
+			if w.Code == http.StatusMethodNotAllowed || tc.method == http.MethodOptions {
+				if allow := w.Header().Get("Allow"); strings.Contains(allow, http.MethodPut) != tc.manage {
+					t.Errorf("unexpected Allow header %q", allow)
+				}
+			}
+		})
+	}
+}
+
+func TestLinksHandlerList(t *testing.T) {
+	identity := func(h http.HandlerFunc) http.HandlerFunc { return h }
+	for name, list := range map[string]bool{"listed": true, "not listed": false} {
+		t.Run(name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/api/v1/links", nil)
+			w := httptest.NewRecorder()
+			linksHandler(memory.New(), "localhost", nil, identity, identity, list)(w, req)
+
+			expected := http.StatusMethodNotAllowed
+			if list {
+				expected = http.StatusOK
+			}
+			if w.Code != expected {
+				t.Fatalf("expected status %d, got %d: %s", expected, w.Code, w.Body.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,42 @@
+package urlshort
+
+import (
+	"context"
+	"net/url"
+	"strings"
+)
+
+// UrlShortDeduplicator defines a contract for types that keep a reverse index from urls
+// to the keys they are stored under, so the same url is not shortened twice.
+type UrlShortDeduplicator interface {
+	// SaveUnique saves link like Save, unless a url with the same NormalizeURL form is still stored
+	// under another key with the same status, query policy, preview and creator, in which case nothing
+	// is saved and the stored link is returned. The url is saved as given, only the index uses NormalizeURL.
+	// Both the link and its reverse index entry expire together.
+	SaveUnique(ctx context.Context, link Link) (Link, error)
+}
+
+// NormalizeURL returns a canonical form of rawURL used to detect duplicates:
+// scheme and host are lowercased, default ports are dropped, an empty path
+// becomes "/" and query parameters are sorted. Urls that can't be parsed
+// are returned unchanged.
+func NormalizeURL(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Host == "" {
+		return rawURL
+	}
+
+	u.Scheme = strings.ToLower(u.Scheme)
+	u.Host = strings.ToLower(u.Host)
+	if port := u.Port(); (u.Scheme == "http" && port == "80") || (u.Scheme == "https" && port == "443") {
+		u.Host = strings.TrimSuffix(u.Host, ":"+port)
+	}
+	if u.Path == "" {
+		u.Path = "/"
+	}
+	if u.RawQuery != "" {
+		u.RawQuery = u.Query().Encode()
+	}
+	u.ForceQuery = false
+	return u.String()
+}
@@ -0,0 +1,111 @@
+package urlshort_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"urlshort"
+)
+
+func TestNormalizeURL(t *testing.T) {
+	tests := map[string]struct {
+		url      string
+		expected string
+	}{
+		"already normalized":   {url: "https://www.google.com/search?q=go", expected: "https://www.google.com/search?q=go"},
+		"uppercase host":       {url: "HTTPS://WWW.Google.com/Search", expected: "https://www.google.com/Search"},
+		"default http port":    {url: "http://google.com:80/a", expected: "http://google.com/a"},
+		"default https port":   {url: "https://google.com:443/a", expected: "https://google.com/a"},
+		"non default port":     {url: "https://google.com:8443/a", expected: "https://google.com:8443/a"},
+		"empty path":           {url: "https://google.com", expected: "https://google.com/"},
+		"unordered query":      {url: "https://google.com/?b=2&a=1", expected: "https://google.com/?a=1&b=2"},
+		"empty query":          {url: "https://google.com/?", expected: "https://google.com/"},
+		"fragment kept":        {url: "https://google.com/docs#intro", expected: "https://google.com/docs#intro"},
+		"relative left as is":  {url: "google.com", expected: "google.com"},
+		"unparseable as is":    {url: "http://[::1", expected: "http://[::1"},
+		"path case preserved":  {url: "https://google.com/CaseSensitive", expected: "https://google.com/CaseSensitive"},
+		"escaped path kept":    {url: "https://google.com/a%2Fb", expected: "https://google.com/a%2Fb"},
+		"same url after trips": {url: "https://Google.com:443?z=1&y=2", expected: "https://google.com/?y=2&z=1"},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			if got := urlshort.NormalizeURL(tc.url); got != tc.expected {
+				t.Errorf("expected %q, got %q", tc.expected, got)
+			}
+		})
+	}
+}
+
+type mockDeduplicator struct {
+	mockSaver
+	index map[string]string
+	saved []string
+}
+
+func (m *mockDeduplicator) SaveUnique(ctx context.Context, link urlshort.Link) (urlshort.Link, error) {
+	m.saved = append(m.saved, link.URL)
+	if existing, ok := m.index[urlshort.NormalizeURL(link.URL)]; ok {
+		return urlshort.Link{Key: existing, URL: link.URL}, nil
+	}
+	m.index[urlshort.NormalizeURL(link.URL)] = link.Key
+	return link, nil
+}
+
+func TestShortenerWithDeduplication(t *testing.T) {
+	saver := &mockDeduplicator{index: make(map[string]string)}
+	handler := urlshort.Shortener(saver, "http://localhost:8080", http.HandlerFunc(statusBadRequestHandlerMock), urlshort.WithDeduplication())
+
+	var shortened []string
+	for _, u := range []string{"http://www.google.com", "HTTP://WWW.GOOGLE.COM:80/"} {
+		req, err := http.NewRequest("POST", "/shorten?url="+u, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rr := httptest.NewRecorder()
+		handler(rr, req)
+		if status := rr.Code; status != http.StatusOK {
+			t.Fatalf("handler returned wrong status code: got %v want %v", status, http.StatusOK)
+		}
+		shortened = append(shortened, rr.Body.String())
+	}
+
+	if len(saver.index) != 1 {
+		t.Fatalf("expected a single link to be stored, got %v", saver.index)
+	}
+	key := saver.index["http://www.google.com/"]
+	if saver.saved[0] != "http://www.google.com" {
+		t.Errorf("expected the url to be saved as submitted, got %q", saver.saved[0])
+	}
+	for _, body := range shortened {
+		if !strings.Contains(body, "http://localhost:8080/short/"+key) {
+			t.Errorf("expected every response to contain the existing short url")
+		}
+	}
+
+	t.Run("alias is not deduplicated", func(t *testing.T) {
+		req, err := http.NewRequest("POST", "/shorten?url=http://www.google.com&alias=google", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rr := httptest.NewRecorder()
+		handler(rr, req)
+		if !strings.Contains(rr.Body.String(), "http://localhost:8080/short/google") {
+			t.Errorf("expected the alias to be used")
+		}
+		if len(saver.saved) != 2 {
+			t.Errorf("expected alias to be saved without deduplication")
+		}
+	})
+}
+
+func TestWithDeduplicationRequiresDeduplicator(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Errorf("expected a panic for a saver without UrlShortDeduplicator")
+		}
+	}()
+	urlshort.Shortener(&mockSaver{}, "http://localhost:8080", http.HandlerFunc(statusBadRequestHandlerMock), urlshort.WithDeduplication())
+}
@@ -0,0 +1,74 @@
+package urlshort
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"time"
+)
+
+// ErrInvalidExpiration is returned when a requested expiration is malformed,
+// in the past or beyond the maximum allowed by WithMaxExpiration.
+var ErrInvalidExpiration = errors.New("invalid expiration")
+
+// WithDefaultExpiration sets how long links created without expires_in or expires_at live.
+// By default they never expire.
+func WithDefaultExpiration(d time.Duration) ShortenerOption {
+	return func(cfg *shortenerConfig) {
+		cfg.defaultExpiration = d
+	}
+}
+
+// WithMaxExpiration bounds how far in the future a link may expire. Requests asking for
+// a later expiration, or for none at all, are rejected with ErrInvalidExpiration.
+// If no default expiration is set links created without one expire after d.
+func WithMaxExpiration(d time.Duration) ShortenerOption {
+	return func(cfg *shortenerConfig) {
+		cfg.maxExpiration = d
+	}
+}
+
+// parseExpiration parses the expires_in, in seconds, and expires_at, in RFC 3339 format,
+// request parameters. Empty parameters are returned as zero values.
+func parseExpiration(expiresIn string, expiresAt string) (time.Duration, time.Time, error) {
+	var in time.Duration
+	if expiresIn != "" {
+		seconds, err := strconv.ParseInt(expiresIn, 10, 64)
+		if err != nil || seconds <= 0 || seconds > math.MaxInt64/int64(time.Second) {
+			return 0, time.Time{}, fmt.Errorf("%w: expires_in must be a positive number of seconds", ErrInvalidExpiration)
+		}
+		in = time.Duration(seconds) * time.Second
+	}
+	var at time.Time
+	if expiresAt != "" {
+		var err error
+		at, err = time.Parse(time.RFC3339, expiresAt)
+		if err != nil {
+			return 0, time.Time{}, fmt.Errorf("%w: expires_at must be in RFC 3339 format", ErrInvalidExpiration)
+		}
+	}
+	return in, at, nil
+}
+
+// expiration returns when a link created at now should expire given the requested
+// expires_in and expires_at, which are zero when missing. The zero time means never.
+func (cfg *shortenerConfig) expiration(now time.Time, expiresIn time.Duration, expiresAt time.Time) (time.Time, error) {
+	if expiresIn != 0 && !expiresAt.IsZero() {
+		return time.Time{}, fmt.Errorf("%w: expires_in and expires_at can not be used together", ErrInvalidExpiration)
+	}
+	switch {
+	case expiresIn != 0:
+		expiresAt = now.Add(expiresIn)
+	case !expiresAt.IsZero():
+		if !expiresAt.After(now) {
+			return time.Time{}, fmt.Errorf("%w: expires_at must be in the future", ErrInvalidExpiration)
+		}
+	case cfg.defaultExpiration > 0:
+		expiresAt = now.Add(cfg.defaultExpiration)
+	}
+	if cfg.maxExpiration > 0 && (expiresAt.IsZero() || expiresAt.After(now.Add(cfg.maxExpiration))) {
+		return time.Time{}, fmt.Errorf("%w: links can not live longer than %s", ErrInvalidExpiration, cfg.maxExpiration)
+	}
+	return expiresAt, nil
+}
@@ -0,0 +1,166 @@
+package urlshort
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// MappingFormat is the encoding of a document of path to url mappings.
+type MappingFormat int
+
+const (
+	// FormatYAML documents are parsed like YAMLHandler does.
+	FormatYAML MappingFormat = iota
+	// FormatJSON documents are parsed like JSONHandler does.
+	FormatJSON
+	// FormatCSV documents are parsed like CSVHandler does.
+	FormatCSV
+	// FormatTOML documents are parsed like TOMLHandler does.
+	FormatTOML
+)
+
+// MappingFile is a document of path to url mappings, such as the contents of
+// a file, in the format expected by YAMLHandler, JSONHandler, CSVHandler or TOMLHandler.
+type MappingFile struct {
+	// Name identifies the document in error messages, usually its file name.
+	Name   string
+	Format MappingFormat
+	Data   []byte
+}
+
+// FilesHandler will parse every file and merge their mappings into a single
+// http.HandlerFunc (which also implements http.Handler) like YAMLHandler and
+// JSONHandler do for a single document.
+//
+// Every entry is validated: it needs a path starting with /, with no * other
+// than a trailing /* and only whole segment {placeholders} (see MapHandler),
+// that isn't mapped by any other entry, in the same file or across files, and
+// an absolute http or https url using no placeholder missing from its path.
+// Its optional status and query policy must be accepted by ValidateRedirectStatus
+// and ValidateQueryPolicy.
+// All the problems found are returned as MappingErrors.
+//
+// See MapHandler to create a similar http.HandlerFunc via
+// a mapping of paths to urls.
+func FilesHandler(files []MappingFile, fallback http.Handler, opts ...MapOption) (http.HandlerFunc, error) {
+	var mappers []uRLMapper
+	for _, file := range files {
+		fileMappers, err := parseMappers(file)
+		if err != nil {
+			if file.Name == "" {
+				return nil, err
+			}
+			return nil, fmt.Errorf("%s: %w", file.Name, err)
+		}
+		mappers = append(mappers, fileMappers...)
+	}
+	redirects, err := buildMap(mappers)
+	if err != nil {
+		return nil, err
+	}
+	return mapHandler(redirects, fallback, newMapConfig(opts)), nil
+}
+
+// parseMappers decodes the entries of file, recording where each one was read from.
+func parseMappers(file MappingFile) ([]uRLMapper, error) {
+	var mappers []uRLMapper
+	var err error
+	switch file.Format {
+	case FormatYAML:
+		var doc yaml.Node
+		if err = yaml.Unmarshal(file.Data, &doc); err == nil && len(doc.Content) > 0 {
+			err = doc.Decode(&mappers)
+		}
+		if err == nil && len(mappers) > 0 {
+			// the document is a sequence holding a node per entry
+			for i, entry := range doc.Content[0].Content {
+				mappers[i].line, mappers[i].column = entry.Line, entry.Column
+			}
+		}
+	case FormatJSON:
+		err = json.Unmarshal(file.Data, &mappers)
+	case FormatCSV:
+		mappers, err = parseCSV(file.Data)
+	case FormatTOML:
+		var doc struct {
+			Mappings []uRLMapper `toml:"mappings"`
+		}
+		_, err = toml.Decode(string(file.Data), &doc)
+		mappers = doc.Mappings
+	default:
+		err = fmt.Errorf("unknown mapping format %d", file.Format)
+	}
+	if err != nil {
+		return nil, err
+	}
+	for i := range mappers {
+		mappers[i].source = file.Name
+		mappers[i].index = i
+	}
+	return mappers, nil
+}
+
+// parseCSV decodes the rows following the header of a CSV document, recording
+// the line each one starts at.
+func parseCSV(data []byte) ([]uRLMapper, error) {
+	r := csv.NewReader(bytes.NewReader(data))
+	r.TrimLeadingSpace = true
+	header, err := r.Read()
+	if errors.Is(err, io.EOF) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	columns := make(map[string]int, len(header))
+	for i, name := range header {
+		// spreadsheets may start UTF-8 files with a byte order mark
+		name = strings.TrimPrefix(name, "\ufeff")
+		columns[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	pathColumn, hasPath := columns["path"]
+	urlColumn, hasURL := columns["url"]
+	if !hasPath || !hasURL {
+		return nil, fmt.Errorf("csv header must name a path and a url column")
+	}
+	statusColumn, hasStatus := columns["status"]
+	queryColumn, hasQuery := columns["query"]
+
+	var mappers []uRLMapper
+	for {
+		record, err := r.Read()
+		if errors.Is(err, io.EOF) {
+			return mappers, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		line, column := r.FieldPos(0)
+		mapper := uRLMapper{
+			Path:   record[pathColumn],
+			URL:    record[urlColumn],
+			line:   line,
+			column: column,
+		}
+		if hasStatus && strings.TrimSpace(record[statusColumn]) != "" {
+			if mapper.Status, err = strconv.Atoi(strings.TrimSpace(record[statusColumn])); err != nil {
+				return nil, fmt.Errorf("record on line %d: status %q is not a number", line, record[statusColumn])
+			}
+		}
+		if hasQuery {
+			mapper.Query = QueryPolicy(strings.TrimSpace(record[queryColumn]))
+		}
+		mappers = append(mappers, mapper)
+	}
+}
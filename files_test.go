@@ -0,0 +1,71 @@
+package urlshort_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"urlshort"
+)
+
+func TestFilesHandler(t *testing.T) {
+	teamA := urlshort.MappingFile{
+		Name:   "team-a.yml",
+		Format: urlshort.FormatYAML,
+		Data: []byte(`
+- path: /urlshort
+  url: https://github.com/gophercises/urlshort
+`),
+	}
+	teamB := urlshort.MappingFile{
+		Name:   "team-b.json",
+		Format: urlshort.FormatJSON,
+		Data:   []byte(`[{"path": "/urlshort-final", "url": "https://github.com/gophercises/urlshort/tree/solution"}]`),
+	}
+
+	tests := map[string]struct {
+		files      []urlshort.MappingFile
+		errMessage string
+	}{
+		"merged files": {
+			files: []urlshort.MappingFile{teamA, teamB},
+		},
+		"duplicate across files": {
+			files:      []urlshort.MappingFile{teamA, teamB, {Name: "team-c.json", Format: urlshort.FormatJSON, Data: []byte(`[{"path": "/urlshort", "url": "https://www.example.com"}]`)}},
+			errMessage: `team-c.json[0]: repeated path: "/urlshort" is already mapped to https://github.com/gophercises/urlshort by team-a.yml[0] (line 2, column 3)`,
+		},
+		"invalid file": {
+			files:      []urlshort.MappingFile{teamA, {Name: "team-c.json", Format: urlshort.FormatJSON, Data: []byte(`[{"path": `)}},
+			errMessage: "team-c.json: unexpected end of JSON input",
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			handler, err := urlshort.FilesHandler(tc.files, http.HandlerFunc(statusBadRequestHandlerMock))
+			if tc.errMessage != "" {
+				if err == nil || err.Error() != tc.errMessage {
+					t.Fatalf("expected error %q but got: %v", tc.errMessage, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("error was not expected but got: %s", err.Error())
+			}
+			for _, path := range []string{"/urlshort", "/urlshort-final"} {
+				req, err := http.NewRequest("GET", path, nil)
+				if err != nil {
+					t.Fatal(err)
+				}
+				rr := httptest.NewRecorder()
+				handler(rr, req)
+				if status := rr.Code; status != http.StatusMovedPermanently {
+					t.Errorf("handler returned wrong status code: got %v want %v", status, http.StatusMovedPermanently)
+				}
+				if location := rr.Header().Get("Location"); !strings.HasPrefix(location, "https://github.com/gophercises/urlshort") {
+					t.Errorf("handler redirected to unexpected url %s", location)
+				}
+			}
+		})
+	}
+}
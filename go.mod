@@ -2,9 +2,14 @@ module urlshort
 
 go 1.21.3
 
+require (
+	github.com/BurntSushi/toml v1.4.0
+	github.com/redis/go-redis/v9 v9.3.1
+	github.com/skip2/go-qrcode v0.0.0-20200617195104-da1b6568686e
+	gopkg.in/yaml.v3 v3.0.1
+)
+
 require (
 	github.com/cespare/xxhash/v2 v2.2.0 // indirect
 	github.com/dgryski/go-rendezvous v0.0.0-20200823014737-9f7001d12a5f // indirect
-	github.com/redis/go-redis/v9 v9.3.1 // indirect
-	gopkg.in/yaml.v3 v3.0.1 // indirect
 )
@@ -3,17 +3,13 @@ package urlshort
 
 import (
 	"context"
-	"encoding/json"
 	"errors"
 	"fmt"
-	"html/template"
-	"math/rand"
+	"log"
 	"net/http"
 	"net/url"
 	"strings"
 	"time"
-
-	"gopkg.in/yaml.v3"
 )
 
 // MapHandler will return an http.HandlerFunc (which also
@@ -22,23 +18,117 @@ import (
 // that each key in the map points to, in string format).
 // If the path is not provided in the map, then the fallback
 // http.Handler will be called instead.
-func MapHandler(pathsToUrls map[string]string, fallback http.Handler) http.HandlerFunc {
+//
+// Paths ending in /* map every path below them, such as /docs/* for
+// /docs and /docs/anything, and redirect with the rest of the request
+// path appended to the URL, so /docs/* pointing to
+// https://docs.example.com redirects /docs/anything to
+// https://docs.example.com/anything. Exact paths take precedence and
+// otherwise the longest matching prefix wins.
+//
+// Path segments can also be named {placeholders}, such as
+// /gh/{owner}/{repo}, matching any non empty segment, and their values
+// are substituted, URL-escaped, for the same placeholders in the URL,
+// so /gh/{owner}/{repo} pointing to https://github.com/{owner}/{repo}
+// redirects /gh/gophercises/urlshort to
+// https://github.com/gophercises/urlshort. Exact paths take precedence
+// over templates, and templates over prefixes. Among templates, literal
+// segments are preferred to placeholders.
+//
+// Redirects are sent with DefaultRedirectStatus unless WithMapRedirectStatus
+// is given, and the query of the request is dropped, see QueryPolicy, unless
+// WithMapQueryPolicy is given.
+//
+// HEAD requests are redirected like GET requests. OPTIONS requests are
+// answered with 204 No Content and any other method with 405 Method Not
+// Allowed, both listing the methods served in the Allow header.
+func MapHandler(pathsToUrls map[string]string, fallback http.Handler, opts ...MapOption) http.HandlerFunc {
+	redirects := make(map[string]redirect, len(pathsToUrls))
+	for path, url := range pathsToUrls {
+		redirects[path] = redirect{url: url}
+	}
+	return mapHandler(redirects, fallback, newMapConfig(opts))
+}
+
+// redirect is where a mapping sends requests to, with which status and what
+// happens to their query, the zero values standing for the default ones.
+type redirect struct {
+	url    string
+	status int
+	query  QueryPolicy
+}
+
+func mapHandler(redirects map[string]redirect, fallback http.Handler, cfg *mapConfig) http.HandlerFunc {
+	exact := make(map[string]redirect, len(redirects))
+	templates := &templateTree{}
+	prefixes := &radixTree[redirect]{}
+	for path, target := range redirects {
+		target.status = redirectStatus(target.status, cfg.status)
+		target.query = queryPolicy(target.query, cfg.query)
+		if prefix, ok := strings.CutSuffix(path, "/*"); ok {
+			prefixes.insert(prefix, target)
+			continue
+		}
+		if isTemplate(path) {
+			templates.insert(path, target)
+			continue
+		}
+		exact[path] = target
+	}
+
 	return func(w http.ResponseWriter, r *http.Request) {
-		if r.Method != http.MethodGet {
-			http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+		if !allowMethods(w, r, methodNotAllowed, http.MethodGet, http.MethodHead) {
 			return
 		}
-		if redirectUrl, ok := pathsToUrls[strings.TrimRight(r.URL.Path, "/ ")]; ok {
-			http.Redirect(w, r, redirectUrl, http.StatusMovedPermanently)
+		path := strings.TrimRight(r.URL.Path, "/ ")
+		if target, ok := exact[path]; ok {
+			http.Redirect(w, r, mergeQuery(target.url, r.URL.RawQuery, target.query), target.status)
+			return
+		}
+		if target, ok := templates.match(path); ok {
+			http.Redirect(w, r, mergeQuery(target.url, r.URL.RawQuery, target.query), target.status)
+			return
+		}
+		if target, n, ok := prefixes.longestPrefix(r.URL.Path); ok {
+			http.Redirect(w, r, mergeQuery(appendPath(target.url, r.URL.Path[n:]), r.URL.RawQuery, target.query), target.status)
 			return
 		}
 		fallback.ServeHTTP(w, r)
 	}
 }
 
+// appendPath appends rest to the path of rawURL, keeping its query and fragment.
+func appendPath(rawURL, rest string) string {
+	if rest == "" {
+		return rawURL
+	}
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return strings.TrimSuffix(rawURL, "/") + rest
+	}
+	u.Path = strings.TrimSuffix(u.Path, "/") + rest
+	u.RawPath = ""
+	return u.String()
+}
+
 type uRLMapper struct {
-	Path string `yaml:"path" json:"path"`
-	URL  string `yaml:"url" json:"url"`
+	Path string `yaml:"path" json:"path" toml:"path"`
+	URL  string `yaml:"url" json:"url" toml:"url"`
+	// Status is the status of the redirect, 0 for the default one, see MapHandler.
+	Status int `yaml:"status" json:"status" toml:"status"`
+	// Query is what happens to the query of requests, empty for the default, see MapHandler.
+	Query QueryPolicy `yaml:"query" json:"query" toml:"query"`
+
+	// source, index, line and column locate the entry for error messages, see
+	// MappingError.
+	source string
+	index  int
+	line   int
+	column int
+}
+
+func (m uRLMapper) location() string {
+	return formatLocation(m.source, m.index, m.line, m.column)
 }
 
 // YAMLHandler will parse the provided YAML and then return
@@ -52,22 +142,17 @@ type uRLMapper struct {
 //   - path: /some-path
 //     url: https://www.some-url.com/demo
 //
-// The only errors that can be returned all related to having
-// invalid YAML data.
+// An entry can choose the status of its redirect, see ValidateRedirectStatus,
+// with a status field such as status: 302, and what happens to the query of
+// requests, see QueryPolicy, with a query field such as query: append.
+//
+// Errors are returned for invalid YAML data and, as MappingErrors,
+// for entries that don't validate, see FilesHandler.
 //
 // See MapHandler to create a similar http.HandlerFunc via
 // a mapping of paths to urls.
-func YAMLHandler(yml []byte, fallback http.Handler) (http.HandlerFunc, error) {
-	var mappers []uRLMapper
-	err := yaml.Unmarshal(yml, &mappers)
-	if err != nil {
-		return nil, err
-	}
-	pathMap, err := buildMap(mappers)
-	if err != nil {
-		return nil, err
-	}
-	return MapHandler(pathMap, fallback), nil
+func YAMLHandler(yml []byte, fallback http.Handler, opts ...MapOption) (http.HandlerFunc, error) {
+	return FilesHandler([]MappingFile{{Format: FormatYAML, Data: yml}}, fallback, opts...)
 }
 
 // JSONHandler will parse the provided JSON and then return
@@ -91,52 +176,143 @@ func YAMLHandler(yml []byte, fallback http.Handler) (http.HandlerFunc, error) {
 //
 // ]
 //
-// The only errors that can be returned all related to having
-// invalid YAML data.
+// Errors are returned for invalid JSON data and, as MappingErrors,
+// for entries that don't validate, see FilesHandler.
 //
 // See MapHandler to create a similar http.HandlerFunc via
 // a mapping of paths to urls.
-func JSONHandler(data []byte, fallback http.Handler) (http.HandlerFunc, error) {
-	var mappers []uRLMapper
-	err := json.Unmarshal(data, &mappers)
-	if err != nil {
-		return nil, err
-	}
-	pathMap, err := buildMap(mappers)
-	if err != nil {
-		return nil, err
-	}
-	return MapHandler(pathMap, fallback), nil
+func JSONHandler(data []byte, fallback http.Handler, opts ...MapOption) (http.HandlerFunc, error) {
+	return FilesHandler([]MappingFile{{Format: FormatJSON, Data: data}}, fallback, opts...)
+}
+
+// CSVHandler will parse the provided CSV and then return
+// an http.HandlerFunc (which also implements http.Handler)
+// that will attempt to map any paths to their corresponding
+// URL. If the path is not provided in the CSV, then the
+// fallback http.Handler will be called instead.
+//
+// CSV is expected to start with a header naming its columns,
+// path and url being required, status and query optional and any other ignored:
+//
+//	path,url
+//	/urlshort,https://github.com/gophercises/urlshort
+//	/urlshort-final,https://github.com/gophercises/urlshort/tree/solution
+//
+// Errors are returned for invalid CSV data and, as MappingErrors,
+// for entries that don't validate, see FilesHandler.
+//
+// See MapHandler to create a similar http.HandlerFunc via
+// a mapping of paths to urls.
+func CSVHandler(data []byte, fallback http.Handler, opts ...MapOption) (http.HandlerFunc, error) {
+	return FilesHandler([]MappingFile{{Format: FormatCSV, Data: data}}, fallback, opts...)
+}
+
+// TOMLHandler will parse the provided TOML and then return
+// an http.HandlerFunc (which also implements http.Handler)
+// that will attempt to map any paths to their corresponding
+// URL. If the path is not provided in the TOML, then the
+// fallback http.Handler will be called instead.
+//
+// TOML is expected to be in the format:
+//
+//	[[mappings]]
+//	path = "/urlshort"
+//	url = "https://github.com/gophercises/urlshort"
+//
+//	[[mappings]]
+//	path = "/urlshort-final"
+//	url = "https://github.com/gophercises/urlshort/tree/solution"
+//
+// Errors are returned for invalid TOML data and, as MappingErrors,
+// for entries that don't validate, see FilesHandler.
+//
+// See MapHandler to create a similar http.HandlerFunc via
+// a mapping of paths to urls.
+func TOMLHandler(data []byte, fallback http.Handler, opts ...MapOption) (http.HandlerFunc, error) {
+	return FilesHandler([]MappingFile{{Format: FormatTOML, Data: data}}, fallback, opts...)
 }
 
-func buildMap(mappers []uRLMapper) (map[string]string, error) {
-	mapOutput := make(map[string]string)
-	var ok bool
+// buildMap validates every entry and returns their mappings, or MappingErrors
+// with all the problems found.
+func buildMap(mappers []uRLMapper) (map[string]redirect, error) {
+	mapOutput := make(map[string]redirect)
+	seen := make(map[string]uRLMapper)
+	var errs MappingErrors
 	for _, mapper := range mappers {
-		if _, ok = mapOutput[mapper.Path]; ok {
-			return nil, fmt.Errorf("repeated path")
+		if problems := mapper.validate(); len(problems) > 0 {
+			errs = append(errs, problems...)
+			continue
+		}
+		key := templateKey(mapper.Path)
+		if previous, ok := seen[key]; ok {
+			errs = append(errs, mapper.mappingError(ErrRepeatedPath, fmt.Sprintf("%q is already mapped to %s by %s",
+				mapper.Path, previous.URL, previous.location())))
+			continue
 		}
-		mapOutput[mapper.Path] = mapper.URL
+		seen[key] = mapper
+		mapOutput[mapper.Path] = redirect{url: mapper.URL, status: mapper.Status, query: mapper.Query}
+	}
+	if len(errs) > 0 {
+		return nil, errs
 	}
 	return mapOutput, nil
 }
 
+// Link is a shortened URL: the key it is reached by and the url it redirects to.
+type Link struct {
+	Key string
+	URL string
+	// Status is the status of redirects to the link, 0 for the default one of
+	// RetrieveHandler, see ValidateRedirectStatus.
+	Status int
+	// Query is what happens to the query of requests redirected to the link,
+	// empty for the default policy of RetrieveHandler.
+	Query QueryPolicy
+	// Preview makes RetrieveHandler show the preview page of the link instead of
+	// redirecting, see WithPreview.
+	Preview bool
+	// ExpiresAt is the moment the link stops redirecting, the zero time means it never expires.
+	ExpiresAt time.Time
+	// CreatedAt is the moment the link was created, the zero time when it is unknown.
+	CreatedAt time.Time
+	// CreatedBy is the ID of the APIKey the link was created with, see RequireAPIKey,
+	// empty when it was created without one.
+	CreatedBy string
+}
+
+// ExpiredRetention is how long storages should remember a key after it expired, so
+// that requests for it are answered with ErrExpiredKey rather than ErrMissingKey.
+const ExpiredRetention = 7 * 24 * time.Hour
+
 // UrlShortSaver defines a contract for types that know how to save a shortened URL key.
-// Types implementing this interface must provide a Save method that takes a string representing the key
+// Types implementing this interface must provide a Save method that takes a Link
 // and returns an error if the operation fails.
 type UrlShortSaver interface {
-	// Save is a method that takes a string key representing the URL to be saved.
-	// It attempts to save the key and returns an error if the operation fails.
-	Save(ctx context.Context, key string, url string) error
+	// Save is a method that takes a Link with the key and the URL to be saved.
+	// It attempts to save the link, expiring it at its ExpiresAt, and returns an error if the operation fails.
+	// If the key is already in use it must return ErrKeyExists and leave the stored url untouched.
+	Save(ctx context.Context, link Link) error
 }
 
+var ErrKeyExists = errors.New("key already exists")
+
 // Shortener generates an HTTP handler that accepts POST requests containing a URL.
-// It then generates a shortened key for the provided URL and saves it using the provided saver.
-// The generated shortened URL is displayed in the HTML response along with the original URL.
-func Shortener(saver UrlShortSaver, host string, fallback http.Handler) http.HandlerFunc {
+// It then generates a shortened key for the provided URL, see WithKeyGenerator, and saves it using the provided saver.
+// An optional alias parameter is used as the key instead, see ValidateAlias; if it is already
+// taken the request fails with 409 Conflict.
+// The link expires after the optional expires_in parameter, in seconds, or at the optional
+// expires_at parameter, in RFC 3339 format, see WithDefaultExpiration and WithMaxExpiration.
+// The optional status parameter chooses the status of its redirects, see ValidateRedirectStatus,
+// and the optional query parameter what happens to the query of requests, see QueryPolicy.
+// A true preview parameter makes the link always show its preview page, see WithPreview.
+// The generated shortened URL is displayed in the HTML response along with the original URL
+// and its QR code, see WithPages and QRCodeHandler.
+// OPTIONS requests are answered with 204 No Content and other methods with 405 Method Not Allowed,
+// both listing POST and OPTIONS in the Allow header.
+func Shortener(saver UrlShortSaver, host string, fallback http.Handler, opts ...ShortenerOption) http.HandlerFunc {
+	cfg := newShortenerConfig(saver, opts)
 	return func(w http.ResponseWriter, r *http.Request) {
-		if r.Method != http.MethodPost {
-			http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+		if !allowMethods(w, r, methodNotAllowed, http.MethodPost) {
 			return
 		}
 
@@ -152,68 +328,140 @@ func Shortener(saver UrlShortSaver, host string, fallback http.Handler) http.Han
 			return
 		}
 
-		shortKey := generateShortKey()
-		if err = saver.Save(r.Context(), shortKey, originalURL); err != nil {
-			http.Error(w, fmt.Sprintf("error saving short url"), http.StatusInternalServerError)
+		now := time.Now()
+		expiresIn, expiresAt, err := parseExpiration(r.FormValue("expires_in"), r.FormValue("expires_at"))
+		if err == nil {
+			expiresAt, err = cfg.expiration(now, expiresIn, expiresAt)
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		status, err := parseRedirectStatus(r.FormValue("status"))
+		if err == nil {
+			err = ValidateQueryPolicy(QueryPolicy(r.FormValue("query")))
+		}
+		var preview bool
+		if err == nil {
+			preview, err = parsePreview(r.FormValue("preview"))
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
 			return
 		}
 
-		shortenedURL := fmt.Sprintf("%s/short/%s", host, shortKey)
-
-		tmpl, err := template.ParseFiles("html/shorten.html")
+		link, err := saveShortKey(r.Context(), saver, cfg, r.FormValue("alias"), Link{
+			URL:       originalURL,
+			ExpiresAt: expiresAt,
+			Status:    status,
+			Query:     QueryPolicy(r.FormValue("query")),
+			Preview:   preview,
+			CreatedAt: now,
+			CreatedBy: createdBy(r.Context()),
+		})
+		if errors.Is(err, ErrInvalidAlias) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if errors.Is(err, ErrAliasTaken) {
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		}
+		if errors.Is(err, ErrKeyExists) {
+			http.Error(w, "could not generate a unique short key", http.StatusInternalServerError)
+			return
+		}
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			http.Error(w, "error saving short url", http.StatusInternalServerError)
 			return
 		}
 
-		if err = tmpl.Execute(w, struct {
+		shortenedURL := fmt.Sprintf("%s/short/%s", host, link.Key)
+
+		execute(w, cfg.pages.shorten, struct {
 			OriginalUrl string
 			ShortUrl    string
+			QRCodeUrl   string
+			ExpiresAt   time.Time
 		}{
 			OriginalUrl: originalURL,
 			ShortUrl:    shortenedURL,
-		}); err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
-			return
-		}
+			QRCodeUrl:   shortenedURL + qrSuffix,
+			ExpiresAt:   link.ExpiresAt,
+		})
 	}
 }
 
-func generateShortKey() string {
-	const charset = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
-	const keyLength = 6
+// maxSaveAttempts bounds how many generated keys are tried when the saver
+// reports ErrKeyExists before giving up.
+const maxSaveAttempts = 5
 
-	source := rand.NewSource(time.Now().UnixNano())
-	rng := rand.New(source)
-	shortKey := make([]byte, keyLength)
-	for i := range shortKey {
-		shortKey[i] = charset[rng.Intn(len(charset))]
+// saveWithRetry calls save with link under a freshly generated key, generating
+// a new one each time save reports the key is already taken. save returns the
+// link as it ended up stored.
+func saveWithRetry(ctx context.Context, generator KeyGenerator, link Link, save func(link Link) (Link, error)) (Link, error) {
+	var err error
+	for i := 0; i < maxSaveAttempts; i++ {
+		link.Key, err = generator.GenerateKey(ctx)
+		if err != nil {
+			return Link{}, err
+		}
+		var saved Link
+		saved, err = save(link)
+		if err == nil {
+			return saved, nil
+		}
+		if !errors.Is(err, ErrKeyExists) {
+			return Link{}, err
+		}
 	}
-	return string(shortKey)
+	return Link{}, fmt.Errorf("%d attempts: %w", maxSaveAttempts, err)
 }
 
 // UrlShortGetter defines a contract for types that know how to redirect a shortened URL key.
 // Types implementing this interface must provide a Get method that takes a string representing the key
-// and returns the url to which some request must be redirected.
+// and returns the Link holding the url to which some request must be redirected.
 type UrlShortGetter interface {
-	// Get is a method that takes a string key representing the shortened URL and returns the original url
-	// to which some request must be redirected
-	Get(ctx context.Context, key string) (string, error)
+	// Get is a method that takes a string key representing the shortened URL and returns the Link
+	// with the original url to which some request must be redirected. It returns ErrMissingKey
+	// if the key does not exist and ErrExpiredKey if it expired within ExpiredRetention.
+	Get(ctx context.Context, key string) (Link, error)
 }
 
-var ErrMissingKey = errors.New("key not found")
+var (
+	ErrMissingKey = errors.New("key not found")
+	ErrExpiredKey = errors.New("key expired")
+)
 
 // RetrieveHandler will return an http.HandlerFunc (which also
 // implements http.Handler) that will attempt to redirect any
 // paths (keys) to their corresponding URL (values
 // that UrlShortGetter retrieves, in string format).
 // If the key is not found by getter, then the fallback
-// http.Handler will be called instead.
+// http.Handler will be called instead. Expired keys are handled
+// by the fallback too unless WithExpiredHandler is given, and
+// redirects are recorded when WithClickRecorder is given.
+// Redirects are sent with the status of the link or, when it has
+// none, DefaultRedirectStatus unless WithRedirectStatus is given.
+// The query of the request is combined with the url according to
+// the QueryPolicy of the link or, when it has none, dropped unless
+// WithQueryPolicy is given. Previews are shown instead of redirecting
+// when WithPreview is given, and QR codes when WithQRCode is given.
+// HEAD requests are redirected too but never recorded as clicks, and OPTIONS
+// and other methods are answered like MapHandler does.
 // Handler must be attached to route /anypath/{key} or it won't work properly
-func RetrieveHandler(getter UrlShortGetter, fallback http.Handler) http.HandlerFunc {
+func RetrieveHandler(getter UrlShortGetter, fallback http.Handler, opts ...RetrieveOption) http.HandlerFunc {
+	cfg := newRetrieveConfig(fallback, opts)
 	return func(w http.ResponseWriter, r *http.Request) {
-		if r.Method != http.MethodGet {
-			http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+		if !allowMethods(w, r, methodNotAllowed, http.MethodGet, http.MethodHead) {
+			return
+		}
+		if cfg.qr != nil && isQRCodeRequest(r) {
+			cfg.qr.ServeHTTP(w, r)
+			return
+		}
+		if cfg.preview != nil && isPreviewRequest(r) {
+			cfg.preview.ServeHTTP(w, r)
 			return
 		}
 		paths := strings.SplitN(strings.Trim(r.URL.Path, "/ "), "/", 2)
@@ -221,60 +469,50 @@ func RetrieveHandler(getter UrlShortGetter, fallback http.Handler) http.HandlerF
 			http.NotFound(w, r)
 			return
 		}
-		redirectUrl, err := getter.Get(r.Context(), paths[1])
+		link, err := getter.Get(r.Context(), paths[1])
 		if errors.Is(err, ErrMissingKey) {
 			fallback.ServeHTTP(w, r)
 			return
 		}
+		if errors.Is(err, ErrExpiredKey) {
+			cfg.expired.ServeHTTP(w, r)
+			return
+		}
 		if err != nil {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
-		http.Redirect(w, r, redirectUrl, http.StatusMovedPermanently)
+		if link.Preview && cfg.preview != nil {
+			cfg.preview.ServeHTTP(w, r)
+			return
+		}
+		if cfg.recorder != nil && r.Method != http.MethodHead {
+			if err = cfg.recorder.RecordClick(r.Context(), newClick(r, paths[1], time.Now(), cfg)); err != nil {
+				log.Printf("urlshort: recording click of %s: %v", paths[1], err)
+			}
+		}
+		destination := mergeQuery(link.URL, r.URL.RawQuery, queryPolicy(link.Query, cfg.query))
+		http.Redirect(w, r, destination, redirectStatus(link.Status, cfg.status))
 	}
 }
 
-// ShortenerHome returns home page for shortener website
+// ShortenerHome returns home page for shortener website to GET and HEAD requests,
+// answering OPTIONS and other methods like MapHandler does
 func ShortenerHome(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodGet {
-		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
-		return
-	}
-
-	tmpl, err := template.ParseFiles("html/home.html")
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
-	}
+	defaultPages.ShortenerHome(w, r)
+}
 
-	if err = tmpl.Execute(w, nil); err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
-	}
+// ExpiredUrlHandler returns page when key expired
+func ExpiredUrlHandler(w http.ResponseWriter, r *http.Request) {
+	defaultPages.ExpiredUrlHandler(w, r)
 }
 
 // MissingUrlHandler returns page when key not found
 func MissingUrlHandler(w http.ResponseWriter, r *http.Request) {
-	tmpl, err := template.ParseFiles("html/fallback.html")
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
-	}
-	if err = tmpl.Execute(w, nil); err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
-	}
+	defaultPages.MissingUrlHandler(w, r)
 }
 
 // InvalidUrlHandler returns page when url not valid
 func InvalidUrlHandler(w http.ResponseWriter, r *http.Request) {
-	tmpl, err := template.ParseFiles("html/error.html")
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
-	}
-	if err = tmpl.Execute(w, nil); err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
-	}
+	defaultPages.InvalidUrlHandler(w, r)
 }
@@ -8,6 +8,7 @@ import (
 	"net/http/httptest"
 	"strings"
 	"testing"
+	"time"
 	"urlshort"
 )
 
@@ -88,6 +89,113 @@ func TestMapHandler(t *testing.T) {
 	})
 }
 
+func TestMapHandlerPrefixes(t *testing.T) {
+	pathsToUrls := map[string]string{
+		"/docs/*":      "https://docs.example.com",
+		"/docs/api/*":  "https://api.example.com/reference/?lang=en",
+		"/docs/api/v1": "https://api.example.com/v1",
+		"/search/*":    "https://www.example.com/search/",
+	}
+	for i := 0; i < 1000; i++ {
+		pathsToUrls[fmt.Sprintf("/team-%d/*", i)] = fmt.Sprintf("https://team-%d.example.com", i)
+	}
+
+	tests := map[string]struct {
+		requestPath string
+		location    string
+	}{
+		"prefix itself":            {requestPath: "/docs", location: "https://docs.example.com"},
+		"prefix with slash":        {requestPath: "/docs/", location: "https://docs.example.com/"},
+		"path below prefix":        {requestPath: "/docs/guide/intro", location: "https://docs.example.com/guide/intro"},
+		"longest prefix wins":      {requestPath: "/docs/api/v2/users", location: "https://api.example.com/reference/v2/users?lang=en"},
+		"exact path wins":          {requestPath: "/docs/api/v1", location: "https://api.example.com/v1"},
+		"trailing slash in url":    {requestPath: "/search/cats", location: "https://www.example.com/search/cats"},
+		"prefix of a segment only": {requestPath: "/documents", location: ""},
+		"one of many prefixes":     {requestPath: "/team-123/roadmap", location: "https://team-123.example.com/roadmap"},
+		"not mapped path":          {requestPath: "/team-1000/roadmap", location: ""},
+	}
+
+	handler := urlshort.MapHandler(pathsToUrls, http.HandlerFunc(statusBadRequestHandlerMock))
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			req, err := http.NewRequest("GET", tc.requestPath, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			rr := httptest.NewRecorder()
+			handler(rr, req)
+			if tc.location == "" {
+				if status := rr.Code; status != http.StatusBadRequest {
+					t.Errorf("handler returned wrong status code: got %v want %v", status, http.StatusBadRequest)
+				}
+				return
+			}
+			if status := rr.Code; status != http.StatusMovedPermanently {
+				t.Errorf("handler returned wrong status code: got %v want %v", status, http.StatusMovedPermanently)
+			}
+			if location := rr.Header().Get("Location"); location != tc.location {
+				t.Errorf("handler redirected to wrong url: got %v want %v", location, tc.location)
+			}
+		})
+	}
+
+	t.Run("catch all", func(t *testing.T) {
+		handler := urlshort.MapHandler(map[string]string{"/*": "https://www.example.com"}, http.HandlerFunc(statusBadRequestHandlerMock))
+		req, err := http.NewRequest("GET", "/anything/else", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rr := httptest.NewRecorder()
+		handler(rr, req)
+		if location := rr.Header().Get("Location"); location != "https://www.example.com/anything/else" {
+			t.Errorf("handler redirected to wrong url: got %v", location)
+		}
+	})
+}
+
+func TestMapHandlerTemplates(t *testing.T) {
+	pathsToUrls := map[string]string{
+		"/gh/{owner}/{repo}":     "https://github.com/{owner}/{repo}",
+		"/gh/{owner}/stars":      "https://github.com/{owner}?tab=stars",
+		"/gh/gophercises/{repo}": "https://github.com/gophercises/{repo}/tree/solution",
+		"/search/{term}":         "https://www.example.com/search?q={term}&lang=en",
+		"/team/{team}":           "https://{team}.example.com",
+		"/gh/*":                  "https://github.com",
+	}
+
+	tests := map[string]struct {
+		requestPath string
+		location    string
+	}{
+		"placeholders":              {requestPath: "/gh/juancasz/urlshort", location: "https://github.com/juancasz/urlshort"},
+		"trailing slash":            {requestPath: "/gh/juancasz/urlshort/", location: "https://github.com/juancasz/urlshort"},
+		"literal segment wins":      {requestPath: "/gh/juancasz/stars", location: "https://github.com/juancasz?tab=stars"},
+		"literal earlier segment":   {requestPath: "/gh/gophercises/urlshort", location: "https://github.com/gophercises/urlshort/tree/solution"},
+		"path escaped value":        {requestPath: "/gh/some%20one/repo%3F", location: "https://github.com/some%20one/repo%3F"},
+		"query escaped value":       {requestPath: "/search/cats%20&%20dogs", location: "https://www.example.com/search?q=cats+%26+dogs&lang=en"},
+		"placeholder in host":       {requestPath: "/team/ops", location: "https://ops.example.com"},
+		"templates before prefixes": {requestPath: "/gh/juancasz/urlshort/issues", location: "https://github.com/juancasz/urlshort/issues"},
+		"prefix when no template":   {requestPath: "/gh/juancasz", location: "https://github.com/juancasz"},
+		"placeholders aren't empty": {requestPath: "/search/", location: ""},
+		"not mapped path":           {requestPath: "/search/cats/dogs", location: ""},
+	}
+
+	handler := urlshort.MapHandler(pathsToUrls, http.HandlerFunc(statusBadRequestHandlerMock))
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			req, err := http.NewRequest("GET", tc.requestPath, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			rr := httptest.NewRecorder()
+			handler(rr, req)
+			if location := rr.Header().Get("Location"); location != tc.location {
+				t.Errorf("handler redirected to wrong url: got %v want %v", location, tc.location)
+			}
+		})
+	}
+}
+
 func TestYAMLHandler(t *testing.T) {
 	mux := http.NewServeMux()
 	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
@@ -184,20 +292,174 @@ func TestJSONHandler(t *testing.T) {
 
 type mockSaver struct{}
 
-func (m *mockSaver) Save(ctx context.Context, key string, url string) error {
+func (m *mockSaver) Save(ctx context.Context, link urlshort.Link) error {
 	return nil
 }
 
 type mockSaverError struct{}
 
-func (m *mockSaverError) Save(ctx context.Context, key string, url string) error {
+func (m *mockSaverError) Save(ctx context.Context, link urlshort.Link) error {
 	return fmt.Errorf("something happened")
 }
 
+type mockSaverCollision struct {
+	collisions int
+	keys       []string
+	link       urlshort.Link
+}
+
+func (m *mockSaverCollision) Save(ctx context.Context, link urlshort.Link) error {
+	m.keys = append(m.keys, link.Key)
+	m.link = link
+	if len(m.keys) <= m.collisions {
+		return urlshort.ErrKeyExists
+	}
+	return nil
+}
+
 func statusBadRequestHandlerMock(w http.ResponseWriter, r *http.Request) {
 	http.Error(w, "Bad Request", http.StatusBadRequest)
 }
 
+func statusGoneHandlerMock(w http.ResponseWriter, r *http.Request) {
+	http.Error(w, "Gone", http.StatusGone)
+}
+
+func TestCSVHandler(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, "Hello, world!")
+	})
+
+	tests := map[string]struct {
+		csv                []byte
+		fallback           http.Handler
+		requestPath        string
+		expectedStatusCode int
+		expectedError      bool
+	}{
+		"correct handler": {
+			csv: []byte(`path,url
+/urlshort,https://github.com/gophercises/urlshort
+/urlshort-final,https://github.com/gophercises/urlshort/tree/solution
+`),
+			fallback:           mux,
+			requestPath:        "/urlshort-final",
+			expectedStatusCode: 301,
+		},
+		"reordered and extra columns": {
+			csv:                []byte("\ufeffURL, owner, Path\nhttps://github.com/gophercises/urlshort,ops,/urlshort\n"),
+			fallback:           mux,
+			requestPath:        "/urlshort",
+			expectedStatusCode: 301,
+		},
+		"status column": {
+			csv:                []byte("path,url,status\n/urlshort,https://github.com/gophercises/urlshort,302\n/other,https://www.example.com,\n"),
+			fallback:           mux,
+			requestPath:        "/urlshort",
+			expectedStatusCode: 302,
+		},
+		"empty status": {
+			csv:                []byte("path,url,status\n/urlshort,https://github.com/gophercises/urlshort,302\n/other,https://www.example.com,\n"),
+			fallback:           mux,
+			requestPath:        "/other",
+			expectedStatusCode: 301,
+		},
+		"status not a number": {
+			csv:           []byte("path,url,status\n/urlshort,https://github.com/gophercises/urlshort,found\n"),
+			fallback:      mux,
+			expectedError: true,
+		},
+		"missing url column": {
+			csv:           []byte("path,destination\n/urlshort,https://github.com/gophercises/urlshort\n"),
+			fallback:      mux,
+			expectedError: true,
+		},
+		"wrong number of fields": {
+			csv:           []byte("path,url\n/urlshort\n"),
+			fallback:      mux,
+			expectedError: true,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			handler, err := urlshort.CSVHandler(tc.csv, tc.fallback)
+			if (err != nil) != tc.expectedError {
+				t.Fatalf("expected error: %v, got: %v", tc.expectedError, err)
+			}
+			if err != nil {
+				return
+			}
+			req, err := http.NewRequest("GET", tc.requestPath, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			rr := httptest.NewRecorder()
+			handler(rr, req)
+			if status := rr.Code; status != tc.expectedStatusCode {
+				t.Errorf("handler returned wrong status code: got %v want %v", status, tc.expectedStatusCode)
+			}
+		})
+	}
+}
+
+func TestTOMLHandler(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, "Hello, world!")
+	})
+
+	tests := map[string]struct {
+		toml               []byte
+		fallback           http.Handler
+		requestPath        string
+		expectedStatusCode int
+		expectedError      bool
+	}{
+		"correct handler": {
+			toml: []byte(`
+[[mappings]]
+path = "/urlshort"
+url = "https://github.com/gophercises/urlshort"
+
+[[mappings]]
+path = "/urlshort-final"
+url = "https://github.com/gophercises/urlshort/tree/solution"
+`),
+			fallback:           mux,
+			requestPath:        "/urlshort-final",
+			expectedStatusCode: 301,
+		},
+		"invalid toml": {
+			toml:          []byte(`[[mappings]`),
+			fallback:      mux,
+			expectedError: true,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			handler, err := urlshort.TOMLHandler(tc.toml, tc.fallback)
+			if (err != nil) != tc.expectedError {
+				t.Fatalf("expected error: %v, got: %v", tc.expectedError, err)
+			}
+			if err != nil {
+				return
+			}
+			req, err := http.NewRequest("GET", tc.requestPath, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			rr := httptest.NewRecorder()
+			handler(rr, req)
+			if status := rr.Code; status != tc.expectedStatusCode {
+				t.Errorf("handler returned wrong status code: got %v want %v", status, tc.expectedStatusCode)
+			}
+		})
+	}
+}
+
 func TestShortener(t *testing.T) {
 	tests := map[string]struct {
 		URL        string
@@ -272,24 +534,158 @@ func TestShortener(t *testing.T) {
 			t.Errorf("handler returned wrong status code: got %v want %v", status, http.StatusInternalServerError)
 		}
 	})
+
+	t.Run("key collision retried with new key", func(t *testing.T) {
+		saver := &mockSaverCollision{collisions: 2}
+		handler := urlshort.Shortener(saver, "http://localhost:8080", http.HandlerFunc(statusBadRequestHandlerMock))
+		req, err := http.NewRequest("POST", fmt.Sprintf("/shorten?url=%s", "http://www.google.com"), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rr := httptest.NewRecorder()
+		handler(rr, req)
+		if status := rr.Code; status != http.StatusOK {
+			t.Errorf("handler returned wrong status code: got %v want %v", status, http.StatusOK)
+		}
+		if len(saver.keys) != 3 {
+			t.Fatalf("expected 3 save attempts, got %d", len(saver.keys))
+		}
+		if !strings.Contains(rr.Body.String(), saver.keys[2]) {
+			t.Errorf("expected response to contain saved key %s", saver.keys[2])
+		}
+	})
+
+	t.Run("alias used as key", func(t *testing.T) {
+		saver := &mockSaverCollision{}
+		handler := urlshort.Shortener(saver, "http://localhost:8080", http.HandlerFunc(statusBadRequestHandlerMock))
+		req, err := http.NewRequest("POST", "/shorten?url=http://www.google.com&alias=spring-sale", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rr := httptest.NewRecorder()
+		handler(rr, req)
+		if status := rr.Code; status != http.StatusOK {
+			t.Errorf("handler returned wrong status code: got %v want %v", status, http.StatusOK)
+		}
+		if len(saver.keys) != 1 || saver.keys[0] != "spring-sale" {
+			t.Fatalf("expected alias to be saved as key, got %v", saver.keys)
+		}
+		if !strings.Contains(rr.Body.String(), "http://localhost:8080/short/spring-sale") {
+			t.Errorf("expected response to contain the aliased short url")
+		}
+	})
+
+	t.Run("invalid alias", func(t *testing.T) {
+		saver := &mockSaverCollision{}
+		handler := urlshort.Shortener(saver, "http://localhost:8080", http.HandlerFunc(statusBadRequestHandlerMock))
+		req, err := http.NewRequest("POST", "/shorten?url=http://www.google.com&alias=shorten", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rr := httptest.NewRecorder()
+		handler(rr, req)
+		if status := rr.Code; status != http.StatusBadRequest {
+			t.Errorf("handler returned wrong status code: got %v want %v", status, http.StatusBadRequest)
+		}
+		if len(saver.keys) != 0 {
+			t.Fatalf("expected nothing to be saved, got %v", saver.keys)
+		}
+	})
+
+	t.Run("alias taken", func(t *testing.T) {
+		saver := &mockSaverCollision{collisions: 1}
+		handler := urlshort.Shortener(saver, "http://localhost:8080", http.HandlerFunc(statusBadRequestHandlerMock))
+		req, err := http.NewRequest("POST", "/shorten?url=http://www.google.com&alias=spring-sale", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rr := httptest.NewRecorder()
+		handler(rr, req)
+		if status := rr.Code; status != http.StatusConflict {
+			t.Errorf("handler returned wrong status code: got %v want %v", status, http.StatusConflict)
+		}
+		if len(saver.keys) != 1 {
+			t.Fatalf("expected a single save attempt for an alias, got %d", len(saver.keys))
+		}
+	})
+
+	t.Run("expiration from form", func(t *testing.T) {
+		saver := &mockSaverCollision{}
+		handler := urlshort.Shortener(saver, "http://localhost:8080", http.HandlerFunc(statusBadRequestHandlerMock))
+		req, err := http.NewRequest("POST", "/shorten?url=http://www.google.com&expires_at=2030-01-01T00:00:00Z", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rr := httptest.NewRecorder()
+		handler(rr, req)
+		if status := rr.Code; status != http.StatusOK {
+			t.Errorf("handler returned wrong status code: got %v want %v", status, http.StatusOK)
+		}
+		if want := time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC); !saver.link.ExpiresAt.Equal(want) {
+			t.Errorf("saver got wrong expiration: got %v want %v", saver.link.ExpiresAt, want)
+		}
+	})
+
+	t.Run("invalid expiration", func(t *testing.T) {
+		saver := &mockSaverCollision{}
+		handler := urlshort.Shortener(saver, "http://localhost:8080", http.HandlerFunc(statusBadRequestHandlerMock), urlshort.WithMaxExpiration(time.Hour))
+		req, err := http.NewRequest("POST", "/shorten?url=http://www.google.com&expires_in=86400", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rr := httptest.NewRecorder()
+		handler(rr, req)
+		if status := rr.Code; status != http.StatusBadRequest {
+			t.Errorf("handler returned wrong status code: got %v want %v", status, http.StatusBadRequest)
+		}
+		if len(saver.keys) != 0 {
+			t.Fatalf("expected nothing to be saved, got %v", saver.keys)
+		}
+	})
+
+	t.Run("key collision retries exhausted", func(t *testing.T) {
+		saver := &mockSaverCollision{collisions: 100}
+		handler := urlshort.Shortener(saver, "http://localhost:8080", http.HandlerFunc(statusBadRequestHandlerMock))
+		req, err := http.NewRequest("POST", fmt.Sprintf("/shorten?url=%s", "http://www.google.com"), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rr := httptest.NewRecorder()
+		handler(rr, req)
+		if status := rr.Code; status != http.StatusInternalServerError {
+			t.Errorf("handler returned wrong status code: got %v want %v", status, http.StatusInternalServerError)
+		}
+		if len(saver.keys) == 0 || len(saver.keys) >= saver.collisions {
+			t.Errorf("expected a bounded number of save attempts, got %d", len(saver.keys))
+		}
+		if got := strings.TrimSpace(rr.Body.String()); got != "could not generate a unique short key" {
+			t.Errorf("handler returned unexpected body: got %v", got)
+		}
+	})
 }
 
 type mockGetter struct{}
 
-func (m *mockGetter) Get(ctx context.Context, key string) (string, error) {
-	return "http://www.google.com", nil
+func (m *mockGetter) Get(ctx context.Context, key string) (urlshort.Link, error) {
+	return urlshort.Link{Key: key, URL: "http://www.google.com"}, nil
 }
 
 type mockGetterMissingKey struct{}
 
-func (m *mockGetterMissingKey) Get(ctx context.Context, key string) (string, error) {
-	return "", urlshort.ErrMissingKey
+func (m *mockGetterMissingKey) Get(ctx context.Context, key string) (urlshort.Link, error) {
+	return urlshort.Link{}, urlshort.ErrMissingKey
+}
+
+type mockGetterExpiredKey struct{}
+
+func (m *mockGetterExpiredKey) Get(ctx context.Context, key string) (urlshort.Link, error) {
+	return urlshort.Link{}, urlshort.ErrExpiredKey
 }
 
 type mockGetterError struct{}
 
-func (m *mockGetterError) Get(ctx context.Context, key string) (string, error) {
-	return "", errors.New("some error")
+func (m *mockGetterError) Get(ctx context.Context, key string) (urlshort.Link, error) {
+	return urlshort.Link{}, errors.New("some error")
 }
 
 func TestRetrieveHandler(t *testing.T) {
@@ -298,6 +694,7 @@ func TestRetrieveHandler(t *testing.T) {
 		path       string
 		getter     urlshort.UrlShortGetter
 		fallback   http.Handler
+		opts       []urlshort.RetrieveOption
 		statusCode int
 	}{
 		"correct retrieve": {
@@ -328,11 +725,26 @@ func TestRetrieveHandler(t *testing.T) {
 			fallback:   http.HandlerFunc(statusBadRequestHandlerMock),
 			statusCode: http.StatusInternalServerError,
 		},
+		"expired key without expired handler": {
+			method:     "GET",
+			path:       "/short/CSl5Ow",
+			getter:     &mockGetterExpiredKey{},
+			fallback:   http.HandlerFunc(statusBadRequestHandlerMock),
+			statusCode: http.StatusBadRequest,
+		},
+		"expired key": {
+			method:     "GET",
+			path:       "/short/CSl5Ow",
+			getter:     &mockGetterExpiredKey{},
+			fallback:   http.HandlerFunc(statusBadRequestHandlerMock),
+			opts:       []urlshort.RetrieveOption{urlshort.WithExpiredHandler(http.HandlerFunc(statusGoneHandlerMock))},
+			statusCode: http.StatusGone,
+		},
 	}
 
 	for name, tc := range tests {
 		t.Run(name, func(t *testing.T) {
-			handler := urlshort.RetrieveHandler(tc.getter, tc.fallback)
+			handler := urlshort.RetrieveHandler(tc.getter, tc.fallback, tc.opts...)
 			req, err := http.NewRequest(tc.method, tc.path, nil)
 			if err != nil {
 				t.Fatal(err)
@@ -0,0 +1,525 @@
+// Package disk implements a storage for shortened urls and API keys persisted in a single
+// append-only file. Every write is appended as a checksummed record and synced
+// before it is acknowledged; on startup the file is replayed and any torn record
+// left by a crash is truncated away. Superseded records, and links that expired
+// more than urlshort.ExpiredRetention ago, are dropped by compacting the log into
+// a fresh file that atomically replaces the old one.
+package disk
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+	"urlshort"
+	"urlshort/internal/memory"
+)
+
+// headerSize is the size of the checksum and length prefixing every record.
+const headerSize = 8
+
+// maxRecordSize is the largest payload a record may have. Longer lengths can
+// only come from a corrupt header and are rejected before allocating them.
+const maxRecordSize = 1 << 20
+
+// minCompactRecords is the smallest log size worth compacting.
+const minCompactRecords = 1024
+
+const (
+	opSet     = "set"
+	opDelete  = "del"
+	opCounter = "ctr"
+	opAPIKey  = "key"
+)
+
+type record struct {
+	Op        string `json:"op"`
+	Key       string `json:"key,omitempty"`
+	URL       string `json:"url,omitempty"`
+	ExpiresAt int64  `json:"expires_at,omitempty"`
+	Status    int    `json:"status,omitempty"`
+	Query     string `json:"query,omitempty"`
+	Preview   bool   `json:"preview,omitempty"`
+	CreatedAt int64  `json:"created_at,omitempty"`
+	CreatedBy string `json:"created_by,omitempty"`
+	Counter   uint64 `json:"counter,omitempty"`
+	// Name, Hash and RevokedAt describe the API key of opAPIKey records, whose
+	// id is in Key.
+	Name      string `json:"name,omitempty"`
+	Hash      string `json:"hash,omitempty"`
+	RevokedAt int64  `json:"revoked_at,omitempty"`
+}
+
+type store struct {
+	mu   sync.RWMutex
+	path string
+	file *os.File
+	// lock is held open, and locked, for as long as the store is so another
+	// process can't append to the log. It is a separate file because compaction
+	// replaces the log.
+	lock    *os.File
+	links   *memory.Links
+	size    int64
+	records int
+	counter uint64
+	now     func() time.Time
+}
+
+type Options struct {
+	Path string
+}
+
+// Open opens the log file at opts.Path, creating it if needed, and loads every
+// entry that is not forgotten into memory. It fails with ErrLocked while another
+// process, such as a running server, has the log open.
+func Open(opts *Options) (*store, error) {
+	s := newStore(opts)
+	if err := s.lockLog(); err != nil {
+		return nil, err
+	}
+	if err := s.recover(); err != nil {
+		s.lock.Close()
+		return nil, err
+	}
+	if s.shouldCompact() {
+		if err := s.compact(); err != nil {
+			s.file.Close()
+			s.lock.Close()
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+// ErrLocked is returned by Open when another process has the log open.
+var ErrLocked = errors.New("log is used by another process")
+
+// lockLog takes the lock of the log, a file next to it named after it.
+func (s *store) lockLog() error {
+	lock, err := os.OpenFile(s.path+".lock", os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+	if err = lockFile(lock); err != nil {
+		lock.Close()
+		return fmt.Errorf("locking %s: %w", s.path, err)
+	}
+	s.lock = lock
+	return nil
+}
+
+func newStore(opts *Options) *store {
+	return &store{
+		path:  opts.Path,
+		links: memory.NewLinks(),
+		now:   time.Now,
+	}
+}
+
+// recover replays the log into memory, truncating a record torn by a crash
+// while it was appended. It fails, leaving the log untouched, if a record
+// followed by others is corrupt.
+func (s *store) recover() error {
+	file, err := os.OpenFile(s.path, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	valid, err := s.replay(bufio.NewReader(file), info.Size())
+	if err != nil {
+		file.Close()
+		return fmt.Errorf("replaying %s: %w", s.path, err)
+	}
+
+	if info.Size() != valid {
+		log.Printf("disk storage: truncating %d bytes of incomplete records from %s", info.Size()-valid, s.path)
+		if err = file.Truncate(valid); err != nil {
+			file.Close()
+			return err
+		}
+		if err = file.Sync(); err != nil {
+			file.Close()
+			return err
+		}
+	}
+	if _, err = file.Seek(valid, io.SeekStart); err != nil {
+		file.Close()
+		return err
+	}
+	s.file = file
+	s.size = valid
+	return nil
+}
+
+// replay applies the records read from r, holding size bytes, and returns the
+// offset right after the last intact one. Only the last record can be torn,
+// cut short or corrupt as it reaches the end of r, a corrupt record followed by
+// others is an error.
+func (s *store) replay(r io.Reader, size int64) (int64, error) {
+	var offset int64
+	now := s.now()
+	for {
+		rec, n, err := readRecord(r)
+		if errors.Is(err, io.EOF) || errors.Is(err, errTorn) {
+			return offset, nil
+		}
+		if errors.Is(err, errCorrupt) {
+			if offset+n >= size {
+				return offset, nil
+			}
+			return offset, fmt.Errorf("%w at offset %d", err, offset)
+		}
+		if err != nil {
+			return offset, err
+		}
+		offset += n
+		s.records++
+		s.apply(rec, now)
+	}
+}
+
+func (s *store) apply(rec record, now time.Time) {
+	switch rec.Op {
+	case opSet:
+		link := urlshort.Link{Key: rec.Key, URL: rec.URL, Status: rec.Status, Query: urlshort.QueryPolicy(rec.Query), Preview: rec.Preview, CreatedBy: rec.CreatedBy}
+		if rec.ExpiresAt != 0 {
+			link.ExpiresAt = time.Unix(0, rec.ExpiresAt)
+		}
+		if rec.CreatedAt != 0 {
+			link.CreatedAt = time.Unix(0, rec.CreatedAt)
+		}
+		s.links.Set(link)
+		s.links.Forget(rec.Key, now)
+	case opDelete:
+		s.links.Remove(rec.Key)
+	case opCounter:
+		s.counter = rec.Counter
+	case opAPIKey:
+		key := urlshort.APIKey{ID: rec.Key, Name: rec.Name, Hash: rec.Hash}
+		if rec.CreatedAt != 0 {
+			key.CreatedAt = time.Unix(0, rec.CreatedAt)
+		}
+		if rec.RevokedAt != 0 {
+			key.RevokedAt = time.Unix(0, rec.RevokedAt)
+		}
+		s.links.SetAPIKey(key)
+	}
+}
+
+var (
+	// errTorn is returned for records cut short by the end of the log.
+	errTorn = errors.New("torn record")
+	// errCorrupt is returned, along with the length the record claims, for
+	// records failing their checksum or too long to be genuine.
+	errCorrupt = errors.New("corrupt record")
+)
+
+func readRecord(r io.Reader) (record, int64, error) {
+	var rec record
+	header := make([]byte, headerSize)
+	if _, err := io.ReadFull(r, header); err != nil {
+		if errors.Is(err, io.ErrUnexpectedEOF) {
+			return rec, 0, errTorn
+		}
+		return rec, 0, err
+	}
+	sum := binary.LittleEndian.Uint32(header[0:4])
+	size := binary.LittleEndian.Uint32(header[4:8])
+	n := int64(headerSize) + int64(size)
+	if size > maxRecordSize {
+		return rec, n, errCorrupt
+	}
+	payload := make([]byte, size)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+			return rec, 0, errTorn
+		}
+		return rec, 0, err
+	}
+	if crc32.ChecksumIEEE(payload) != sum {
+		return rec, n, errCorrupt
+	}
+	if err := json.Unmarshal(payload, &rec); err != nil {
+		return rec, n, errCorrupt
+	}
+	return rec, n, nil
+}
+
+func encodeRecord(rec record) ([]byte, error) {
+	payload, err := json.Marshal(rec)
+	if err != nil {
+		return nil, err
+	}
+	if len(payload) > maxRecordSize {
+		return nil, fmt.Errorf("record of %d bytes exceeds the maximum of %d", len(payload), maxRecordSize)
+	}
+	buf := make([]byte, headerSize+len(payload))
+	binary.LittleEndian.PutUint32(buf[0:4], crc32.ChecksumIEEE(payload))
+	binary.LittleEndian.PutUint32(buf[4:8], uint32(len(payload)))
+	copy(buf[headerSize:], payload)
+	return buf, nil
+}
+
+// append durably writes rec to the log. Callers must hold the write lock.
+func (s *store) append(rec record) error {
+	buf, err := encodeRecord(rec)
+	if err != nil {
+		return err
+	}
+	if _, err = s.file.Write(buf); err == nil {
+		err = s.file.Sync()
+	}
+	if err != nil {
+		// drop whatever part of the record reached the file so later appends
+		// are not hidden behind a torn record on the next recovery
+		if terr := s.file.Truncate(s.size); terr == nil {
+			s.file.Seek(s.size, io.SeekStart)
+		}
+		return err
+	}
+	s.size += int64(len(buf))
+	s.records++
+	return nil
+}
+
+func (s *store) shouldCompact() bool {
+	return s.records >= minCompactRecords && s.records > 2*(s.links.Len()+s.links.NumAPIKeys()+1)
+}
+
+// compact rewrites the live entries into a new file and atomically renames it
+// over the log. Callers must hold the write lock.
+func (s *store) compact() error {
+	s.links.Sweep(s.now())
+	var live []record
+	if s.counter > 0 {
+		live = append(live, record{Op: opCounter, Counter: s.counter})
+	}
+	for _, link := range s.links.All() {
+		live = append(live, newSetRecord(link))
+	}
+	for _, key := range s.links.APIKeys() {
+		live = append(live, newAPIKeyRecord(key))
+	}
+
+	tmpPath := s.path + ".compact"
+	tmp, err := os.OpenFile(tmpPath, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	size, err := writeRecords(tmp, live)
+	if err == nil {
+		err = os.Rename(tmpPath, s.path)
+	}
+	if err == nil {
+		err = syncDir(filepath.Dir(s.path))
+	}
+	if err != nil {
+		tmp.Close()
+		return err
+	}
+
+	s.file.Close()
+	s.file = tmp
+	s.size = size
+	s.records = len(live)
+	return nil
+}
+
+// writeRecords durably writes records to file and returns the number of bytes written.
+func writeRecords(file *os.File, records []record) (int64, error) {
+	w := bufio.NewWriter(file)
+	var size int64
+	for _, rec := range records {
+		buf, err := encodeRecord(rec)
+		if err != nil {
+			return 0, err
+		}
+		if _, err = w.Write(buf); err != nil {
+			return 0, err
+		}
+		size += int64(len(buf))
+	}
+	if err := w.Flush(); err != nil {
+		return 0, err
+	}
+	return size, file.Sync()
+}
+
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
+}
+
+func newSetRecord(link urlshort.Link) record {
+	rec := record{Op: opSet, Key: link.Key, URL: link.URL, Status: link.Status, Query: string(link.Query), Preview: link.Preview, CreatedBy: link.CreatedBy}
+	if !link.ExpiresAt.IsZero() {
+		rec.ExpiresAt = link.ExpiresAt.UnixNano()
+	}
+	if !link.CreatedAt.IsZero() {
+		rec.CreatedAt = link.CreatedAt.UnixNano()
+	}
+	return rec
+}
+
+func newAPIKeyRecord(key urlshort.APIKey) record {
+	rec := record{Op: opAPIKey, Key: key.ID, Name: key.Name, Hash: key.Hash}
+	if !key.CreatedAt.IsZero() {
+		rec.CreatedAt = key.CreatedAt.UnixNano()
+	}
+	if !key.RevokedAt.IsZero() {
+		rec.RevokedAt = key.RevokedAt.UnixNano()
+	}
+	return rec
+}
+
+func (s *store) Save(ctx context.Context, link urlshort.Link) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.save(link)
+}
+
+func (s *store) SaveUnique(ctx context.Context, link urlshort.Link) (urlshort.Link, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if existing, ok := s.links.Unique(link, s.now()); ok {
+		return existing, nil
+	}
+	if err := s.save(link); err != nil {
+		return urlshort.Link{}, err
+	}
+	return link, nil
+}
+
+// save durably stores link unless its key is taken by a link that has not expired.
+// Callers must hold the write lock.
+func (s *store) save(link urlshort.Link) error {
+	if s.links.Exists(link.Key, s.now()) {
+		return urlshort.ErrKeyExists
+	}
+	if err := s.append(newSetRecord(link)); err != nil {
+		return fmt.Errorf("saving key: %w", err)
+	}
+	s.links.Set(link)
+
+	if s.shouldCompact() {
+		if err := s.compact(); err != nil {
+			log.Printf("disk storage: compaction failed: %v", err)
+		}
+	}
+	return nil
+}
+
+func (s *store) Get(ctx context.Context, key string) (urlshort.Link, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.links.Get(key, s.now())
+}
+
+func (s *store) Delete(ctx context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.links.Exists(key, s.now()) {
+		return urlshort.ErrMissingKey
+	}
+	if err := s.append(record{Op: opDelete, Key: key}); err != nil {
+		return fmt.Errorf("deleting key: %w", err)
+	}
+	s.links.Remove(key)
+	return nil
+}
+
+func (s *store) Update(ctx context.Context, key string, url string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	link, err := s.links.Get(key, s.now())
+	if err != nil {
+		return urlshort.ErrMissingKey
+	}
+	link.URL = url
+	if err := s.append(newSetRecord(link)); err != nil {
+		return fmt.Errorf("updating key: %w", err)
+	}
+	s.links.Set(link)
+	return nil
+}
+
+func (s *store) Exists(ctx context.Context, key string) (bool, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.links.Exists(key, s.now()), nil
+}
+
+func (s *store) IncrementKeyCounter(ctx context.Context) (uint64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.append(record{Op: opCounter, Counter: s.counter + 1}); err != nil {
+		return 0, fmt.Errorf("incrementing counter: %w", err)
+	}
+	s.counter++
+	return s.counter, nil
+}
+
+// List returns links ordered by key; the cursor is the last key of the previous page.
+func (s *store) List(ctx context.Context, cursor string, count int) ([]urlshort.Link, string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	links, next := s.links.List(cursor, count, s.now())
+	return links, next, nil
+}
+
+func (s *store) SaveAPIKey(ctx context.Context, key urlshort.APIKey) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.append(newAPIKeyRecord(key)); err != nil {
+		return fmt.Errorf("saving api key: %w", err)
+	}
+	s.links.SetAPIKey(key)
+	return nil
+}
+
+func (s *store) GetAPIKey(ctx context.Context, id string) (urlshort.APIKey, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.links.GetAPIKey(id)
+}
+
+func (s *store) ListAPIKeys(ctx context.Context) ([]urlshort.APIKey, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.links.APIKeys(), nil
+}
+
+// Close closes the underlying file and releases the lock of the log.
+func (s *store) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	err := s.file.Close()
+	if lerr := s.lock.Close(); err == nil {
+		err = lerr
+	}
+	return err
+}
@@ -0,0 +1,494 @@
+package disk
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+	"urlshort"
+)
+
+func openStore(t *testing.T, path string, now func() time.Time) *store {
+	t.Helper()
+	s := newStore(&Options{Path: path})
+	s.now = now
+	if err := s.lockLog(); err != nil {
+		t.Fatalf("error was not expected but got: %s", err.Error())
+	}
+	if err := s.recover(); err != nil {
+		t.Fatalf("error was not expected but got: %s", err.Error())
+	}
+	t.Cleanup(func() { s.Close() })
+	return s
+}
+
+func TestSaveAndGet(t *testing.T) {
+	storage, err := Open(&Options{Path: filepath.Join(t.TempDir(), "urlshort.db")})
+	if err != nil {
+		t.Fatalf("error was not expected but got: %s", err.Error())
+	}
+	defer storage.Close()
+
+	myLink := urlshort.Link{Key: "my-key", URL: "http://www.google.com", Status: 302, Query: urlshort.QueryOverride, Preview: true, ExpiresAt: time.Unix(0, time.Now().Add(time.Hour).UnixNano()), CreatedAt: time.Unix(0, time.Now().UnixNano()), CreatedBy: "apikey01"}
+	if err = storage.Save(context.Background(), myLink); err != nil {
+		t.Fatalf("error was not expected but got: %s", err.Error())
+	}
+
+	myRetrievedLink, err := storage.Get(context.Background(), myLink.Key)
+	if err != nil {
+		t.Fatalf("error was not expected but got: %s", err.Error())
+	}
+	if myRetrievedLink != myLink {
+		t.Fatalf("expected link %v but got %v", myLink, myRetrievedLink)
+	}
+
+	if err = storage.Save(context.Background(), urlshort.Link{Key: myLink.Key, URL: "http://www.example.com"}); !errors.Is(err, urlshort.ErrKeyExists) {
+		t.Fatalf("expected ErrKeyExists but got: %v", err)
+	}
+
+	if _, err = storage.Get(context.Background(), "other-key"); !errors.Is(err, urlshort.ErrMissingKey) {
+		t.Fatalf("expected ErrMissingKey but got: %v", err)
+	}
+}
+
+func TestPersistAcrossRestart(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "urlshort.db")
+	storage, err := Open(&Options{Path: path})
+	if err != nil {
+		t.Fatalf("error was not expected but got: %s", err.Error())
+	}
+	createdAt := time.Unix(0, time.Now().UnixNano())
+	for i := 0; i < 10; i++ {
+		if err = storage.Save(context.Background(), urlshort.Link{Key: fmt.Sprintf("key-%d", i), URL: fmt.Sprintf("http://www.google.com/%d", i), Status: 307, Query: urlshort.QueryAppend, Preview: true, CreatedAt: createdAt}); err != nil {
+			t.Fatalf("error was not expected but got: %s", err.Error())
+		}
+	}
+	if err = storage.Close(); err != nil {
+		t.Fatalf("error was not expected but got: %s", err.Error())
+	}
+
+	storage, err = Open(&Options{Path: path})
+	if err != nil {
+		t.Fatalf("error was not expected but got: %s", err.Error())
+	}
+	defer storage.Close()
+	for i := 0; i < 10; i++ {
+		link, err := storage.Get(context.Background(), fmt.Sprintf("key-%d", i))
+		if err != nil {
+			t.Fatalf("error was not expected but got: %s", err.Error())
+		}
+		if want := fmt.Sprintf("http://www.google.com/%d", i); link.URL != want {
+			t.Fatalf("expected url %s but got %s", want, link.URL)
+		}
+		if link.Status != 307 || link.Query != urlshort.QueryAppend || !link.Preview {
+			t.Fatalf("expected status 307, query policy append and preview but got %d, %q, %v", link.Status, link.Query, link.Preview)
+		}
+		if !link.CreatedAt.Equal(createdAt) {
+			t.Fatalf("expected creation time %v but got %v", createdAt, link.CreatedAt)
+		}
+	}
+}
+
+func TestRecoverTornRecord(t *testing.T) {
+	tests := map[string]func(data []byte) []byte{
+		"truncated payload": func(data []byte) []byte { return data[:len(data)-3] },
+		"truncated header":  func(data []byte) []byte { return append(data, 0x01, 0x02) },
+		"bad checksum": func(data []byte) []byte {
+			data[len(data)-2] ^= 0xff
+			return data
+		},
+		"huge length": func(data []byte) []byte {
+			return append(data, 0x00, 0x00, 0x00, 0x00, 0xff, 0xff, 0xff, 0xff, '{')
+		},
+	}
+
+	for name, corrupt := range tests {
+		t.Run(name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "urlshort.db")
+			storage := openStore(t, path, time.Now)
+			if err := storage.Save(context.Background(), urlshort.Link{Key: "first", URL: "http://www.google.com"}); err != nil {
+				t.Fatalf("error was not expected but got: %s", err.Error())
+			}
+			if err := storage.Save(context.Background(), urlshort.Link{Key: "second", URL: "http://www.example.com"}); err != nil {
+				t.Fatalf("error was not expected but got: %s", err.Error())
+			}
+			storage.Close()
+
+			data, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err = os.WriteFile(path, corrupt(data), 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			storage = openStore(t, path, time.Now)
+			if _, err = storage.Get(context.Background(), "first"); err != nil {
+				t.Fatalf("intact record lost: %s", err.Error())
+			}
+			if err = storage.Save(context.Background(), urlshort.Link{Key: "third", URL: "http://www.example.org"}); err != nil {
+				t.Fatalf("error was not expected but got: %s", err.Error())
+			}
+			storage.Close()
+
+			storage = openStore(t, path, time.Now)
+			if _, err = storage.Get(context.Background(), "third"); err != nil {
+				t.Fatalf("record appended after recovery lost: %s", err.Error())
+			}
+		})
+	}
+}
+
+func TestRecoverCorruptRecord(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "urlshort.db")
+	storage := openStore(t, path, time.Now)
+	for _, key := range []string{"first", "second", "third"} {
+		if err := storage.Save(context.Background(), urlshort.Link{Key: key, URL: "http://www.google.com"}); err != nil {
+			t.Fatalf("error was not expected but got: %s", err.Error())
+		}
+	}
+	storage.Close()
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data[headerSize+2] ^= 0xff
+	if err = os.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = Open(&Options{Path: path}); !errors.Is(err, errCorrupt) {
+		t.Fatalf("expected %v, got %v", errCorrupt, err)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Size() != int64(len(data)) {
+		t.Errorf("expected the log to be left untouched, its size went from %d to %d", len(data), info.Size())
+	}
+}
+
+func TestReadRecordHugeLength(t *testing.T) {
+	header := []byte{0x00, 0x00, 0x00, 0x00, 0xff, 0xff, 0xff, 0xff}
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	_, _, err := readRecord(bytes.NewReader(append(header, '{')))
+	runtime.ReadMemStats(&after)
+	if !errors.Is(err, errCorrupt) {
+		t.Fatalf("expected %v, got %v", errCorrupt, err)
+	}
+	if allocated := after.TotalAlloc - before.TotalAlloc; allocated > maxRecordSize {
+		t.Errorf("expected the length to be rejected before allocating, %d bytes were allocated", allocated)
+	}
+}
+
+func TestExpiration(t *testing.T) {
+	now := time.Now()
+	clock := func() time.Time { return now }
+	path := filepath.Join(t.TempDir(), "urlshort.db")
+
+	storage := openStore(t, path, clock)
+	if err := storage.Save(context.Background(), urlshort.Link{Key: "my-key", URL: "http://www.google.com", ExpiresAt: now.Add(10 * time.Minute)}); err != nil {
+		t.Fatalf("error was not expected but got: %s", err.Error())
+	}
+	storage.Close()
+
+	now = now.Add(9 * time.Minute)
+	storage = openStore(t, path, clock)
+	if _, err := storage.Get(context.Background(), "my-key"); err != nil {
+		t.Fatalf("error was not expected but got: %s", err.Error())
+	}
+
+	now = now.Add(time.Minute)
+	if _, err := storage.Get(context.Background(), "my-key"); !errors.Is(err, urlshort.ErrExpiredKey) {
+		t.Fatalf("expected ErrExpiredKey but got: %v", err)
+	}
+	storage.Close()
+
+	storage = openStore(t, path, clock)
+	if _, err := storage.Get(context.Background(), "my-key"); !errors.Is(err, urlshort.ErrExpiredKey) {
+		t.Fatalf("expected ErrExpiredKey after restart but got: %v", err)
+	}
+	storage.Close()
+
+	now = now.Add(urlshort.ExpiredRetention)
+	storage = openStore(t, path, clock)
+	if _, err := storage.Get(context.Background(), "my-key"); !errors.Is(err, urlshort.ErrMissingKey) {
+		t.Fatalf("expected ErrMissingKey but got: %v", err)
+	}
+	if storage.links.Len() != 0 {
+		t.Fatalf("expected forgotten entry to be dropped on replay, got %d entries", storage.links.Len())
+	}
+}
+
+func TestSaveOverExpired(t *testing.T) {
+	now := time.Now()
+	clock := func() time.Time { return now }
+	path := filepath.Join(t.TempDir(), "urlshort.db")
+
+	storage := openStore(t, path, clock)
+	if err := storage.Save(context.Background(), urlshort.Link{Key: "my-key", URL: "http://www.google.com", ExpiresAt: now.Add(time.Minute)}); err != nil {
+		t.Fatalf("error was not expected but got: %s", err.Error())
+	}
+	now = now.Add(time.Minute)
+	if err := storage.Save(context.Background(), urlshort.Link{Key: "my-key", URL: "http://www.example.com"}); err != nil {
+		t.Fatalf("expired key should be reusable but got: %s", err.Error())
+	}
+	storage.Close()
+
+	storage = openStore(t, path, clock)
+	link, err := storage.Get(context.Background(), "my-key")
+	if err != nil {
+		t.Fatalf("error was not expected but got: %s", err.Error())
+	}
+	if link.URL != "http://www.example.com" {
+		t.Fatalf("expected url %s but got %s", "http://www.example.com", link.URL)
+	}
+}
+
+func TestCompaction(t *testing.T) {
+	now := time.Now()
+	clock := func() time.Time { return now }
+	path := filepath.Join(t.TempDir(), "urlshort.db")
+
+	storage := openStore(t, path, clock)
+	for i := 0; i < minCompactRecords; i++ {
+		if err := storage.Save(context.Background(), urlshort.Link{Key: fmt.Sprintf("key-%d", i), URL: "http://www.google.com", ExpiresAt: now.Add(time.Minute)}); err != nil {
+			t.Fatalf("error was not expected but got: %s", err.Error())
+		}
+	}
+	now = now.Add(2 * time.Minute)
+	for i := 0; i < minCompactRecords; i++ {
+		if err := storage.Save(context.Background(), urlshort.Link{Key: fmt.Sprintf("key-%d", i), URL: "http://www.example.com"}); err != nil {
+			t.Fatalf("error was not expected but got: %s", err.Error())
+		}
+	}
+	if storage.records != 2*minCompactRecords {
+		t.Fatalf("expected %d records before compaction, got %d", 2*minCompactRecords, storage.records)
+	}
+	if err := storage.compact(); err != nil {
+		t.Fatalf("error was not expected but got: %s", err.Error())
+	}
+	if storage.records != minCompactRecords {
+		t.Fatalf("expected log to be compacted to %d records, got %d", minCompactRecords, storage.records)
+	}
+	if _, err := os.Stat(path + ".compact"); !os.IsNotExist(err) {
+		t.Fatalf("expected temporary compaction file to be gone, got: %v", err)
+	}
+	storage.Close()
+
+	storage = openStore(t, path, clock)
+	if storage.records != minCompactRecords {
+		t.Fatalf("expected %d records after restart, got %d", minCompactRecords, storage.records)
+	}
+	for i := 0; i < minCompactRecords; i++ {
+		link, err := storage.Get(context.Background(), fmt.Sprintf("key-%d", i))
+		if err != nil {
+			t.Fatalf("error was not expected but got: %s", err.Error())
+		}
+		if link.URL != "http://www.example.com" {
+			t.Fatalf("expected url %s but got %s", "http://www.example.com", link.URL)
+		}
+	}
+}
+
+func TestDeleteUpdateExists(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "urlshort.db")
+	storage := openStore(t, path, time.Now)
+	ctx := context.Background()
+
+	if err := storage.Save(ctx, urlshort.Link{Key: "my-key", URL: "http://www.google.com"}); err != nil {
+		t.Fatalf("error was not expected but got: %s", err.Error())
+	}
+	if err := storage.Save(ctx, urlshort.Link{Key: "deleted-key", URL: "http://www.google.com"}); err != nil {
+		t.Fatalf("error was not expected but got: %s", err.Error())
+	}
+	if err := storage.Update(ctx, "my-key", "http://www.example.com"); err != nil {
+		t.Fatalf("error was not expected but got: %s", err.Error())
+	}
+	if err := storage.Update(ctx, "other-key", "http://www.example.com"); !errors.Is(err, urlshort.ErrMissingKey) {
+		t.Fatalf("expected ErrMissingKey but got: %v", err)
+	}
+	if err := storage.Delete(ctx, "deleted-key"); err != nil {
+		t.Fatalf("error was not expected but got: %s", err.Error())
+	}
+	if err := storage.Delete(ctx, "deleted-key"); !errors.Is(err, urlshort.ErrMissingKey) {
+		t.Fatalf("expected ErrMissingKey but got: %v", err)
+	}
+	storage.Close()
+
+	storage = openStore(t, path, time.Now)
+	if link, _ := storage.Get(ctx, "my-key"); link.URL != "http://www.example.com" {
+		t.Fatalf("expected updated url after restart but got %s", link.URL)
+	}
+	if ok, _ := storage.Exists(ctx, "deleted-key"); ok {
+		t.Fatalf("expected key to stay deleted after restart")
+	}
+
+	links, next, err := storage.List(ctx, "", 10)
+	if err != nil {
+		t.Fatalf("error was not expected but got: %s", err.Error())
+	}
+	if len(links) != 1 || links[0].Key != "my-key" || next != "" {
+		t.Fatalf("unexpected list result: %+v, %q", links, next)
+	}
+}
+
+func TestList(t *testing.T) {
+	now := time.Now()
+	clock := func() time.Time { return now }
+	path := filepath.Join(t.TempDir(), "urlshort.db")
+	storage := openStore(t, path, clock)
+	ctx := context.Background()
+
+	for i := 0; i < 25; i++ {
+		if err := storage.Save(ctx, urlshort.Link{Key: fmt.Sprintf("key-%02d", i), URL: "http://www.google.com"}); err != nil {
+			t.Fatalf("error was not expected but got: %s", err.Error())
+		}
+	}
+	if err := storage.Save(ctx, urlshort.Link{Key: "expiring", URL: "http://www.google.com", ExpiresAt: now.Add(time.Minute)}); err != nil {
+		t.Fatalf("error was not expected but got: %s", err.Error())
+	}
+	now = now.Add(time.Minute)
+
+	// links are listed the same once replayed from the log
+	storage.Close()
+	storage = openStore(t, path, clock)
+
+	seen := make(map[string]bool)
+	cursor := ""
+	pages := 0
+	for {
+		links, next, err := storage.List(ctx, cursor, 10)
+		if err != nil {
+			t.Fatalf("error was not expected but got: %s", err.Error())
+		}
+		pages++
+		for _, link := range links {
+			if seen[link.Key] {
+				t.Fatalf("key %s listed twice", link.Key)
+			}
+			seen[link.Key] = true
+		}
+		if next == "" {
+			break
+		}
+		cursor = next
+	}
+	if len(seen) != 25 || pages != 3 || seen["expiring"] {
+		t.Fatalf("expected the 25 keys that have not expired in 3 pages, got %d keys in %d pages", len(seen), pages)
+	}
+}
+
+func TestIncrementKeyCounter(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "urlshort.db")
+	storage := openStore(t, path, time.Now)
+	for i := 0; i < 3; i++ {
+		if _, err := storage.IncrementKeyCounter(context.Background()); err != nil {
+			t.Fatalf("error was not expected but got: %s", err.Error())
+		}
+	}
+	if err := storage.compact(); err != nil {
+		t.Fatalf("error was not expected but got: %s", err.Error())
+	}
+	storage.Close()
+
+	storage = openStore(t, path, time.Now)
+	n, err := storage.IncrementKeyCounter(context.Background())
+	if err != nil {
+		t.Fatalf("error was not expected but got: %s", err.Error())
+	}
+	if n != 4 {
+		t.Fatalf("expected counter to survive compaction and restart, got %d", n)
+	}
+}
+
+func TestSaveUnique(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "urlshort.db")
+	storage := openStore(t, path, time.Now)
+	ctx := context.Background()
+
+	link, err := storage.SaveUnique(ctx, urlshort.Link{Key: "first", URL: "HTTP://WWW.Google.com:80", ExpiresAt: time.Now().Add(10 * time.Minute)})
+	if err != nil || link.Key != "first" {
+		t.Fatalf("expected key first, got %q, %v", link.Key, err)
+	}
+	storage.Close()
+
+	storage = openStore(t, path, time.Now)
+	link, err = storage.SaveUnique(ctx, urlshort.Link{Key: "second", URL: "http://www.google.com/"})
+	if err != nil || link.Key != "first" || link.URL != "HTTP://WWW.Google.com:80" {
+		t.Fatalf("expected existing link first with the url as submitted after restart, got %v, %v", link, err)
+	}
+	if err = storage.Delete(ctx, "first"); err != nil {
+		t.Fatalf("error was not expected but got: %s", err.Error())
+	}
+	link, err = storage.SaveUnique(ctx, urlshort.Link{Key: "third", URL: "http://www.google.com/"})
+	if err != nil || link.Key != "third" {
+		t.Fatalf("expected deleted link not to be reused, got %q, %v", link.Key, err)
+	}
+}
+
+func TestAPIKeysPersistAcrossRestart(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "urlshort.db")
+	now := time.Now()
+	storage := openStore(t, path, func() time.Time { return now })
+	ctx := context.Background()
+
+	key := urlshort.APIKey{ID: "apikey01", Name: "posters", Hash: "0123abcd", CreatedAt: time.Unix(0, now.UnixNano())}
+	if err := storage.SaveAPIKey(ctx, key); err != nil {
+		t.Fatalf("error was not expected but got: %s", err.Error())
+	}
+	if err := urlshort.RevokeAPIKey(ctx, storage, key.ID); err != nil {
+		t.Fatalf("error was not expected but got: %s", err.Error())
+	}
+	if err := storage.SaveAPIKey(ctx, urlshort.APIKey{ID: "apikey02", Name: "api", Hash: "4567ef01"}); err != nil {
+		t.Fatalf("error was not expected but got: %s", err.Error())
+	}
+	if err := storage.compact(); err != nil {
+		t.Fatalf("error was not expected but got: %s", err.Error())
+	}
+	storage.Close()
+
+	storage = openStore(t, path, func() time.Time { return now })
+	stored, err := storage.GetAPIKey(ctx, key.ID)
+	if err != nil || stored.Name != key.Name || stored.Hash != key.Hash || !stored.CreatedAt.Equal(key.CreatedAt) || !stored.Revoked() {
+		t.Fatalf("expected key %v to be revoked but got %v, %v", key, stored, err)
+	}
+	if keys, err := storage.ListAPIKeys(ctx); err != nil || len(keys) != 2 {
+		t.Fatalf("expected 2 keys but got %v, %v", keys, err)
+	}
+	if _, err = storage.GetAPIKey(ctx, "other"); !errors.Is(err, urlshort.ErrMissingAPIKey) {
+		t.Fatalf("expected ErrMissingAPIKey but got: %v", err)
+	}
+}
+
+func TestOpenLocked(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("logs are not locked on windows")
+	}
+	path := filepath.Join(t.TempDir(), "urlshort.db")
+	storage, err := Open(&Options{Path: path})
+	if err != nil {
+		t.Fatalf("error was not expected but got: %s", err.Error())
+	}
+
+	if _, err = Open(&Options{Path: path}); !errors.Is(err, ErrLocked) {
+		t.Fatalf("expected ErrLocked while the log is open but got: %v", err)
+	}
+
+	if err = storage.Close(); err != nil {
+		t.Fatalf("error was not expected but got: %s", err.Error())
+	}
+	storage, err = Open(&Options{Path: path})
+	if err != nil {
+		t.Fatalf("expected the log to be unlocked once closed but got: %s", err.Error())
+	}
+	storage.Close()
+}
@@ -0,0 +1,11 @@
+//go:build !unix
+
+package disk
+
+import "os"
+
+// lockFile does nothing where flock is not available, leaving the log
+// unprotected from other processes.
+func lockFile(file *os.File) error {
+	return nil
+}
@@ -0,0 +1,182 @@
+package memory
+
+import (
+	"sort"
+	"time"
+	"urlshort"
+)
+
+// Links holds links, indexed by url, and API keys in memory. It is the state of
+// the in-memory storage and of the disk storage, which only adds a log of the
+// changes made to it. Links is not safe for concurrent use: its owner must guard
+// it with a lock.
+type Links struct {
+	entries map[string]urlshort.Link
+	// index maps the NormalizeURL form of urls to the last key they were saved under
+	index   map[string]string
+	apiKeys map[string]urlshort.APIKey
+}
+
+// NewLinks returns empty Links.
+func NewLinks() *Links {
+	return &Links{
+		entries: make(map[string]urlshort.Link),
+		index:   make(map[string]string),
+		apiKeys: make(map[string]urlshort.APIKey),
+	}
+}
+
+func expired(link urlshort.Link, now time.Time) bool {
+	return !link.ExpiresAt.IsZero() && !now.Before(link.ExpiresAt)
+}
+
+// forgotten reports whether link expired more than urlshort.ExpiredRetention ago.
+func forgotten(link urlshort.Link, now time.Time) bool {
+	return !link.ExpiresAt.IsZero() && !now.Before(link.ExpiresAt.Add(urlshort.ExpiredRetention))
+}
+
+// sameSettings reports whether a redirects like b would, telling Unique whether
+// it can be reused for it.
+func sameSettings(a, b urlshort.Link) bool {
+	return a.Status == b.Status && a.Query == b.Query && a.Preview == b.Preview && a.CreatedBy == b.CreatedBy
+}
+
+// Len returns the number of links held, expired ones included.
+func (l *Links) Len() int {
+	return len(l.entries)
+}
+
+// Get returns the link saved under key. It returns urlshort.ErrMissingKey if
+// there is none or it is forgotten and urlshort.ErrExpiredKey if it expired.
+func (l *Links) Get(key string, now time.Time) (urlshort.Link, error) {
+	link, ok := l.entries[key]
+	if !ok || forgotten(link, now) {
+		return urlshort.Link{}, urlshort.ErrMissingKey
+	}
+	if expired(link, now) {
+		return urlshort.Link{}, urlshort.ErrExpiredKey
+	}
+	return link, nil
+}
+
+// Exists reports whether a link that has not expired is saved under key.
+func (l *Links) Exists(key string, now time.Time) bool {
+	link, ok := l.entries[key]
+	return ok && !expired(link, now)
+}
+
+// Unique returns the link that has not expired and was last saved for the url of
+// link with the same settings, if any.
+func (l *Links) Unique(link urlshort.Link, now time.Time) (urlshort.Link, bool) {
+	normalized := urlshort.NormalizeURL(link.URL)
+	key, ok := l.index[normalized]
+	if !ok {
+		return urlshort.Link{}, false
+	}
+	existing, ok := l.entries[key]
+	if !ok || urlshort.NormalizeURL(existing.URL) != normalized || !sameSettings(existing, link) || expired(existing, now) {
+		return urlshort.Link{}, false
+	}
+	return existing, true
+}
+
+// Set stores link under its key, replacing any link saved there, and indexes its url.
+func (l *Links) Set(link urlshort.Link) {
+	if old, ok := l.entries[link.Key]; ok && l.index[urlshort.NormalizeURL(old.URL)] == link.Key {
+		delete(l.index, urlshort.NormalizeURL(old.URL))
+	}
+	l.entries[link.Key] = link
+	l.index[urlshort.NormalizeURL(link.URL)] = link.Key
+}
+
+// Remove deletes the link saved under key and its index entry.
+func (l *Links) Remove(key string) {
+	if link, ok := l.entries[key]; ok && l.index[urlshort.NormalizeURL(link.URL)] == key {
+		delete(l.index, urlshort.NormalizeURL(link.URL))
+	}
+	delete(l.entries, key)
+}
+
+// Forgotten reports whether the link saved under key expired more than
+// urlshort.ExpiredRetention ago, so Get reports it missing.
+func (l *Links) Forgotten(key string, now time.Time) bool {
+	link, ok := l.entries[key]
+	return ok && forgotten(link, now)
+}
+
+// Forget deletes the link saved under key if it is forgotten.
+func (l *Links) Forget(key string, now time.Time) {
+	if l.Forgotten(key, now) {
+		l.Remove(key)
+	}
+}
+
+// Sweep deletes every forgotten link.
+func (l *Links) Sweep(now time.Time) {
+	for key, link := range l.entries {
+		if forgotten(link, now) {
+			l.Remove(key)
+		}
+	}
+}
+
+// All returns every link held, expired ones included, in no particular order.
+func (l *Links) All() []urlshort.Link {
+	links := make([]urlshort.Link, 0, len(l.entries))
+	for _, link := range l.entries {
+		links = append(links, link)
+	}
+	return links
+}
+
+// List returns at most count links that have not expired ordered by key,
+// starting after cursor, along with the cursor of the next page or "" if it
+// is the last one.
+func (l *Links) List(cursor string, count int, now time.Time) ([]urlshort.Link, string) {
+	keys := make([]string, 0, len(l.entries))
+	for key, link := range l.entries {
+		if key > cursor && !expired(link, now) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	next := ""
+	if len(keys) > count {
+		keys = keys[:count]
+		next = keys[count-1]
+	}
+	links := make([]urlshort.Link, len(keys))
+	for i, key := range keys {
+		links[i] = l.entries[key]
+	}
+	return links, next
+}
+
+// NumAPIKeys returns the number of API keys held.
+func (l *Links) NumAPIKeys() int {
+	return len(l.apiKeys)
+}
+
+// SetAPIKey stores key, replacing any key with the same id.
+func (l *Links) SetAPIKey(key urlshort.APIKey) {
+	l.apiKeys[key.ID] = key
+}
+
+// GetAPIKey returns the API key with the given id or urlshort.ErrMissingAPIKey.
+func (l *Links) GetAPIKey(id string) (urlshort.APIKey, error) {
+	key, ok := l.apiKeys[id]
+	if !ok {
+		return urlshort.APIKey{}, urlshort.ErrMissingAPIKey
+	}
+	return key, nil
+}
+
+// APIKeys returns every API key held in no particular order.
+func (l *Links) APIKeys() []urlshort.APIKey {
+	keys := make([]urlshort.APIKey, 0, len(l.apiKeys))
+	for _, key := range l.apiKeys {
+		keys = append(keys, key)
+	}
+	return keys
+}
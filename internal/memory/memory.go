@@ -0,0 +1,145 @@
+package memory
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+	"urlshort"
+)
+
+type store struct {
+	mu    sync.RWMutex
+	links *Links
+	now   func() time.Time
+	// sweepAt is the number of entries at which forgotten entries are next purged,
+	// so keys that are never read again don't accumulate forever.
+	sweepAt int
+	counter uint64
+}
+
+const minSweepAt = 1024
+
+// New returns an in-memory storage safe for concurrent use. Expired entries are
+// kept for urlshort.ExpiredRetention so Get can tell them apart from missing ones.
+func New() *store {
+	return &store{
+		links:   NewLinks(),
+		now:     time.Now,
+		sweepAt: minSweepAt,
+	}
+}
+
+func (s *store) Save(ctx context.Context, link urlshort.Link) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.save(link)
+}
+
+func (s *store) SaveUnique(ctx context.Context, link urlshort.Link) (urlshort.Link, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if existing, ok := s.links.Unique(link, s.now()); ok {
+		return existing, nil
+	}
+	if err := s.save(link); err != nil {
+		return urlshort.Link{}, err
+	}
+	return link, nil
+}
+
+// save stores link unless its key is taken by a link that has not expired.
+// Callers must hold the write lock.
+func (s *store) save(link urlshort.Link) error {
+	now := s.now()
+	if s.links.Exists(link.Key, now) {
+		return urlshort.ErrKeyExists
+	}
+	s.links.Set(link)
+	if s.links.Len() >= s.sweepAt {
+		s.links.Sweep(now)
+		s.sweepAt = 2 * s.links.Len()
+		if s.sweepAt < minSweepAt {
+			s.sweepAt = minSweepAt
+		}
+	}
+	return nil
+}
+
+func (s *store) Get(ctx context.Context, key string) (urlshort.Link, error) {
+	now := s.now()
+	s.mu.RLock()
+	link, err := s.links.Get(key, now)
+	forgotten := s.links.Forgotten(key, now)
+	s.mu.RUnlock()
+	if forgotten {
+		s.mu.Lock()
+		s.links.Forget(key, now)
+		s.mu.Unlock()
+	}
+	return link, err
+}
+
+func (s *store) Delete(ctx context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	exists := s.links.Exists(key, s.now())
+	s.links.Remove(key)
+	if !exists {
+		return urlshort.ErrMissingKey
+	}
+	return nil
+}
+
+func (s *store) Update(ctx context.Context, key string, url string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	link, err := s.links.Get(key, s.now())
+	if err != nil {
+		return urlshort.ErrMissingKey
+	}
+	link.URL = url
+	s.links.Set(link)
+	return nil
+}
+
+func (s *store) Exists(ctx context.Context, key string) (bool, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.links.Exists(key, s.now()), nil
+}
+
+func (s *store) IncrementKeyCounter(ctx context.Context) (uint64, error) {
+	return atomic.AddUint64(&s.counter, 1), nil
+}
+
+// List returns links ordered by key; the cursor is the last key of the previous page.
+func (s *store) List(ctx context.Context, cursor string, count int) ([]urlshort.Link, string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	links, next := s.links.List(cursor, count, s.now())
+	return links, next, nil
+}
+
+func (s *store) SaveAPIKey(ctx context.Context, key urlshort.APIKey) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.links.SetAPIKey(key)
+	return nil
+}
+
+func (s *store) GetAPIKey(ctx context.Context, id string) (urlshort.APIKey, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.links.GetAPIKey(id)
+}
+
+func (s *store) ListAPIKeys(ctx context.Context) ([]urlshort.APIKey, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.links.APIKeys(), nil
+}
@@ -0,0 +1,302 @@
+package memory
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+	"urlshort"
+)
+
+func TestSaveAndGet(t *testing.T) {
+	storage := New()
+
+	myLink := urlshort.Link{Key: "my-key", URL: "http://www.google.com", Status: 302, Query: urlshort.QueryOverride, Preview: true, ExpiresAt: time.Now().Add(time.Hour), CreatedAt: time.Now()}
+	if err := storage.Save(context.Background(), myLink); err != nil {
+		t.Fatalf("error was not expected but got: %s", err.Error())
+	}
+
+	myRetrievedLink, err := storage.Get(context.Background(), myLink.Key)
+	if err != nil {
+		t.Fatalf("error was not expected but got: %s", err.Error())
+	}
+	if myRetrievedLink != myLink {
+		t.Fatalf("expected link %v but got %v", myLink, myRetrievedLink)
+	}
+
+	if err = storage.Save(context.Background(), urlshort.Link{Key: myLink.Key, URL: "http://www.example.com"}); !errors.Is(err, urlshort.ErrKeyExists) {
+		t.Fatalf("expected ErrKeyExists but got: %v", err)
+	}
+
+	if _, err = storage.Get(context.Background(), "other-key"); !errors.Is(err, urlshort.ErrMissingKey) {
+		t.Fatalf("expected ErrMissingKey but got: %v", err)
+	}
+}
+
+func TestExpiration(t *testing.T) {
+	now := time.Now()
+	storage := New()
+	storage.now = func() time.Time { return now }
+
+	myKey := "my-key"
+	if err := storage.Save(context.Background(), urlshort.Link{Key: myKey, URL: "http://www.google.com", ExpiresAt: now.Add(10 * time.Minute)}); err != nil {
+		t.Fatalf("error was not expected but got: %s", err.Error())
+	}
+
+	now = now.Add(9 * time.Minute)
+	if _, err := storage.Get(context.Background(), myKey); err != nil {
+		t.Fatalf("error was not expected but got: %s", err.Error())
+	}
+
+	now = now.Add(time.Minute)
+	if _, err := storage.Get(context.Background(), myKey); !errors.Is(err, urlshort.ErrExpiredKey) {
+		t.Fatalf("expected ErrExpiredKey but got: %v", err)
+	}
+	if ok, _ := storage.Exists(context.Background(), myKey); ok {
+		t.Fatalf("expected expired key not to exist")
+	}
+
+	now = now.Add(urlshort.ExpiredRetention)
+	if _, err := storage.Get(context.Background(), myKey); !errors.Is(err, urlshort.ErrMissingKey) {
+		t.Fatalf("expected ErrMissingKey but got: %v", err)
+	}
+}
+
+func TestSaveOverExpired(t *testing.T) {
+	now := time.Now()
+	storage := New()
+	storage.now = func() time.Time { return now }
+
+	if err := storage.Save(context.Background(), urlshort.Link{Key: "my-key", URL: "http://www.google.com", ExpiresAt: now.Add(time.Minute)}); err != nil {
+		t.Fatalf("error was not expected but got: %s", err.Error())
+	}
+	now = now.Add(time.Minute)
+	if err := storage.Save(context.Background(), urlshort.Link{Key: "my-key", URL: "http://www.example.com"}); err != nil {
+		t.Fatalf("expired key should be reusable but got: %s", err.Error())
+	}
+	if link, err := storage.Get(context.Background(), "my-key"); err != nil || link.URL != "http://www.example.com" {
+		t.Fatalf("expected reused key to point to the new url, got %v, %v", link, err)
+	}
+}
+
+func TestNoExpiration(t *testing.T) {
+	now := time.Now()
+	storage := New()
+	storage.now = func() time.Time { return now }
+
+	if err := storage.Save(context.Background(), urlshort.Link{Key: "my-key", URL: "http://www.google.com"}); err != nil {
+		t.Fatalf("error was not expected but got: %s", err.Error())
+	}
+	now = now.Add(24 * 365 * time.Hour)
+	if _, err := storage.Get(context.Background(), "my-key"); err != nil {
+		t.Fatalf("error was not expected but got: %s", err.Error())
+	}
+}
+
+func TestConcurrentSave(t *testing.T) {
+	storage := New()
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	saved := 0
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			err := storage.Save(context.Background(), urlshort.Link{Key: "same-key", URL: fmt.Sprintf("http://www.google.com/%d", i)})
+			if err == nil {
+				mu.Lock()
+				saved++
+				mu.Unlock()
+			} else if !errors.Is(err, urlshort.ErrKeyExists) {
+				t.Errorf("unexpected error: %v", err)
+			}
+			storage.Get(context.Background(), "same-key")
+		}(i)
+	}
+	wg.Wait()
+
+	if saved != 1 {
+		t.Fatalf("expected exactly one successful save, got %d", saved)
+	}
+}
+
+func TestSweepExpired(t *testing.T) {
+	now := time.Now()
+	storage := New()
+	storage.now = func() time.Time { return now }
+
+	for i := 0; i < minSweepAt-1; i++ {
+		if err := storage.Save(context.Background(), urlshort.Link{Key: fmt.Sprintf("key-%d", i), URL: "http://www.google.com", ExpiresAt: now.Add(time.Minute)}); err != nil {
+			t.Fatalf("error was not expected but got: %s", err.Error())
+		}
+	}
+	now = now.Add(time.Minute + urlshort.ExpiredRetention)
+	if err := storage.Save(context.Background(), urlshort.Link{Key: "fresh-key", URL: "http://www.google.com"}); err != nil {
+		t.Fatalf("error was not expected but got: %s", err.Error())
+	}
+	if storage.links.Len() != 1 {
+		t.Fatalf("expected forgotten entries to be swept, got %d entries", storage.links.Len())
+	}
+}
+
+func TestDeleteUpdateExists(t *testing.T) {
+	storage := New()
+	ctx := context.Background()
+
+	if err := storage.Save(ctx, urlshort.Link{Key: "my-key", URL: "http://www.google.com"}); err != nil {
+		t.Fatalf("error was not expected but got: %s", err.Error())
+	}
+	if ok, _ := storage.Exists(ctx, "my-key"); !ok {
+		t.Fatalf("expected key to exist")
+	}
+
+	if err := storage.Update(ctx, "my-key", "http://www.example.com"); err != nil {
+		t.Fatalf("error was not expected but got: %s", err.Error())
+	}
+	if link, _ := storage.Get(ctx, "my-key"); link.URL != "http://www.example.com" {
+		t.Fatalf("expected updated url but got %s", link.URL)
+	}
+	if err := storage.Update(ctx, "other-key", "http://www.example.com"); !errors.Is(err, urlshort.ErrMissingKey) {
+		t.Fatalf("expected ErrMissingKey but got: %v", err)
+	}
+
+	if err := storage.Delete(ctx, "my-key"); err != nil {
+		t.Fatalf("error was not expected but got: %s", err.Error())
+	}
+	if ok, _ := storage.Exists(ctx, "my-key"); ok {
+		t.Fatalf("expected key to be deleted")
+	}
+	if err := storage.Delete(ctx, "my-key"); !errors.Is(err, urlshort.ErrMissingKey) {
+		t.Fatalf("expected ErrMissingKey but got: %v", err)
+	}
+}
+
+func TestList(t *testing.T) {
+	storage := New()
+	ctx := context.Background()
+
+	for i := 0; i < 25; i++ {
+		if err := storage.Save(ctx, urlshort.Link{Key: fmt.Sprintf("key-%02d", i), URL: "http://www.google.com"}); err != nil {
+			t.Fatalf("error was not expected but got: %s", err.Error())
+		}
+	}
+
+	seen := make(map[string]bool)
+	cursor := ""
+	pages := 0
+	for {
+		links, next, err := storage.List(ctx, cursor, 10)
+		if err != nil {
+			t.Fatalf("error was not expected but got: %s", err.Error())
+		}
+		pages++
+		for _, link := range links {
+			if seen[link.Key] {
+				t.Fatalf("key %s listed twice", link.Key)
+			}
+			seen[link.Key] = true
+		}
+		if next == "" {
+			break
+		}
+		cursor = next
+	}
+	if len(seen) != 25 || pages != 3 {
+		t.Fatalf("expected 25 keys in 3 pages, got %d keys in %d pages", len(seen), pages)
+	}
+}
+
+func TestIncrementKeyCounter(t *testing.T) {
+	storage := New()
+	for want := uint64(1); want <= 3; want++ {
+		n, err := storage.IncrementKeyCounter(context.Background())
+		if err != nil {
+			t.Fatalf("error was not expected but got: %s", err.Error())
+		}
+		if n != want {
+			t.Fatalf("expected counter %d but got %d", want, n)
+		}
+	}
+}
+
+func TestSaveUnique(t *testing.T) {
+	now := time.Now()
+	storage := New()
+	storage.now = func() time.Time { return now }
+	ctx := context.Background()
+	expiresAt := now.Add(10 * time.Minute)
+
+	link, err := storage.SaveUnique(ctx, urlshort.Link{Key: "first", URL: "HTTP://WWW.Google.com:80", ExpiresAt: expiresAt})
+	if err != nil || link.Key != "first" {
+		t.Fatalf("expected key first, got %q, %v", link.Key, err)
+	}
+	link, err = storage.SaveUnique(ctx, urlshort.Link{Key: "second", URL: "http://www.google.com/"})
+	if err != nil || link.Key != "first" || link.URL != "HTTP://WWW.Google.com:80" || !link.ExpiresAt.Equal(expiresAt) {
+		t.Fatalf("expected existing link first with the url as submitted, got %v, %v", link, err)
+	}
+	if ok, _ := storage.Exists(ctx, "second"); ok {
+		t.Fatalf("expected duplicate not to be saved")
+	}
+	link, err = storage.SaveUnique(ctx, urlshort.Link{Key: "temporary", URL: "http://www.google.com/", Status: 302})
+	if err != nil || link.Key != "temporary" {
+		t.Fatalf("expected a link with another status to be saved, got %q, %v", link.Key, err)
+	}
+	storage.Delete(ctx, "temporary")
+	link, err = storage.SaveUnique(ctx, urlshort.Link{Key: "temporary", URL: "http://www.google.com/", Preview: true})
+	if err != nil || link.Key != "temporary" {
+		t.Fatalf("expected a link with a preview to be saved, got %q, %v", link.Key, err)
+	}
+	storage.Delete(ctx, "temporary")
+	link, err = storage.SaveUnique(ctx, urlshort.Link{Key: "temporary", URL: "http://www.google.com/", CreatedBy: "apikey01"})
+	if err != nil || link.Key != "temporary" || link.CreatedBy != "apikey01" {
+		t.Fatalf("expected a link created with an api key to be saved, got %v, %v", link, err)
+	}
+	storage.Delete(ctx, "temporary")
+	if _, err = storage.SaveUnique(ctx, urlshort.Link{Key: "first", URL: "http://www.example.com/"}); !errors.Is(err, urlshort.ErrKeyExists) {
+		t.Fatalf("expected ErrKeyExists but got: %v", err)
+	}
+
+	if err = storage.Update(ctx, "first", "http://www.example.com/"); err != nil {
+		t.Fatalf("error was not expected but got: %s", err.Error())
+	}
+	link, err = storage.SaveUnique(ctx, urlshort.Link{Key: "third", URL: "http://www.google.com/", ExpiresAt: expiresAt})
+	if err != nil || link.Key != "third" {
+		t.Fatalf("expected updated link not to be reused, got %q, %v", link.Key, err)
+	}
+
+	now = expiresAt
+	link, err = storage.SaveUnique(ctx, urlshort.Link{Key: "fourth", URL: "http://www.google.com/"})
+	if err != nil || link.Key != "fourth" {
+		t.Fatalf("expected expired link not to be reused, got %q, %v", link.Key, err)
+	}
+}
+
+func TestAPIKeys(t *testing.T) {
+	storage := New()
+	ctx := context.Background()
+
+	key, _, err := urlshort.GenerateAPIKey(ctx, "posters")
+	if err != nil {
+		t.Fatalf("error was not expected but got: %s", err.Error())
+	}
+	if err = storage.SaveAPIKey(ctx, key); err != nil {
+		t.Fatalf("error was not expected but got: %s", err.Error())
+	}
+	if stored, err := storage.GetAPIKey(ctx, key.ID); err != nil || stored != key {
+		t.Fatalf("expected key %v but got %v, %v", key, stored, err)
+	}
+	if _, err = storage.GetAPIKey(ctx, "other"); !errors.Is(err, urlshort.ErrMissingAPIKey) {
+		t.Fatalf("expected ErrMissingAPIKey but got: %v", err)
+	}
+
+	if err = urlshort.RevokeAPIKey(ctx, storage, key.ID); err != nil {
+		t.Fatalf("error was not expected but got: %s", err.Error())
+	}
+	keys, err := storage.ListAPIKeys(ctx)
+	if err != nil || len(keys) != 1 || keys[0].ID != key.ID || !keys[0].Revoked() {
+		t.Fatalf("expected the revoked key to be listed, got %v, %v", keys, err)
+	}
+}
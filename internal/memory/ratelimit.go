@@ -0,0 +1,73 @@
+package memory
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+	"urlshort"
+)
+
+type bucket struct {
+	tokens  float64
+	updated time.Time
+	// full is when the bucket is full again, and can be dropped like a bucket never used
+	full time.Time
+}
+
+type rateLimiter struct {
+	mu      sync.Mutex
+	buckets map[string]bucket
+	now     func() time.Time
+	// sweepAt is the number of buckets at which full ones are next dropped.
+	sweepAt int
+}
+
+// NewRateLimiter returns an in-memory urlshort.RateLimiter safe for concurrent
+// use. Its buckets are not shared with other instances of the application.
+func NewRateLimiter() *rateLimiter {
+	return &rateLimiter{
+		buckets: make(map[string]bucket),
+		now:     time.Now,
+		sweepAt: minSweepAt,
+	}
+}
+
+func (l *rateLimiter) Allow(ctx context.Context, key string, limit urlshort.RateLimit) (bool, time.Duration, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	b, ok := l.buckets[key]
+	if !ok {
+		b = bucket{tokens: float64(limit.Burst), updated: now}
+	}
+	if elapsed := now.Sub(b.updated); elapsed > 0 {
+		b.tokens = math.Min(float64(limit.Burst), b.tokens+elapsed.Seconds()*limit.Rate)
+		b.updated = now
+	}
+	if b.tokens < 1 {
+		l.buckets[key] = b
+		return false, time.Duration(math.Ceil((1 - b.tokens) / limit.Rate * float64(time.Second))), nil
+	}
+	b.tokens--
+	b.full = now.Add(time.Duration((float64(limit.Burst) - b.tokens) / limit.Rate * float64(time.Second)))
+	l.buckets[key] = b
+	if len(l.buckets) >= l.sweepAt {
+		l.sweep(now)
+	}
+	return true, 0, nil
+}
+
+// sweep drops the buckets that are full again. Callers must hold the lock.
+func (l *rateLimiter) sweep(now time.Time) {
+	for key, b := range l.buckets {
+		if !now.Before(b.full) {
+			delete(l.buckets, key)
+		}
+	}
+	l.sweepAt = 2 * len(l.buckets)
+	if l.sweepAt < minSweepAt {
+		l.sweepAt = minSweepAt
+	}
+}
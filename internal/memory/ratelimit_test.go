@@ -0,0 +1,65 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+	"urlshort"
+)
+
+func TestRateLimiter(t *testing.T) {
+	now := time.Now()
+	limiter := NewRateLimiter()
+	limiter.now = func() time.Time { return now }
+	ctx := context.Background()
+	limit := urlshort.RateLimit{Name: "create", Rate: 2, Burst: 3}
+
+	for i := 0; i < 3; i++ {
+		if allowed, _, err := limiter.Allow(ctx, "client", limit); err != nil || !allowed {
+			t.Fatalf("expected request %d of the burst to be allowed, got %v, %v", i, allowed, err)
+		}
+	}
+	allowed, retryAfter, err := limiter.Allow(ctx, "client", limit)
+	if err != nil || allowed || retryAfter != 500*time.Millisecond {
+		t.Fatalf("expected request to be denied for 500ms, got %v, %v, %v", allowed, retryAfter, err)
+	}
+	if allowed, _, _ = limiter.Allow(ctx, "other", limit); !allowed {
+		t.Fatalf("expected another client to have its own bucket")
+	}
+
+	now = now.Add(250 * time.Millisecond)
+	if allowed, retryAfter, _ = limiter.Allow(ctx, "client", limit); allowed || retryAfter != 250*time.Millisecond {
+		t.Fatalf("expected request to be denied for 250ms, got %v, %v", allowed, retryAfter)
+	}
+	now = now.Add(250 * time.Millisecond)
+	if allowed, _, _ = limiter.Allow(ctx, "client", limit); !allowed {
+		t.Fatalf("expected a refilled token to be allowed")
+	}
+	now = now.Add(time.Hour)
+	for i := 0; i < 3; i++ {
+		if allowed, _, _ = limiter.Allow(ctx, "client", limit); !allowed {
+			t.Fatalf("expected request %d to be allowed by a bucket refilled up to its burst", i)
+		}
+	}
+	if allowed, _, _ = limiter.Allow(ctx, "client", limit); allowed {
+		t.Fatalf("expected the bucket not to hold more than its burst")
+	}
+}
+
+func TestRateLimiterSweep(t *testing.T) {
+	now := time.Now()
+	limiter := NewRateLimiter()
+	limiter.now = func() time.Time { return now }
+	ctx := context.Background()
+	limit := urlshort.RateLimit{Name: "redirect", Rate: 1, Burst: 10}
+
+	for i := 0; i < minSweepAt-1; i++ {
+		limiter.Allow(ctx, fmt.Sprintf("client-%d", i), limit)
+	}
+	now = now.Add(time.Second)
+	limiter.Allow(ctx, "recent", limit)
+	if len(limiter.buckets) != 1 {
+		t.Fatalf("expected full buckets to be dropped, got %d buckets", len(limiter.buckets))
+	}
+}
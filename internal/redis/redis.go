@@ -2,26 +2,205 @@ package redis
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
 	"fmt"
+	"strconv"
+	"strings"
 	"time"
 	"urlshort"
 
 	"github.com/redis/go-redis/v9"
 )
 
+// linkPrefix namespaces the keys holding shortened urls so they can be
+// enumerated without picking up anything else stored in the database.
+const linkPrefix = "link:"
+
+// keyCounterKey holds the counter used by sequential key generators.
+const keyCounterKey = "counter:keys"
+
+// urlIndexPrefix namespaces the reverse index from the hash of the NormalizeURL
+// form of a url to its key and the url as saved, separated by a newline.
+const urlIndexPrefix = "urlindex:"
+
+// expiredPrefix namespaces the markers left behind by expiring links, so
+// requests for them can be told apart from requests for keys never stored.
+const expiredPrefix = "expired:"
+
+// clickTotalPrefix and clickDailyPrefix namespace the click counters of a key:
+// its total and a hash from ClickDateFormat dates to the clicks of that day.
+const (
+	clickTotalPrefix = "clicks:total:"
+	clickDailyPrefix = "clicks:daily:"
+)
+
+// settingsPrefix namespaces the hashes holding what is stored about a link
+// besides its url, in the fields listed in settingsFields: the redirect status,
+// query policy and preview of the links saved with their own, the creation
+// time, as unix ms, of the links that know it and the id of the API key of the
+// links created with one.
+const settingsPrefix = "settings:"
+
+// settingsFields are the fields of the settings hashes read by Get and List.
+var settingsFields = []string{"status", "query", "preview", "created", "creator"}
+
+// apiKeyPrefix namespaces the hashes holding API keys by id, in the fields
+// name, hash, created and revoked, the times as unix ms.
+const apiKeyPrefix = "apikey:"
+
+// saveLinkScript saves url under the new key, expiring it at the given time, and
+// leaves a marker behind that outlives it by urlshort.ExpiredRetention. The
+// redirect status, query policy, preview, creation time and creator, if any, are saved
+// alongside with the same expiration. Click counters and settings left by a
+// previous link under the same key are reset. It returns 0 if the new key is already taken.
+//
+// KEYS[1] link key, KEYS[2] expired marker key, KEYS[3] and KEYS[4] click counter
+// keys, KEYS[5] settings key; ARGV[1] url, ARGV[2] expiration as unix ms or 0,
+// ARGV[3] marker expiration as unix ms, ARGV[4] redirect status or 0, ARGV[5]
+// query policy or empty, ARGV[6] preview as 1 or 0, ARGV[7] creation time as
+// unix ms or 0, ARGV[8] API key id or empty.
+const saveLinkScript = `
+local saved
+if ARGV[2] == '0' then
+	saved = redis.call('SET', KEYS[1], ARGV[1], 'NX')
+else
+	saved = redis.call('SET', KEYS[1], ARGV[1], 'NX', 'PXAT', ARGV[2])
+end
+if not saved then
+	return 0
+end
+redis.call('DEL', KEYS[2], KEYS[3], KEYS[4], KEYS[5])
+if ARGV[2] ~= '0' then
+	redis.call('SET', KEYS[2], '1', 'PXAT', ARGV[3])
+end
+if ARGV[4] ~= '0' then
+	redis.call('HSET', KEYS[5], 'status', ARGV[4])
+end
+if ARGV[5] ~= '' then
+	redis.call('HSET', KEYS[5], 'query', ARGV[5])
+end
+if ARGV[6] ~= '0' then
+	redis.call('HSET', KEYS[5], 'preview', ARGV[6])
+end
+if ARGV[7] ~= '0' then
+	redis.call('HSET', KEYS[5], 'created', ARGV[7])
+end
+if ARGV[8] ~= '' then
+	redis.call('HSET', KEYS[5], 'creator', ARGV[8])
+end
+if ARGV[2] ~= '0' then
+	redis.call('PEXPIREAT', KEYS[5], ARGV[2])
+end
+`
+
+// saveScript saves a link with saveLinkScript, returning 1, or 0 if the new key
+// is already taken.
+var saveScript = redis.NewScript(saveLinkScript + `
+return 1
+`)
+
+// saveUniqueScript returns the remaining ttl in ms and the creation time of the
+// link SaveUnique found in the index, if it still holds the indexed url and has
+// the same status, query policy, preview and creator, or saves url like
+// saveScript and indexes it with the same expiration, returning 1, or returns 0
+// if the new key is already taken.
+//
+// KEYS and ARGV are those of saveLinkScript followed by KEYS[6] index key and,
+// when the index holds a key, KEYS[7] its link key and KEYS[8] its settings key;
+// ARGV[9] new index entry, ARGV[10] url indexed under the key held.
+var saveUniqueScript = redis.NewScript(`
+if KEYS[7] and redis.call('GET', KEYS[7]) == ARGV[10] then
+	local settings = redis.call('HMGET', KEYS[8], 'status', 'query', 'preview', 'created', 'creator')
+	if (settings[1] or '0') == ARGV[4] and (settings[2] or '') == ARGV[5] and (settings[3] or '0') == ARGV[6] and (settings[5] or '') == ARGV[8] then
+		return {redis.call('PTTL', KEYS[7]), settings[4] or '0'}
+	end
+end
+` + saveLinkScript + `
+if ARGV[2] == '0' then
+	redis.call('SET', KEYS[6], ARGV[9])
+else
+	redis.call('SET', KEYS[6], ARGV[9], 'PXAT', ARGV[2])
+end
+return 1
+`)
+
+// maxSaveUniqueAttempts is how many times SaveUnique reads the index before
+// giving up on it being changed concurrently.
+const maxSaveUniqueAttempts = 10
+
+// recordClickScript increments the total and the daily clicks of a key, making
+// them expire with its expired marker, so the counters of expiring links don't
+// outlive them.
+//
+// KEYS[1] and KEYS[2] click counter keys, KEYS[3] expired marker key; ARGV[1]
+// date of the click formatted with urlshort.ClickDateFormat.
+var recordClickScript = redis.NewScript(`
+redis.call('INCR', KEYS[1])
+redis.call('HINCRBY', KEYS[2], ARGV[1], 1)
+local ttl = redis.call('PTTL', KEYS[3])
+if ttl > 0 then
+	redis.call('PEXPIRE', KEYS[1], ttl)
+	redis.call('PEXPIRE', KEYS[2], ttl)
+end
+return 1
+`)
+
+// moveLegacyLinkScript moves a link stored under its bare key, as links were
+// before linkPrefix, under linkPrefix, keeping its ttl. It returns 1 if it was
+// moved and 0 if a link is already stored under linkPrefix or the bare key no
+// longer holds a string.
+//
+// KEYS[1] bare key, KEYS[2] link key.
+var moveLegacyLinkScript = redis.NewScript(`
+if redis.call('TYPE', KEYS[1]).ok ~= 'string' then
+	return 0
+end
+return redis.call('RENAMENX', KEYS[1], KEYS[2])
+`)
+
+// rateLimitPrefix namespaces the hashes holding the token buckets of rate
+// limits, in the fields tokens and updated, the latter as unix ms.
+const rateLimitPrefix = "ratelimit:"
+
+// allowScript takes a token from a token bucket, refilling it for the time
+// elapsed since it was last updated according to the clock of Redis, shared by
+// every instance. The bucket starts full and expires once it would be full
+// again. It returns 1 and 0 if there was a token or 0 and the ms until there is.
+//
+// KEYS[1] bucket key; ARGV[1] rate in tokens per second, ARGV[2] burst.
+var allowScript = redis.NewScript(`
+local rate = tonumber(ARGV[1])
+local burst = tonumber(ARGV[2])
+local time = redis.call('TIME')
+local now = tonumber(time[1]) * 1000 + math.floor(tonumber(time[2]) / 1000)
+local bucket = redis.call('HMGET', KEYS[1], 'tokens', 'updated')
+local tokens = tonumber(bucket[1]) or burst
+local updated = tonumber(bucket[2]) or now
+if now > updated then
+	tokens = math.min(burst, tokens + (now - updated) * rate / 1000)
+	updated = now
+end
+if tokens < 1 then
+	return {0, math.ceil((1 - tokens) * 1000 / rate)}
+end
+tokens = tokens - 1
+redis.call('HSET', KEYS[1], 'tokens', tostring(tokens), 'updated', updated)
+redis.call('PEXPIRE', KEYS[1], math.ceil((burst - tokens) * 1000 / rate))
+return {1, 0}
+`)
+
 type client struct {
 	*redis.Client
-	expirationMinutes int
 }
 
 type Options struct {
-	Host              string
-	Port              string
-	Username          string
-	Password          string
-	DB                int
-	ExpirationMinutes int
+	Host     string
+	Port     string
+	Username string
+	Password string
+	DB       int
 }
 
 func New(opts *Options) *client {
@@ -32,26 +211,438 @@ func New(opts *Options) *client {
 		DB:       opts.DB,
 	})
 	return &client{
-		Client:            r,
-		expirationMinutes: opts.ExpirationMinutes,
+		Client: r,
 	}
 }
 
-func (c *client) Save(ctx context.Context, key string, url string) error {
-	cmd := c.Client.SetNX(ctx, key, url, time.Duration(c.expirationMinutes)*time.Minute)
-	if cmd.Err() != nil {
-		return cmd.Err()
+// linkKeys returns the keys holding key and everything stored alongside it: its
+// expired marker, its click counters and its settings.
+func linkKeys(key string) []string {
+	return []string{linkPrefix + key, expiredPrefix + key, clickTotalPrefix + key, clickDailyPrefix + key, settingsPrefix + key}
+}
+
+// expirationArgs returns the expiration of link and of its expired marker as
+// unix ms, the former being 0 when link never expires.
+func expirationArgs(link urlshort.Link) (int64, int64) {
+	if link.ExpiresAt.IsZero() {
+		return 0, 0
+	}
+	return link.ExpiresAt.UnixMilli(), link.ExpiresAt.Add(urlshort.ExpiredRetention).UnixMilli()
+}
+
+// linkArgs returns the ARGV of saveLinkScript for link.
+func linkArgs(link urlshort.Link) []interface{} {
+	expiresAt, markerExpiresAt := expirationArgs(link)
+	preview := 0
+	if link.Preview {
+		preview = 1
+	}
+	var createdAt int64
+	if !link.CreatedAt.IsZero() {
+		createdAt = link.CreatedAt.UnixMilli()
+	}
+	return []interface{}{link.URL, expiresAt, markerExpiresAt, link.Status, string(link.Query), preview, createdAt, link.CreatedBy}
+}
+
+// parseUnixMilli parses a time stored as unix ms.
+func parseUnixMilli(value string) (time.Time, error) {
+	ms, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return time.UnixMilli(ms), nil
+}
+
+// expiresAtFromTTL converts the remaining time to live of a key into its
+// expiration time, the zero time for keys without one, whose ttl is negative.
+func expiresAtFromTTL(ttl time.Duration) time.Time {
+	if ttl < 0 {
+		return time.Time{}
+	}
+	return time.Now().Add(ttl)
+}
+
+func (c *client) Save(ctx context.Context, link urlshort.Link) error {
+	saved, err := saveScript.Run(ctx, c.Client, linkKeys(link.Key), linkArgs(link)...).Int()
+	if err != nil {
+		return err
+	}
+	if saved == 0 {
+		return urlshort.ErrKeyExists
+	}
+	return nil
+}
+
+// SaveUnique reads the reverse index of the url in an optimistic transaction,
+// then checks the link it points to and saves the new one, along with its index
+// entry, atomically with a Lua script, retrying when the index changes meanwhile.
+func (c *client) SaveUnique(ctx context.Context, link urlshort.Link) (urlshort.Link, error) {
+	normalized := urlshort.NormalizeURL(link.URL)
+	sum := sha256.Sum256([]byte(normalized))
+	indexKey := urlIndexPrefix + hex.EncodeToString(sum[:])
+
+	for i := 0; i < maxSaveUniqueAttempts; i++ {
+		stored, err := c.saveUnique(ctx, link, indexKey, normalized)
+		if errors.Is(err, redis.TxFailedErr) {
+			continue
+		}
+		return stored, err
+	}
+	return urlshort.Link{}, fmt.Errorf("saving %s: url index changed concurrently %d times", link.Key, maxSaveUniqueAttempts)
+}
+
+func (c *client) saveUnique(ctx context.Context, link urlshort.Link, indexKey string, normalized string) (urlshort.Link, error) {
+	var res *redis.Cmd
+	var existing, url string
+	err := c.Client.Watch(ctx, func(tx *redis.Tx) error {
+		indexed, err := tx.Get(ctx, indexKey).Result()
+		if err != nil && !errors.Is(err, redis.Nil) {
+			return err
+		}
+		keys := append(linkKeys(link.Key), indexKey)
+		if indexed != "" {
+			// Index entries holding a bare key were written when urls were saved normalized.
+			existing, url = indexed, normalized
+			if k, u, ok := strings.Cut(indexed, "\n"); ok {
+				existing, url = k, u
+			}
+			keys = append(keys, linkPrefix+existing, settingsPrefix+existing)
+		}
+		args := append(linkArgs(link), link.Key+"\n"+link.URL, url)
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			res = saveUniqueScript.Eval(ctx, pipe, keys, args...)
+			return nil
+		})
+		return err
+	}, indexKey)
+	if err != nil {
+		return urlshort.Link{}, err
+	}
+
+	switch v := res.Val().(type) {
+	case []interface{}:
+		ttl, _ := v[0].(int64)
+		stored := link
+		stored.Key = existing
+		stored.URL = url
+		stored.ExpiresAt = expiresAtFromTTL(time.Duration(ttl) * time.Millisecond)
+		stored.CreatedAt = time.Time{}
+		if created, _ := v[1].(string); created != "0" {
+			if stored.CreatedAt, err = parseUnixMilli(created); err != nil {
+				return urlshort.Link{}, err
+			}
+		}
+		return stored, nil
+	case int64:
+		if v == 0 {
+			return urlshort.Link{}, urlshort.ErrKeyExists
+		}
+		return link, nil
+	}
+	return urlshort.Link{}, fmt.Errorf("unexpected script result %v", res.Val())
+}
+
+func (c *client) Get(ctx context.Context, key string) (urlshort.Link, error) {
+	var get *redis.StringCmd
+	var ttl *redis.DurationCmd
+	var expired *redis.IntCmd
+	var settings *redis.SliceCmd
+	_, err := c.Client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		get = pipe.Get(ctx, linkPrefix+key)
+		ttl = pipe.PTTL(ctx, linkPrefix+key)
+		expired = pipe.Exists(ctx, expiredPrefix+key)
+		settings = pipe.HMGet(ctx, settingsPrefix+key, settingsFields...)
+		return nil
+	})
+	if errors.Is(get.Err(), redis.Nil) {
+		if expired.Val() == 1 {
+			return urlshort.Link{}, urlshort.ErrExpiredKey
+		}
+		return urlshort.Link{}, urlshort.ErrMissingKey
+	}
+	if err != nil {
+		return urlshort.Link{}, err
+	}
+	link := urlshort.Link{Key: key, URL: get.Val(), ExpiresAt: expiresAtFromTTL(ttl.Val())}
+	if err = setSettings(&link, settings.Val()); err != nil {
+		return urlshort.Link{}, err
+	}
+	return link, nil
+}
+
+// setSettings sets the redirect status, query policy, preview, creation time and
+// creator of link from the values of the settingsFields of its settings, nil when missing.
+func setSettings(link *urlshort.Link, values []interface{}) error {
+	var err error
+	if status, ok := values[0].(string); ok {
+		if link.Status, err = strconv.Atoi(status); err != nil {
+			return err
+		}
+	}
+	if query, ok := values[1].(string); ok {
+		link.Query = urlshort.QueryPolicy(query)
+	}
+	if preview, ok := values[2].(string); ok {
+		link.Preview = preview == "1"
+	}
+	if created, ok := values[3].(string); ok {
+		if link.CreatedAt, err = parseUnixMilli(created); err != nil {
+			return err
+		}
+	}
+	if creator, ok := values[4].(string); ok {
+		link.CreatedBy = creator
 	}
 	return nil
 }
 
-func (c *client) Get(ctx context.Context, key string) (string, error) {
-	cmd := c.Client.Get(ctx, key)
+// Delete also removes what was left behind by the link, such as its click
+// counters, when the link itself is already gone.
+func (c *client) Delete(ctx context.Context, key string) error {
+	var del *redis.IntCmd
+	_, err := c.Client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		del = pipe.Del(ctx, linkPrefix+key)
+		pipe.Del(ctx, linkKeys(key)[1:]...)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if del.Val() == 0 {
+		return urlshort.ErrMissingKey
+	}
+	return nil
+}
+
+func (c *client) Update(ctx context.Context, key string, url string) error {
+	cmd := c.Client.SetArgs(ctx, linkPrefix+key, url, redis.SetArgs{Mode: "XX", KeepTTL: true})
 	if errors.Is(cmd.Err(), redis.Nil) {
-		return "", urlshort.ErrMissingKey
+		return urlshort.ErrMissingKey
 	}
+	return cmd.Err()
+}
+
+func (c *client) Exists(ctx context.Context, key string) (bool, error) {
+	cmd := c.Client.Exists(ctx, linkPrefix+key)
 	if cmd.Err() != nil {
-		return "", cmd.Err()
+		return false, cmd.Err()
+	}
+	return cmd.Val() == 1, nil
+}
+
+// RecordClick increments the total and the daily clicks of the key, which
+// expire along with the expired marker of expiring links. Only these aggregates
+// are kept, the referrer, user agent and IP hash of clicks are dropped.
+func (c *client) RecordClick(ctx context.Context, click urlshort.Click) error {
+	keys := []string{clickTotalPrefix + click.Key, clickDailyPrefix + click.Key, expiredPrefix + click.Key}
+	return recordClickScript.Run(ctx, c.Client, keys, click.Time.UTC().Format(urlshort.ClickDateFormat)).Err()
+}
+
+// ClickStats returns zero stats for keys never clicked.
+func (c *client) ClickStats(ctx context.Context, key string) (urlshort.ClickStats, error) {
+	var total *redis.StringCmd
+	var daily *redis.MapStringStringCmd
+	_, err := c.Client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		total = pipe.Get(ctx, clickTotalPrefix+key)
+		daily = pipe.HGetAll(ctx, clickDailyPrefix+key)
+		return nil
+	})
+	if err != nil && !errors.Is(err, redis.Nil) {
+		return urlshort.ClickStats{}, err
+	}
+
+	stats := urlshort.ClickStats{Key: key}
+	if total.Err() == nil {
+		if stats.Total, err = total.Int64(); err != nil {
+			return urlshort.ClickStats{}, err
+		}
+	}
+	for date, clicks := range daily.Val() {
+		n, err := strconv.ParseInt(clicks, 10, 64)
+		if err != nil {
+			return urlshort.ClickStats{}, err
+		}
+		stats.Daily = append(stats.Daily, urlshort.DailyClicks{Date: date, Clicks: n})
+	}
+	return stats, nil
+}
+
+func (c *client) IncrementKeyCounter(ctx context.Context) (uint64, error) {
+	n, err := c.Client.Incr(ctx, keyCounterKey).Result()
+	if err != nil {
+		return 0, err
+	}
+	return uint64(n), nil
+}
+
+// List walks the stored keys with SCAN, so the cursor is the SCAN cursor and a
+// page may hold more or fewer than count links.
+func (c *client) List(ctx context.Context, cursor string, count int) ([]urlshort.Link, string, error) {
+	var scanCursor uint64
+	if cursor != "" {
+		var err error
+		if scanCursor, err = strconv.ParseUint(cursor, 10, 64); err != nil {
+			return nil, "", fmt.Errorf("invalid cursor %q", cursor)
+		}
+	}
+
+	keys, next, err := c.Client.Scan(ctx, scanCursor, linkPrefix+"*", int64(count)).Result()
+	if err != nil {
+		return nil, "", err
+	}
+
+	nextCursor := ""
+	if next != 0 {
+		nextCursor = strconv.FormatUint(next, 10)
+	}
+	if len(keys) == 0 {
+		return nil, nextCursor, nil
+	}
+
+	var values *redis.SliceCmd
+	ttls := make([]*redis.DurationCmd, len(keys))
+	settings := make([]*redis.SliceCmd, len(keys))
+	_, err = c.Client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		values = pipe.MGet(ctx, keys...)
+		for i, key := range keys {
+			ttls[i] = pipe.PTTL(ctx, key)
+			settings[i] = pipe.HMGet(ctx, settingsPrefix+strings.TrimPrefix(key, linkPrefix), settingsFields...)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, "", err
+	}
+	links := make([]urlshort.Link, 0, len(keys))
+	for i, value := range values.Val() {
+		url, ok := value.(string)
+		if !ok {
+			// expired or deleted between SCAN and MGET
+			continue
+		}
+		link := urlshort.Link{
+			Key:       strings.TrimPrefix(keys[i], linkPrefix),
+			URL:       url,
+			ExpiresAt: expiresAtFromTTL(ttls[i].Val()),
+		}
+		if err = setSettings(&link, settings[i].Val()); err != nil {
+			return nil, "", err
+		}
+		links = append(links, link)
+	}
+	return links, nextCursor, nil
+}
+
+// MigrateLegacyKeys moves the links stored under their bare key, as they were
+// before linkPrefix, under it and returns how many were moved. Bare keys never
+// held anything but links, which had no colon, so only keys without one are
+// considered. It walks the whole database with SCAN and is meant to be run once,
+// when upgrading.
+func (c *client) MigrateLegacyKeys(ctx context.Context) (int, error) {
+	moved := 0
+	var cursor uint64
+	for {
+		keys, next, err := c.Client.Scan(ctx, cursor, "*", 1000).Result()
+		if err != nil {
+			return moved, err
+		}
+		for _, key := range keys {
+			if strings.Contains(key, ":") {
+				continue
+			}
+			n, err := moveLegacyLinkScript.Run(ctx, c.Client, []string{key, linkPrefix + key}).Int()
+			if err != nil {
+				return moved, fmt.Errorf("moving %s: %w", key, err)
+			}
+			moved += n
+		}
+		if next == 0 {
+			return moved, nil
+		}
+		cursor = next
+	}
+}
+
+// SaveAPIKey replaces the hash of the key in a transaction, so fields it no longer
+// has are dropped.
+func (c *client) SaveAPIKey(ctx context.Context, key urlshort.APIKey) error {
+	fields := map[string]interface{}{"name": key.Name, "hash": key.Hash}
+	if !key.CreatedAt.IsZero() {
+		fields["created"] = key.CreatedAt.UnixMilli()
+	}
+	if !key.RevokedAt.IsZero() {
+		fields["revoked"] = key.RevokedAt.UnixMilli()
+	}
+	_, err := c.Client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Del(ctx, apiKeyPrefix+key.ID)
+		pipe.HSet(ctx, apiKeyPrefix+key.ID, fields)
+		return nil
+	})
+	return err
+}
+
+func (c *client) GetAPIKey(ctx context.Context, id string) (urlshort.APIKey, error) {
+	fields, err := c.Client.HGetAll(ctx, apiKeyPrefix+id).Result()
+	if err != nil {
+		return urlshort.APIKey{}, err
+	}
+	if len(fields) == 0 {
+		return urlshort.APIKey{}, urlshort.ErrMissingAPIKey
+	}
+	return newAPIKey(id, fields)
+}
+
+// newAPIKey returns the API key id from the fields of its hash.
+func newAPIKey(id string, fields map[string]string) (urlshort.APIKey, error) {
+	key := urlshort.APIKey{ID: id, Name: fields["name"], Hash: fields["hash"]}
+	var err error
+	if created, ok := fields["created"]; ok {
+		if key.CreatedAt, err = parseUnixMilli(created); err != nil {
+			return urlshort.APIKey{}, err
+		}
+	}
+	if revoked, ok := fields["revoked"]; ok {
+		if key.RevokedAt, err = parseUnixMilli(revoked); err != nil {
+			return urlshort.APIKey{}, err
+		}
+	}
+	return key, nil
+}
+
+// ListAPIKeys walks every stored key with SCAN.
+func (c *client) ListAPIKeys(ctx context.Context) ([]urlshort.APIKey, error) {
+	var keys []urlshort.APIKey
+	iter := c.Client.Scan(ctx, 0, apiKeyPrefix+"*", 0).Iterator()
+	for iter.Next(ctx) {
+		fields, err := c.Client.HGetAll(ctx, iter.Val()).Result()
+		if err != nil {
+			return nil, err
+		}
+		if len(fields) == 0 {
+			// deleted between SCAN and HGETALL
+			continue
+		}
+		key, err := newAPIKey(strings.TrimPrefix(iter.Val(), apiKeyPrefix), fields)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	if err := iter.Err(); err != nil {
+		return nil, err
+	}
+	return keys, nil
+}
+
+// Allow keeps the buckets in Redis, so the limits are shared by every instance
+// of the application.
+func (c *client) Allow(ctx context.Context, key string, limit urlshort.RateLimit) (bool, time.Duration, error) {
+	res, err := allowScript.Run(ctx, c.Client, []string{rateLimitPrefix + key}, limit.Rate, limit.Burst).Int64Slice()
+	if err != nil {
+		return false, 0, err
+	}
+	if len(res) != 2 {
+		return false, 0, fmt.Errorf("unexpected script result %v", res)
 	}
-	return cmd.Val(), nil
+	return res[0] == 1, time.Duration(res[1]) * time.Millisecond, nil
 }
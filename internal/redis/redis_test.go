@@ -2,43 +2,493 @@ package redis_test
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"os"
 	"strconv"
+	"strings"
+	"sync"
 	"testing"
+	"time"
+	"urlshort"
 	"urlshort/internal/redis"
 )
 
-func TestSaveAndGet(t *testing.T) {
+// integrationOptions skips the test unless integration tests are enabled and
+// returns the client options configured in the environment.
+func integrationOptions(t *testing.T) *redis.Options {
+	t.Helper()
 	run := os.Getenv("RUN_INTEGRATION_TESTS")
 	if run != "true" {
 		t.Skip("set RUN_INTEGRATION_TESTS to true to run this test")
 	}
 
-	expirationMinutes, err := strconv.Atoi(os.Getenv("REDIS_EXPIRATION_MINUTES"))
-	if err != nil {
-		t.Fatalf("REDIS_EXPIRATION_MINUTES not numeric: %s", err.Error())
+	return &redis.Options{
+		Host:     os.Getenv("REDIS_HOST"),
+		Port:     os.Getenv("REDIS_PORT"),
+		Username: os.Getenv("REDIS_USERNAME"),
+		Password: os.Getenv("REDIS_PASSWORD"),
 	}
+}
 
-	storage := redis.New(&redis.Options{
-		Host:              os.Getenv("REDIS_HOST"),
-		Port:              os.Getenv("REDIS_PORT"),
-		Username:          os.Getenv("REDIS_USERNAME"),
-		Password:          os.Getenv("REDIS_PASSWORD"),
-		ExpirationMinutes: expirationMinutes,
-	})
+func TestSaveAndGet(t *testing.T) {
+	storage := redis.New(integrationOptions(t))
 
 	myKey := "my-key"
 	myUrl := "http://www.google.com"
-	if err = storage.Save(context.Background(), myKey, myUrl); err != nil {
+	storage.Delete(context.Background(), myKey)
+	if err := storage.Save(context.Background(), urlshort.Link{Key: myKey, URL: myUrl}); err != nil {
+		t.Fatalf("error was not expected but got: %s", err.Error())
+	}
+
+	myRetrievedLink, err := storage.Get(context.Background(), myKey)
+	if err != nil {
+		t.Fatalf("error was not expected but got: %s", err.Error())
+	}
+
+	if myRetrievedLink.URL != myUrl {
+		t.Fatalf("expected url %s but got %s", myUrl, myRetrievedLink.URL)
+	}
+	if !myRetrievedLink.ExpiresAt.IsZero() {
+		t.Fatalf("expected no expiration but got %v", myRetrievedLink.ExpiresAt)
+	}
+}
+
+func TestMigrateLegacyKeys(t *testing.T) {
+	storage := redis.New(integrationOptions(t))
+	ctx := context.Background()
+
+	myKey := "my-legacy-key"
+	myUrl := "http://www.google.com"
+	storage.Delete(ctx, myKey)
+	// Links used to be stored under their bare key.
+	if err := storage.Client.Set(ctx, myKey, myUrl, time.Hour).Err(); err != nil {
+		t.Fatal(err)
+	}
+	if err := storage.Client.Set(ctx, "legacy:key", myUrl, time.Hour).Err(); err != nil {
+		t.Fatal(err)
+	}
+	defer storage.Client.Del(ctx, "legacy:key")
+
+	if _, err := storage.Get(ctx, myKey); !errors.Is(err, urlshort.ErrMissingKey) {
+		t.Fatalf("expected ErrMissingKey before migrating but got: %v", err)
+	}
+	moved, err := storage.MigrateLegacyKeys(ctx)
+	if err != nil {
+		t.Fatalf("error was not expected but got: %s", err.Error())
+	}
+	if moved != 1 {
+		t.Fatalf("expected 1 link to be moved, got %d", moved)
+	}
+
+	link, err := storage.Get(ctx, myKey)
+	if err != nil {
+		t.Fatalf("error was not expected but got: %s", err.Error())
+	}
+	if link.URL != myUrl || link.ExpiresAt.IsZero() {
+		t.Fatalf("expected url %s expiring but got %v", myUrl, link)
+	}
+	if n, err := storage.Client.Exists(ctx, myKey, "legacy:key").Result(); err != nil || n != 1 {
+		t.Fatalf("expected only the key with a colon to be left, got %d, %v", n, err)
+	}
+	if moved, err = storage.MigrateLegacyKeys(ctx); err != nil || moved != 0 {
+		t.Fatalf("expected nothing left to move, got %d, %v", moved, err)
+	}
+	if err = storage.Delete(ctx, myKey); err != nil {
+		t.Fatalf("error was not expected but got: %s", err.Error())
+	}
+}
+
+func TestSaveExistingKey(t *testing.T) {
+	storage := redis.New(integrationOptions(t))
+
+	myKey := "my-colliding-key"
+	myUrl := "http://www.google.com"
+	storage.Delete(context.Background(), myKey)
+	if err := storage.Save(context.Background(), urlshort.Link{Key: myKey, URL: myUrl}); err != nil {
+		t.Fatalf("error was not expected but got: %s", err.Error())
+	}
+
+	err := storage.Save(context.Background(), urlshort.Link{Key: myKey, URL: "http://www.example.com"})
+	if !errors.Is(err, urlshort.ErrKeyExists) {
+		t.Fatalf("expected ErrKeyExists but got: %v", err)
+	}
+
+	myRetrievedLink, err := storage.Get(context.Background(), myKey)
+	if err != nil {
+		t.Fatalf("error was not expected but got: %s", err.Error())
+	}
+
+	if myRetrievedLink.URL != myUrl {
+		t.Fatalf("expected url %s but got %s", myUrl, myRetrievedLink.URL)
+	}
+}
+
+func TestDeleteUpdateListExists(t *testing.T) {
+	storage := redis.New(integrationOptions(t))
+	var err error
+	ctx := context.Background()
+
+	myKey := "my-managed-key"
+	storage.Delete(ctx, myKey)
+	if err = storage.Save(ctx, urlshort.Link{Key: myKey, URL: "http://www.google.com", ExpiresAt: time.Now().Add(time.Hour)}); err != nil {
+		t.Fatalf("error was not expected but got: %s", err.Error())
+	}
+
+	if err = storage.Update(ctx, myKey, "http://www.example.com"); err != nil {
+		t.Fatalf("error was not expected but got: %s", err.Error())
+	}
+	if link, _ := storage.Get(ctx, myKey); link.URL != "http://www.example.com" {
+		t.Fatalf("expected updated url but got %s", link.URL)
+	}
+	if ttl := storage.TTL(ctx, "link:"+myKey).Val(); ttl <= 0 {
+		t.Fatalf("expected update to keep expiration, got ttl %v", ttl)
+	}
+	if err = storage.Update(ctx, "my-missing-key", "http://www.example.com"); !errors.Is(err, urlshort.ErrMissingKey) {
+		t.Fatalf("expected ErrMissingKey but got: %v", err)
+	}
+
+	if ok, err := storage.Exists(ctx, myKey); err != nil || !ok {
+		t.Fatalf("expected key to exist, got %v, %v", ok, err)
+	}
+
+	found := false
+	cursor := ""
+	for {
+		links, next, err := storage.List(ctx, cursor, 10)
+		if err != nil {
+			t.Fatalf("error was not expected but got: %s", err.Error())
+		}
+		for _, link := range links {
+			if link.Key == myKey && link.URL == "http://www.example.com" && !link.ExpiresAt.IsZero() {
+				found = true
+			}
+		}
+		if next == "" {
+			break
+		}
+		cursor = next
+	}
+	if !found {
+		t.Fatalf("expected key %s to be listed", myKey)
+	}
+
+	if err = storage.Delete(ctx, myKey); err != nil {
+		t.Fatalf("error was not expected but got: %s", err.Error())
+	}
+	if ok, _ := storage.Exists(ctx, myKey); ok {
+		t.Fatalf("expected key to be deleted")
+	}
+	if err = storage.Delete(ctx, myKey); !errors.Is(err, urlshort.ErrMissingKey) {
+		t.Fatalf("expected ErrMissingKey but got: %v", err)
+	}
+}
+
+func TestExpiration(t *testing.T) {
+	storage := redis.New(integrationOptions(t))
+	ctx := context.Background()
+
+	myKey := "my-expiring-key"
+	storage.Delete(ctx, myKey)
+	expiresAt := time.Now().Add(500 * time.Millisecond)
+	if err := storage.Save(ctx, urlshort.Link{Key: myKey, URL: "http://www.google.com", ExpiresAt: expiresAt}); err != nil {
+		t.Fatalf("error was not expected but got: %s", err.Error())
+	}
+
+	link, err := storage.Get(ctx, myKey)
+	if err != nil {
+		t.Fatalf("error was not expected but got: %s", err.Error())
+	}
+	if diff := link.ExpiresAt.Sub(expiresAt); diff < -100*time.Millisecond || diff > 100*time.Millisecond {
+		t.Fatalf("expected expiration close to %v but got %v", expiresAt, link.ExpiresAt)
+	}
+
+	time.Sleep(time.Until(expiresAt) + 200*time.Millisecond)
+	if _, err = storage.Get(ctx, myKey); !errors.Is(err, urlshort.ErrExpiredKey) {
+		t.Fatalf("expected ErrExpiredKey but got: %v", err)
+	}
+	if ok, _ := storage.Exists(ctx, myKey); ok {
+		t.Fatalf("expected expired key not to exist")
+	}
+	if _, err = storage.Get(ctx, "my-missing-key"); !errors.Is(err, urlshort.ErrMissingKey) {
+		t.Fatalf("expected ErrMissingKey but got: %v", err)
+	}
+
+	if err = storage.Save(ctx, urlshort.Link{Key: myKey, URL: "http://www.example.com"}); err != nil {
+		t.Fatalf("expired key should be reusable but got: %s", err.Error())
+	}
+	if link, err = storage.Get(ctx, myKey); err != nil || link.URL != "http://www.example.com" {
+		t.Fatalf("expected reused key to point to the new url, got %v, %v", link, err)
+	}
+	storage.Delete(ctx, myKey)
+}
+
+func TestLinkSettings(t *testing.T) {
+	storage := redis.New(integrationOptions(t))
+	ctx := context.Background()
+
+	myKey := "my-temporary-key"
+	createdAt := time.UnixMilli(time.Now().UnixMilli())
+	storage.Delete(ctx, myKey)
+	if err := storage.Save(ctx, urlshort.Link{Key: myKey, URL: "http://www.google.com", Status: 302, Query: urlshort.QueryAppend, Preview: true, ExpiresAt: time.Now().Add(time.Hour), CreatedAt: createdAt, CreatedBy: "apikey01"}); err != nil {
+		t.Fatalf("error was not expected but got: %s", err.Error())
+	}
+	link, err := storage.Get(ctx, myKey)
+	if err != nil || link.Status != 302 || link.Query != urlshort.QueryAppend || !link.Preview {
+		t.Fatalf("expected status 302, query policy append and preview, got %d, %q, %v, %v", link.Status, link.Query, link.Preview, err)
+	}
+	if !link.CreatedAt.Equal(createdAt) || link.CreatedBy != "apikey01" {
+		t.Fatalf("expected creation time %v by apikey01 but got %v by %q", createdAt, link.CreatedAt, link.CreatedBy)
+	}
+	links, _, err := storage.List(ctx, "", 1000)
+	if err != nil {
+		t.Fatalf("error was not expected but got: %s", err.Error())
+	}
+	found := false
+	for _, l := range links {
+		if l.Key == myKey {
+			found = l.Status == 302 && l.Query == urlshort.QueryAppend && l.Preview && l.CreatedAt.Equal(createdAt) && l.CreatedBy == "apikey01"
+		}
+	}
+	if !found {
+		t.Fatalf("expected %s to be listed with its settings, got %v", myKey, links)
+	}
+
+	if err = storage.Update(ctx, myKey, "http://www.example.com"); err != nil {
+		t.Fatalf("error was not expected but got: %s", err.Error())
+	}
+	if link, err = storage.Get(ctx, myKey); err != nil || link.Status != 302 || link.Query != urlshort.QueryAppend {
+		t.Fatalf("expected update to keep the settings, got %d, %q, %v", link.Status, link.Query, err)
+	}
+
+	storage.Delete(ctx, myKey)
+	if err = storage.Save(ctx, urlshort.Link{Key: myKey, URL: "http://www.google.com"}); err != nil {
+		t.Fatalf("error was not expected but got: %s", err.Error())
+	}
+	if link, err = storage.Get(ctx, myKey); err != nil || link.Status != 0 || link.Query != "" || link.Preview || !link.CreatedAt.IsZero() || link.CreatedBy != "" {
+		t.Fatalf("expected reused key to have the default settings, got %d, %q, %v, %v, %q, %v", link.Status, link.Query, link.Preview, link.CreatedAt, link.CreatedBy, err)
+	}
+	storage.Delete(ctx, myKey)
+}
+
+func TestClickStats(t *testing.T) {
+	storage := redis.New(integrationOptions(t))
+	ctx := context.Background()
+
+	myKey := "my-clicked-key"
+	storage.Delete(ctx, myKey)
+	if err := storage.Save(ctx, urlshort.Link{Key: myKey, URL: "http://www.google.com"}); err != nil {
+		t.Fatalf("error was not expected but got: %s", err.Error())
+	}
+
+	yesterday := time.Date(2023, 11, 1, 23, 0, 0, 0, time.UTC)
+	today := yesterday.Add(2 * time.Hour)
+	for _, at := range []time.Time{yesterday, today, today} {
+		if err := storage.RecordClick(ctx, urlshort.Click{Key: myKey, Time: at}); err != nil {
+			t.Fatalf("error was not expected but got: %s", err.Error())
+		}
+	}
+
+	stats, err := storage.ClickStats(ctx, myKey)
+	if err != nil {
+		t.Fatalf("error was not expected but got: %s", err.Error())
+	}
+	if stats.Total != 3 {
+		t.Fatalf("expected 3 clicks but got %d", stats.Total)
+	}
+	daily := map[string]int64{}
+	for _, d := range stats.Daily {
+		daily[d.Date] = d.Clicks
+	}
+	if len(daily) != 2 || daily["2023-11-01"] != 1 || daily["2023-11-02"] != 2 {
+		t.Fatalf("unexpected daily clicks %v", stats.Daily)
+	}
+
+	storage.Delete(ctx, myKey)
+	if stats, err = storage.ClickStats(ctx, myKey); err != nil || stats.Total != 0 || len(stats.Daily) != 0 {
+		t.Fatalf("expected deleting the key to reset its stats, got %v, %v", stats, err)
+	}
+
+	expiresAt := time.Now().Add(time.Hour)
+	if err = storage.Save(ctx, urlshort.Link{Key: myKey, URL: "http://www.google.com", ExpiresAt: expiresAt}); err != nil {
+		t.Fatalf("error was not expected but got: %s", err.Error())
+	}
+	if err = storage.RecordClick(ctx, urlshort.Click{Key: myKey, Time: today}); err != nil {
+		t.Fatalf("error was not expected but got: %s", err.Error())
+	}
+	expected := time.Until(expiresAt.Add(urlshort.ExpiredRetention))
+	for _, counter := range []string{"clicks:total:" + myKey, "clicks:daily:" + myKey} {
+		if ttl := storage.PTTL(ctx, counter).Val(); ttl < expected-time.Minute || ttl > expected+time.Second {
+			t.Fatalf("expected %s to expire with the link in about %v, got %v", counter, expected, ttl)
+		}
+	}
+	storage.Delete(ctx, myKey)
+}
+
+func TestIncrementKeyCounter(t *testing.T) {
+	storage := redis.New(integrationOptions(t))
+	ctx := context.Background()
+
+	first, err := storage.IncrementKeyCounter(ctx)
+	if err != nil {
 		t.Fatalf("error was not expected but got: %s", err.Error())
 	}
+	second, err := storage.IncrementKeyCounter(ctx)
+	if err != nil {
+		t.Fatalf("error was not expected but got: %s", err.Error())
+	}
+	if second != first+1 {
+		t.Fatalf("expected counter to increase by one, got %d then %d", first, second)
+	}
+}
+
+func TestSaveUnique(t *testing.T) {
+	storage := redis.New(integrationOptions(t))
+	ctx := context.Background()
+
+	url := "http://www.google.com/?dedupe=" + strconv.FormatInt(time.Now().UnixNano(), 10)
+	storage.Delete(ctx, "my-unique-key")
+	storage.Delete(ctx, "my-duplicate-key")
+	storage.Delete(ctx, "my-temporary-key")
+
+	expiresAt := time.Now().Add(time.Hour)
+	createdAt := time.UnixMilli(time.Now().UnixMilli())
+	submitted := strings.Replace(url, "http://www.google.com/", "HTTP://WWW.Google.com:80", 1)
+	link, err := storage.SaveUnique(ctx, urlshort.Link{Key: "my-unique-key", URL: submitted, ExpiresAt: expiresAt, CreatedAt: createdAt})
+	if err != nil || link.Key != "my-unique-key" {
+		t.Fatalf("expected key my-unique-key, got %q, %v", link.Key, err)
+	}
+	if link, err = storage.Get(ctx, "my-unique-key"); err != nil || link.URL != submitted {
+		t.Fatalf("expected the url to be saved as submitted, got %v, %v", link, err)
+	}
+	link, err = storage.SaveUnique(ctx, urlshort.Link{Key: "my-duplicate-key", URL: url, CreatedAt: createdAt.Add(time.Minute)})
+	if err != nil || link.Key != "my-unique-key" || link.URL != submitted {
+		t.Fatalf("expected existing key my-unique-key, got %v, %v", link, err)
+	}
+	if !link.CreatedAt.Equal(createdAt) {
+		t.Fatalf("expected existing creation time %v but got %v", createdAt, link.CreatedAt)
+	}
+	if diff := link.ExpiresAt.Sub(expiresAt); diff < -time.Second || diff > time.Second {
+		t.Fatalf("expected existing expiration close to %v but got %v", expiresAt, link.ExpiresAt)
+	}
+	if ok, _ := storage.Exists(ctx, "my-duplicate-key"); ok {
+		t.Fatalf("expected duplicate not to be saved")
+	}
+	link, err = storage.SaveUnique(ctx, urlshort.Link{Key: "my-temporary-key", URL: url, Status: 307})
+	if err != nil || link.Key != "my-temporary-key" {
+		t.Fatalf("expected a link with another status to be saved, got %q, %v", link.Key, err)
+	}
+	storage.Delete(ctx, "my-temporary-key")
+	link, err = storage.SaveUnique(ctx, urlshort.Link{Key: "my-temporary-key", URL: url, Query: urlshort.QueryOverride})
+	if err != nil || link.Key != "my-temporary-key" {
+		t.Fatalf("expected a link with another query policy to be saved, got %q, %v", link.Key, err)
+	}
+	storage.Delete(ctx, "my-temporary-key")
+	link, err = storage.SaveUnique(ctx, urlshort.Link{Key: "my-temporary-key", URL: url, Preview: true})
+	if err != nil || link.Key != "my-temporary-key" {
+		t.Fatalf("expected a link with a preview to be saved, got %q, %v", link.Key, err)
+	}
+	storage.Delete(ctx, "my-temporary-key")
+	if _, err = storage.SaveUnique(ctx, urlshort.Link{Key: "my-unique-key", URL: url + "&other"}); !errors.Is(err, urlshort.ErrKeyExists) {
+		t.Fatalf("expected ErrKeyExists but got: %v", err)
+	}
+
+	if err = storage.Delete(ctx, "my-unique-key"); err != nil {
+		t.Fatalf("error was not expected but got: %s", err.Error())
+	}
+	link, err = storage.SaveUnique(ctx, urlshort.Link{Key: "my-duplicate-key", URL: url})
+	if err != nil || link.Key != "my-duplicate-key" {
+		t.Fatalf("expected deleted link not to be reused, got %q, %v", link.Key, err)
+	}
+	storage.Delete(ctx, "my-duplicate-key")
+}
+
+func TestSaveUniqueConcurrently(t *testing.T) {
+	storage := redis.New(integrationOptions(t))
+	ctx := context.Background()
+
+	url := "http://www.google.com/?concurrent=" + strconv.FormatInt(time.Now().UnixNano(), 10)
+	keys := make([]string, 8)
+	var wg sync.WaitGroup
+	for i := range keys {
+		key := fmt.Sprintf("my-concurrent-key-%d", i)
+		storage.Delete(ctx, key)
+		defer storage.Delete(ctx, key)
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			link, err := storage.SaveUnique(ctx, urlshort.Link{Key: key, URL: url})
+			if err != nil {
+				t.Errorf("error was not expected but got: %s", err.Error())
+			}
+			keys[i] = link.Key
+		}(i)
+	}
+	wg.Wait()
+
+	for _, key := range keys {
+		if key != keys[0] {
+			t.Fatalf("expected every save to share a single key, got %v", keys)
+		}
+	}
+}
+
+func TestAPIKeys(t *testing.T) {
+	storage := redis.New(integrationOptions(t))
+	ctx := context.Background()
+
+	key := urlshort.APIKey{ID: "test-key", Name: "posters", Hash: "0123abcd", CreatedAt: time.UnixMilli(time.Now().UnixMilli())}
+	storage.Del(ctx, "apikey:"+key.ID)
+	if err := storage.SaveAPIKey(ctx, key); err != nil {
+		t.Fatalf("error was not expected but got: %s", err.Error())
+	}
+	stored, err := storage.GetAPIKey(ctx, key.ID)
+	if err != nil || stored.Name != key.Name || stored.Hash != key.Hash || !stored.CreatedAt.Equal(key.CreatedAt) || stored.Revoked() {
+		t.Fatalf("expected key %v but got %v, %v", key, stored, err)
+	}
+	if _, err = storage.GetAPIKey(ctx, "missing-key"); !errors.Is(err, urlshort.ErrMissingAPIKey) {
+		t.Fatalf("expected ErrMissingAPIKey but got: %v", err)
+	}
 
-	myRetrievedUrl, err := storage.Get(context.Background(), myKey)
+	if err = urlshort.RevokeAPIKey(ctx, storage, key.ID); err != nil {
+		t.Fatalf("error was not expected but got: %s", err.Error())
+	}
+	keys, err := storage.ListAPIKeys(ctx)
 	if err != nil {
 		t.Fatalf("error was not expected but got: %s", err.Error())
 	}
+	found := false
+	for _, k := range keys {
+		if k.ID == key.ID {
+			found = k.Revoked()
+		}
+	}
+	if !found {
+		t.Fatalf("expected %s to be listed as revoked, got %v", key.ID, keys)
+	}
+	storage.Del(ctx, "apikey:"+key.ID)
+}
+
+func TestAllow(t *testing.T) {
+	storage := redis.New(integrationOptions(t))
+	ctx := context.Background()
 
-	if myRetrievedUrl != myUrl {
-		t.Fatalf("expected url %s but got %s", myUrl, myRetrievedUrl)
+	limit := urlshort.RateLimit{Name: "test", Rate: 0.5, Burst: 2}
+	storage.Del(ctx, "ratelimit:test:client", "ratelimit:test:other")
+	for i := 0; i < 2; i++ {
+		if allowed, _, err := storage.Allow(ctx, "test:client", limit); err != nil || !allowed {
+			t.Fatalf("expected request %d of the burst to be allowed, got %v, %v", i, allowed, err)
+		}
+	}
+	allowed, retryAfter, err := storage.Allow(ctx, "test:client", limit)
+	if err != nil || allowed || retryAfter <= time.Second || retryAfter > 2*time.Second {
+		t.Fatalf("expected request to be denied for up to 2s, got %v, %v, %v", allowed, retryAfter, err)
+	}
+	if allowed, _, err = storage.Allow(ctx, "test:other", limit); err != nil || !allowed {
+		t.Fatalf("expected another client to have its own bucket, got %v, %v", allowed, err)
+	}
+	if ttl := storage.PTTL(ctx, "ratelimit:test:client").Val(); ttl <= 0 || ttl > 4*time.Second {
+		t.Fatalf("expected the bucket to expire once full again, got ttl %v", ttl)
 	}
+	storage.Del(ctx, "ratelimit:test:client", "ratelimit:test:other")
 }
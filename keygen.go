@@ -0,0 +1,154 @@
+package urlshort
+
+import (
+	"context"
+	"crypto/rand"
+	"fmt"
+)
+
+const base62Alphabet = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
+
+// DefaultKeyLength is the length of the keys generated when no KeyGenerator is configured.
+const DefaultKeyLength = 6
+
+// KeyGenerator defines a contract for types that know how to generate shortened URL keys.
+// Generated keys don't need to be unique: a key already in use is detected by the saver
+// and a new one is requested.
+type KeyGenerator interface {
+	// GenerateKey returns a new candidate key.
+	GenerateKey(ctx context.Context) (string, error)
+}
+
+// KeyCounter defines a contract for types that know how to hand out an ever
+// increasing sequence of numbers, shared by every instance of the application.
+type KeyCounter interface {
+	// IncrementKeyCounter increments the counter and returns its new value.
+	IncrementKeyCounter(ctx context.Context) (uint64, error)
+}
+
+type randomKeyGenerator struct {
+	length int
+}
+
+// NewRandomKeyGenerator returns a KeyGenerator of base62 keys of the given length
+// read from crypto/rand.
+func NewRandomKeyGenerator(length int) KeyGenerator {
+	if length <= 0 {
+		length = DefaultKeyLength
+	}
+	return &randomKeyGenerator{length: length}
+}
+
+func (g *randomKeyGenerator) GenerateKey(ctx context.Context) (string, error) {
+	// bytes >= 248 are discarded so every character is equally likely
+	const maxByte = 256 - 256%len(base62Alphabet)
+
+	key := make([]byte, 0, g.length)
+	buf := make([]byte, g.length+g.length/2)
+	for len(key) < g.length {
+		if _, err := rand.Read(buf); err != nil {
+			return "", fmt.Errorf("reading random bytes: %w", err)
+		}
+		for _, b := range buf {
+			if int(b) >= maxByte {
+				continue
+			}
+			key = append(key, base62Alphabet[int(b)%len(base62Alphabet)])
+			if len(key) == g.length {
+				break
+			}
+		}
+	}
+	return string(key), nil
+}
+
+type counterKeyGenerator struct {
+	counter KeyCounter
+}
+
+// NewCounterKeyGenerator returns a KeyGenerator of sequential keys: the next value
+// of counter encoded in base62. Keys are as short as possible but easy to guess.
+func NewCounterKeyGenerator(counter KeyCounter) KeyGenerator {
+	return &counterKeyGenerator{counter: counter}
+}
+
+func (g *counterKeyGenerator) GenerateKey(ctx context.Context) (string, error) {
+	n, err := g.counter.IncrementKeyCounter(ctx)
+	if err != nil {
+		return "", fmt.Errorf("incrementing key counter: %w", err)
+	}
+	return encodeBase(n, base62Alphabet, 0), nil
+}
+
+type obfuscatedKeyGenerator struct {
+	counter   KeyCounter
+	salt      string
+	alphabet  string
+	minLength int
+}
+
+// NewObfuscatedKeyGenerator returns a KeyGenerator that, like hashids, encodes the
+// next value of counter with an alphabet shuffled by salt, so keys stay short and
+// unique but don't reveal the sequence. Keys are at least minLength characters long.
+// The encoding is not compatible with hashids libraries.
+func NewObfuscatedKeyGenerator(counter KeyCounter, salt string, minLength int) KeyGenerator {
+	return &obfuscatedKeyGenerator{
+		counter:   counter,
+		salt:      salt,
+		alphabet:  consistentShuffle(base62Alphabet, salt),
+		minLength: minLength,
+	}
+}
+
+func (g *obfuscatedKeyGenerator) GenerateKey(ctx context.Context) (string, error) {
+	n, err := g.counter.IncrementKeyCounter(ctx)
+	if err != nil {
+		return "", fmt.Errorf("incrementing key counter: %w", err)
+	}
+	return g.encode(n), nil
+}
+
+// encode writes a lottery character picked from n followed by n encoded with the
+// alphabet reshuffled by that lottery, which makes consecutive numbers look unrelated
+// while keeping the encoding reversible, hence free of collisions.
+func (g *obfuscatedKeyGenerator) encode(n uint64) string {
+	lottery := g.alphabet[n%uint64(len(g.alphabet))]
+	digits := consistentShuffle(g.alphabet, string(lottery)+g.salt+g.alphabet)
+	return string(lottery) + encodeBase(n, digits, g.minLength-1)
+}
+
+// encodeBase encodes n in the base given by the length of alphabet, left padded
+// with the alphabet's zero digit up to width characters.
+func encodeBase(n uint64, alphabet string, width int) string {
+	base := uint64(len(alphabet))
+	var out []byte
+	for {
+		out = append(out, alphabet[n%base])
+		n /= base
+		if n == 0 {
+			break
+		}
+	}
+	for len(out) < width {
+		out = append(out, alphabet[0])
+	}
+	for i, j := 0, len(out)-1; i < j; i, j = i+1, j-1 {
+		out[i], out[j] = out[j], out[i]
+	}
+	return string(out)
+}
+
+// consistentShuffle permutes alphabet deterministically from salt, as hashids does.
+func consistentShuffle(alphabet string, salt string) string {
+	if salt == "" {
+		return alphabet
+	}
+	out := []byte(alphabet)
+	for i, v, p := len(out)-1, 0, 0; i > 0; i-- {
+		p += int(salt[v])
+		j := (int(salt[v]) + v + p) % i
+		out[i], out[j] = out[j], out[i]
+		v = (v + 1) % len(salt)
+	}
+	return string(out)
+}
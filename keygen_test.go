@@ -0,0 +1,155 @@
+package urlshort_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"urlshort"
+)
+
+const base62 = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
+
+type mockCounter struct {
+	n   uint64
+	err error
+}
+
+func (m *mockCounter) IncrementKeyCounter(ctx context.Context) (uint64, error) {
+	if m.err != nil {
+		return 0, m.err
+	}
+	m.n++
+	return m.n, nil
+}
+
+func TestRandomKeyGenerator(t *testing.T) {
+	for _, length := range []int{1, 6, 12} {
+		generator := urlshort.NewRandomKeyGenerator(length)
+		seen := make(map[string]bool)
+		for i := 0; i < 1000; i++ {
+			key, err := generator.GenerateKey(context.Background())
+			if err != nil {
+				t.Fatalf("error was not expected but got: %s", err.Error())
+			}
+			if len(key) != length {
+				t.Fatalf("expected key of length %d, got %q", length, key)
+			}
+			if strings.Trim(key, base62) != "" {
+				t.Fatalf("key %q has characters outside base62", key)
+			}
+			seen[key] = true
+		}
+		if length >= 6 && len(seen) != 1000 {
+			t.Errorf("expected 1000 distinct keys of length %d, got %d", length, len(seen))
+		}
+	}
+
+	t.Run("default length", func(t *testing.T) {
+		key, err := urlshort.NewRandomKeyGenerator(0).GenerateKey(context.Background())
+		if err != nil {
+			t.Fatalf("error was not expected but got: %s", err.Error())
+		}
+		if len(key) != urlshort.DefaultKeyLength {
+			t.Errorf("expected key of length %d, got %q", urlshort.DefaultKeyLength, key)
+		}
+	})
+}
+
+func TestCounterKeyGenerator(t *testing.T) {
+	counter := &mockCounter{}
+	generator := urlshort.NewCounterKeyGenerator(counter)
+
+	want := []string{"b", "c", "d"}
+	for _, w := range want {
+		key, err := generator.GenerateKey(context.Background())
+		if err != nil {
+			t.Fatalf("error was not expected but got: %s", err.Error())
+		}
+		if key != w {
+			t.Errorf("expected key %q, got %q", w, key)
+		}
+	}
+
+	counter.n = 61
+	if key, _ := generator.GenerateKey(context.Background()); key != "ba" {
+		t.Errorf("expected key %q, got %q", "ba", key)
+	}
+
+	counter.err = errors.New("some error")
+	if _, err := generator.GenerateKey(context.Background()); err == nil {
+		t.Errorf("expected counter error to be returned")
+	}
+}
+
+func TestObfuscatedKeyGenerator(t *testing.T) {
+	generator := urlshort.NewObfuscatedKeyGenerator(&mockCounter{}, "my salt", 5)
+
+	seen := make(map[string]bool)
+	previous := ""
+	for i := 0; i < 20000; i++ {
+		key, err := generator.GenerateKey(context.Background())
+		if err != nil {
+			t.Fatalf("error was not expected but got: %s", err.Error())
+		}
+		if len(key) < 5 {
+			t.Fatalf("expected key of at least 5 characters, got %q", key)
+		}
+		if strings.Trim(key, base62) != "" {
+			t.Fatalf("key %q has characters outside base62", key)
+		}
+		if seen[key] {
+			t.Fatalf("key %q generated twice", key)
+		}
+		if previous != "" && key[1:] == previous[1:] {
+			t.Fatalf("consecutive keys %q and %q look alike", previous, key)
+		}
+		seen[key] = true
+		previous = key
+	}
+
+	t.Run("deterministic per salt", func(t *testing.T) {
+		a, _ := urlshort.NewObfuscatedKeyGenerator(&mockCounter{}, "salt", 6).GenerateKey(context.Background())
+		b, _ := urlshort.NewObfuscatedKeyGenerator(&mockCounter{}, "salt", 6).GenerateKey(context.Background())
+		c, _ := urlshort.NewObfuscatedKeyGenerator(&mockCounter{}, "pepper", 6).GenerateKey(context.Background())
+		if a != b {
+			t.Errorf("expected same key for same salt, got %q and %q", a, b)
+		}
+		if a == c {
+			t.Errorf("expected different keys for different salts, got %q", a)
+		}
+	})
+}
+
+type mockKeyGenerator struct {
+	keys []string
+}
+
+func (m *mockKeyGenerator) GenerateKey(ctx context.Context) (string, error) {
+	key := m.keys[0]
+	m.keys = m.keys[1:]
+	return key, nil
+}
+
+func TestShortenerWithKeyGenerator(t *testing.T) {
+	saver := &mockSaverCollision{collisions: 1}
+	generator := &mockKeyGenerator{keys: []string{"taken", "free"}}
+	handler := urlshort.Shortener(saver, "http://localhost:8080", http.HandlerFunc(statusBadRequestHandlerMock), urlshort.WithKeyGenerator(generator))
+	req, err := http.NewRequest("POST", "/shorten?url=http://www.google.com", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rr := httptest.NewRecorder()
+	handler(rr, req)
+	if status := rr.Code; status != http.StatusOK {
+		t.Fatalf("handler returned wrong status code: got %v want %v", status, http.StatusOK)
+	}
+	if strings.Join(saver.keys, ",") != "taken,free" {
+		t.Errorf("expected generated keys to be tried in order, got %v", saver.keys)
+	}
+	if !strings.Contains(rr.Body.String(), "http://localhost:8080/short/free") {
+		t.Errorf("expected response to contain the generated short url")
+	}
+}
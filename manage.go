@@ -0,0 +1,205 @@
+package urlshort
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// UrlShortDeleter defines a contract for types that know how to delete a shortened URL key.
+type UrlShortDeleter interface {
+	// Delete removes the key. It returns ErrMissingKey if the key does not exist.
+	Delete(ctx context.Context, key string) error
+}
+
+// UrlShortUpdater defines a contract for types that know how to change the url a shortened URL key points to.
+type UrlShortUpdater interface {
+	// Update replaces the url stored for an existing key keeping its expiration.
+	// It returns ErrMissingKey if the key does not exist.
+	Update(ctx context.Context, key string, url string) error
+}
+
+// UrlShortExister defines a contract for types that know whether a shortened URL key exists.
+type UrlShortExister interface {
+	// Exists reports whether the key is stored and not expired.
+	Exists(ctx context.Context, key string) (bool, error)
+}
+
+// UrlShortLister defines a contract for types that know how to enumerate the stored shortened URL keys.
+type UrlShortLister interface {
+	// List returns a page of roughly count links starting at cursor, which is empty for the first
+	// page, and the cursor of the next page, which is empty once every link was returned.
+	// Expired links are skipped.
+	// Cursors are opaque and only meaningful to the implementation that produced them.
+	List(ctx context.Context, cursor string, count int) ([]Link, string, error)
+}
+
+const (
+	defaultListCount = 100
+	maxListCount     = 1000
+)
+
+// ListHandler will return an http.HandlerFunc that answers GET and HEAD requests
+// with a JSON page of the links enumerated by lister, described as LinkResponse
+// served from host. The page is selected with the optional query parameters
+// cursor and count.
+func ListHandler(lister UrlShortLister, host string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !allowMethods(w, r, jsonMethodNotAllowed, http.MethodGet, http.MethodHead) {
+			return
+		}
+
+		count := defaultListCount
+		if c := r.URL.Query().Get("count"); c != "" {
+			n, err := strconv.Atoi(c)
+			if err != nil || n <= 0 {
+				writeJSONError(w, http.StatusBadRequest, "invalid_count", "count must be a positive integer")
+				return
+			}
+			count = min(n, maxListCount)
+		}
+
+		links, next, err := lister.List(r.Context(), r.URL.Query().Get("cursor"), count)
+		if err != nil {
+			writeInternalError(w, "listing links", err)
+			return
+		}
+		responses := make([]LinkResponse, 0, len(links))
+		for _, link := range links {
+			responses = append(responses, newLinkResponse(host, link))
+		}
+
+		writeJSON(w, http.StatusOK, struct {
+			Links      []LinkResponse `json:"links"`
+			NextCursor string         `json:"next_cursor"`
+		}{
+			Links:      responses,
+			NextCursor: next,
+		})
+	}
+}
+
+// DeleteHandler will return an http.HandlerFunc that deletes the key
+// at the end of the request path on DELETE requests.
+// Handler must be attached to a route ending in /{key} or it won't work properly
+func DeleteHandler(deleter UrlShortDeleter) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !allowMethods(w, r, jsonMethodNotAllowed, http.MethodDelete) {
+			return
+		}
+		key := keyFromPath(r.URL.Path)
+		if key == "" {
+			writeJSONError(w, http.StatusBadRequest, "missing_key", "key is missing")
+			return
+		}
+		err := deleter.Delete(r.Context(), key)
+		if errors.Is(err, ErrMissingKey) {
+			writeJSONError(w, http.StatusNotFound, "not_found", ErrMissingKey.Error())
+			return
+		}
+		if err != nil {
+			writeInternalError(w, "deleting "+key, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// UpdateHandler will return an http.HandlerFunc that points the key at the
+// end of the request path to the url of PUT requests with a JSON body such as
+// {"url": "https://www.some-url.com"}.
+// Handler must be attached to a route ending in /{key} or it won't work properly
+func UpdateHandler(updater UrlShortUpdater) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !allowMethods(w, r, jsonMethodNotAllowed, http.MethodPut) {
+			return
+		}
+		key := keyFromPath(r.URL.Path)
+		if key == "" {
+			writeJSONError(w, http.StatusBadRequest, "missing_key", "key is missing")
+			return
+		}
+
+		var body struct {
+			URL string `json:"url"`
+		}
+		decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxRequestBodySize))
+		decoder.DisallowUnknownFields()
+		if err := decoder.Decode(&body); err != nil {
+			writeJSONError(w, http.StatusBadRequest, "invalid_body", fmt.Sprintf("invalid JSON body: %s", err.Error()))
+			return
+		}
+		newURL := body.URL
+		if newURL == "" {
+			writeJSONError(w, http.StatusBadRequest, "missing_url", "url is missing")
+			return
+		}
+		if _, err := url.ParseRequestURI(newURL); err != nil {
+			writeJSONError(w, http.StatusBadRequest, "invalid_url", "url is not valid")
+			return
+		}
+
+		err := updater.Update(r.Context(), key, newURL)
+		if errors.Is(err, ErrMissingKey) {
+			writeJSONError(w, http.StatusNotFound, "not_found", ErrMissingKey.Error())
+			return
+		}
+		if err != nil {
+			writeInternalError(w, "updating "+key, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, struct {
+			Key string `json:"key"`
+			URL string `json:"url"`
+		}{
+			Key: key,
+			URL: newURL,
+		})
+	}
+}
+
+// ExistsHandler will return an http.HandlerFunc that answers HEAD requests
+// with 200 if the key at the end of the request path exists and 404 otherwise.
+// Handler must be attached to a route ending in /{key} or it won't work properly
+func ExistsHandler(exister UrlShortExister) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !allowMethods(w, r, jsonMethodNotAllowed, http.MethodHead) {
+			return
+		}
+		key := keyFromPath(r.URL.Path)
+		if key == "" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		ok, err := exister.Exists(r.Context(), key)
+		if err != nil {
+			log.Printf("urlshort: checking %s: %v", key, err)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}
+}
+
+// keyFromPath returns the last segment of path, empty when path ends in a slash,
+// such as /api/v1/links/, as no key follows the route then.
+func keyFromPath(path string) string {
+	path = strings.TrimRight(path, " ")
+	return path[strings.LastIndex(path, "/")+1:]
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,257 @@
+package urlshort_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"urlshort"
+)
+
+type mockManager struct {
+	entries map[string]string
+	err     error
+}
+
+func (m *mockManager) Delete(ctx context.Context, key string) error {
+	if m.err != nil {
+		return m.err
+	}
+	if _, ok := m.entries[key]; !ok {
+		return urlshort.ErrMissingKey
+	}
+	delete(m.entries, key)
+	return nil
+}
+
+func (m *mockManager) Update(ctx context.Context, key string, url string) error {
+	if m.err != nil {
+		return m.err
+	}
+	if _, ok := m.entries[key]; !ok {
+		return urlshort.ErrMissingKey
+	}
+	m.entries[key] = url
+	return nil
+}
+
+func (m *mockManager) Exists(ctx context.Context, key string) (bool, error) {
+	if m.err != nil {
+		return false, m.err
+	}
+	_, ok := m.entries[key]
+	return ok, nil
+}
+
+func (m *mockManager) List(ctx context.Context, cursor string, count int) ([]urlshort.Link, string, error) {
+	if m.err != nil {
+		return nil, "", m.err
+	}
+	if cursor != "" {
+		return nil, "", nil
+	}
+	var links []urlshort.Link
+	for key, url := range m.entries {
+		links = append(links, urlshort.Link{Key: key, URL: url})
+	}
+	return links, "next", nil
+}
+
+func TestDeleteHandler(t *testing.T) {
+	tests := map[string]struct {
+		method     string
+		path       string
+		err        error
+		statusCode int
+	}{
+		"correct delete":     {method: "DELETE", path: "/api/v1/links/CSl5Ow", statusCode: http.StatusNoContent},
+		"missing key":        {method: "DELETE", path: "/api/v1/links/other", statusCode: http.StatusNotFound},
+		"invalid method":     {method: "GET", path: "/api/v1/links/CSl5Ow", statusCode: http.StatusMethodNotAllowed},
+		"error deleting":     {method: "DELETE", path: "/api/v1/links/CSl5Ow", err: errors.New("some error"), statusCode: http.StatusInternalServerError},
+		"key not in path":    {method: "DELETE", path: "/", statusCode: http.StatusBadRequest},
+		"no key after route": {method: "DELETE", path: "/api/v1/links/", statusCode: http.StatusBadRequest},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			manager := &mockManager{entries: map[string]string{"CSl5Ow": "http://www.google.com"}, err: tc.err}
+			handler := urlshort.DeleteHandler(manager)
+			req, err := http.NewRequest(tc.method, tc.path, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			rr := httptest.NewRecorder()
+			handler(rr, req)
+			if status := rr.Code; status != tc.statusCode {
+				t.Errorf("handler returned wrong status code: got %v want %v", status, tc.statusCode)
+			}
+			if tc.statusCode == http.StatusNoContent {
+				if _, ok := manager.entries["CSl5Ow"]; ok {
+					t.Errorf("key was not deleted")
+				}
+			}
+		})
+	}
+}
+
+func TestUpdateHandler(t *testing.T) {
+	tests := map[string]struct {
+		method     string
+		path       string
+		URL        string
+		body       string
+		err        error
+		statusCode int
+	}{
+		"correct update": {method: "PUT", path: "/api/v1/links/CSl5Ow", URL: "http://www.example.com", statusCode: http.StatusOK},
+		"missing key":    {method: "PUT", path: "/api/v1/links/other", URL: "http://www.example.com", statusCode: http.StatusNotFound},
+		"missing url":    {method: "PUT", path: "/api/v1/links/CSl5Ow", URL: "", statusCode: http.StatusBadRequest},
+		"invalid url":    {method: "PUT", path: "/api/v1/links/CSl5Ow", URL: "example", statusCode: http.StatusBadRequest},
+		"invalid method": {method: "POST", path: "/api/v1/links/CSl5Ow", URL: "http://www.example.com", statusCode: http.StatusMethodNotAllowed},
+		"error updating": {method: "PUT", path: "/api/v1/links/CSl5Ow", URL: "http://www.example.com", err: errors.New("some error"), statusCode: http.StatusInternalServerError},
+		"form body":      {method: "PUT", path: "/api/v1/links/CSl5Ow", body: "url=http://www.example.com", statusCode: http.StatusBadRequest},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			manager := &mockManager{entries: map[string]string{"CSl5Ow": "http://www.google.com"}, err: tc.err}
+			handler := urlshort.UpdateHandler(manager)
+			body := tc.body
+			if body == "" {
+				data, err := json.Marshal(map[string]string{"url": tc.URL})
+				if err != nil {
+					t.Fatal(err)
+				}
+				body = string(data)
+			}
+			req, err := http.NewRequest(tc.method, tc.path, strings.NewReader(body))
+			if err != nil {
+				t.Fatal(err)
+			}
+			rr := httptest.NewRecorder()
+			handler(rr, req)
+			if status := rr.Code; status != tc.statusCode {
+				t.Errorf("handler returned wrong status code: got %v want %v", status, tc.statusCode)
+			}
+			if tc.statusCode == http.StatusOK && manager.entries["CSl5Ow"] != tc.URL {
+				t.Errorf("key was not updated: got %v want %v", manager.entries["CSl5Ow"], tc.URL)
+			}
+		})
+	}
+}
+
+func TestExistsHandler(t *testing.T) {
+	tests := map[string]struct {
+		method     string
+		path       string
+		err        error
+		statusCode int
+	}{
+		"existing key":   {method: "HEAD", path: "/api/v1/links/CSl5Ow", statusCode: http.StatusOK},
+		"missing key":    {method: "HEAD", path: "/api/v1/links/other", statusCode: http.StatusNotFound},
+		"invalid method": {method: "POST", path: "/api/v1/links/CSl5Ow", statusCode: http.StatusMethodNotAllowed},
+		"error checking": {method: "HEAD", path: "/api/v1/links/CSl5Ow", err: errors.New("some error"), statusCode: http.StatusInternalServerError},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			manager := &mockManager{entries: map[string]string{"CSl5Ow": "http://www.google.com"}, err: tc.err}
+			handler := urlshort.ExistsHandler(manager)
+			req, err := http.NewRequest(tc.method, tc.path, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			rr := httptest.NewRecorder()
+			handler(rr, req)
+			if status := rr.Code; status != tc.statusCode {
+				t.Errorf("handler returned wrong status code: got %v want %v", status, tc.statusCode)
+			}
+		})
+	}
+}
+
+func TestListHandler(t *testing.T) {
+	tests := map[string]struct {
+		method     string
+		path       string
+		err        error
+		statusCode int
+		links      int
+		next       string
+	}{
+		"first page":     {method: "GET", path: "/api/v1/links", statusCode: http.StatusOK, links: 1, next: "next"},
+		"last page":      {method: "GET", path: "/api/v1/links?cursor=next&count=10", statusCode: http.StatusOK, links: 0},
+		"invalid count":  {method: "GET", path: "/api/v1/links?count=-1", statusCode: http.StatusBadRequest},
+		"invalid method": {method: "POST", path: "/api/v1/links", statusCode: http.StatusMethodNotAllowed},
+		"error listing":  {method: "GET", path: "/api/v1/links", err: errors.New("some error"), statusCode: http.StatusInternalServerError},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			manager := &mockManager{entries: map[string]string{"CSl5Ow": "http://www.google.com"}, err: tc.err}
+			handler := urlshort.ListHandler(manager, "http://localhost:8080")
+			req, err := http.NewRequest(tc.method, tc.path, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			rr := httptest.NewRecorder()
+			handler(rr, req)
+			if status := rr.Code; status != tc.statusCode {
+				t.Fatalf("handler returned wrong status code: got %v want %v", status, tc.statusCode)
+			}
+			if tc.statusCode != http.StatusOK {
+				return
+			}
+			var body struct {
+				Links      []urlshort.LinkResponse `json:"links"`
+				NextCursor string                  `json:"next_cursor"`
+			}
+			if err = json.Unmarshal(rr.Body.Bytes(), &body); err != nil {
+				t.Fatal(err)
+			}
+			if body.Links == nil {
+				t.Errorf("expected links to be an array")
+			}
+			if len(body.Links) != tc.links {
+				t.Fatalf("handler returned wrong number of links: got %v want %v", len(body.Links), tc.links)
+			}
+			if tc.links > 0 && body.Links[0].ShortURL != "http://localhost:8080/short/CSl5Ow" {
+				t.Errorf("handler returned wrong short url: got %v", body.Links[0].ShortURL)
+			}
+			if body.NextCursor != tc.next {
+				t.Errorf("handler returned wrong cursor: got %v want %v", body.NextCursor, tc.next)
+			}
+		})
+	}
+}
+
+func TestInternalErrorsHideDetails(t *testing.T) {
+	manager := &mockManager{err: errors.New("dial tcp 10.0.0.1:6379: connection refused")}
+	tests := map[string]struct {
+		handler http.HandlerFunc
+		method  string
+		path    string
+		body    string
+	}{
+		"list":   {handler: urlshort.ListHandler(manager, "http://localhost:8080"), method: "GET", path: "/api/v1/links"},
+		"delete": {handler: urlshort.DeleteHandler(manager), method: "DELETE", path: "/api/v1/links/CSl5Ow"},
+		"update": {handler: urlshort.UpdateHandler(manager), method: "PUT", path: "/api/v1/links/CSl5Ow", body: `{"url": "http://www.example.com"}`},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			req := httptest.NewRequest(tc.method, tc.path, strings.NewReader(tc.body))
+			rr := httptest.NewRecorder()
+			tc.handler(rr, req)
+			if status := rr.Code; status != http.StatusInternalServerError {
+				t.Fatalf("handler returned wrong status code: got %v want %v", status, http.StatusInternalServerError)
+			}
+			if strings.Contains(rr.Body.String(), "6379") {
+				t.Errorf("expected the error details to be hidden, got %s", rr.Body.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,33 @@
+package urlshort
+
+import (
+	"net/http"
+	"slices"
+	"strings"
+)
+
+// allowMethods reports whether r uses one of methods, the methods a handler
+// serves. Otherwise it sets the Allow header to methods and OPTIONS, answering
+// OPTIONS requests with 204 No Content and any other method with reject.
+func allowMethods(w http.ResponseWriter, r *http.Request, reject http.HandlerFunc, methods ...string) bool {
+	if slices.Contains(methods, r.Method) {
+		return true
+	}
+	w.Header().Set("Allow", strings.Join(append(slices.Clip(methods), http.MethodOptions), ", "))
+	if r.Method == http.MethodOptions {
+		w.WriteHeader(http.StatusNoContent)
+		return false
+	}
+	reject(w, r)
+	return false
+}
+
+// methodNotAllowed answers with a plain text 405 Method Not Allowed.
+func methodNotAllowed(w http.ResponseWriter, r *http.Request) {
+	http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+}
+
+// jsonMethodNotAllowed answers with a 405 Method Not Allowed in the JSON error format of the API.
+func jsonMethodNotAllowed(w http.ResponseWriter, r *http.Request) {
+	writeJSONError(w, http.StatusMethodNotAllowed, "method_not_allowed", "Invalid request method")
+}
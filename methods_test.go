@@ -0,0 +1,87 @@
+package urlshort_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"urlshort"
+)
+
+func TestRedirectHandlersHead(t *testing.T) {
+	recorder := &mockClickRecorder{}
+	tests := map[string]struct {
+		handler  http.HandlerFunc
+		path     string
+		location string
+	}{
+		"MapHandler": {
+			handler:  urlshort.MapHandler(map[string]string{"/urlshort": "https://github.com/gophercises/urlshort"}, http.HandlerFunc(statusBadRequestHandlerMock)),
+			path:     "/urlshort",
+			location: "https://github.com/gophercises/urlshort",
+		},
+		"RetrieveHandler": {
+			handler:  urlshort.RetrieveHandler(&mockGetter{}, http.HandlerFunc(statusBadRequestHandlerMock), urlshort.WithClickRecorder(recorder)),
+			path:     "/short/CSl5Ow",
+			location: "http://www.google.com",
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			get := httptest.NewRecorder()
+			tc.handler(get, httptest.NewRequest("GET", tc.path, nil))
+			head := httptest.NewRecorder()
+			tc.handler(head, httptest.NewRequest("HEAD", tc.path, nil))
+			if head.Code != get.Code {
+				t.Errorf("handler returned wrong status code: got %v want %v", head.Code, get.Code)
+			}
+			if location := head.Header().Get("Location"); location != tc.location {
+				t.Errorf("handler redirected to wrong location: got %v want %v", location, tc.location)
+			}
+		})
+	}
+	if len(recorder.clicks) != 1 {
+		t.Errorf("expected only the GET request to be recorded, got %d clicks", len(recorder.clicks))
+	}
+}
+
+func TestHandlersAllow(t *testing.T) {
+	redirect := urlshort.MapHandler(map[string]string{"/urlshort": "https://github.com/gophercises/urlshort"}, http.HandlerFunc(statusBadRequestHandlerMock))
+	retrieve := urlshort.RetrieveHandler(&mockGetter{}, http.HandlerFunc(statusBadRequestHandlerMock))
+	shortener := urlshort.Shortener(&mockSaver{}, "http://localhost:8080", http.HandlerFunc(statusBadRequestHandlerMock))
+	create := urlshort.CreateLinkHandler(&mockSaver{}, "http://localhost:8080")
+	exists := urlshort.ExistsHandler(&mockManager{})
+
+	tests := map[string]struct {
+		handler    http.HandlerFunc
+		method     string
+		path       string
+		statusCode int
+		allow      string
+	}{
+		"MapHandler options":         {handler: redirect, method: "OPTIONS", path: "/urlshort", statusCode: http.StatusNoContent, allow: "GET, HEAD, OPTIONS"},
+		"MapHandler post":            {handler: redirect, method: "POST", path: "/urlshort", statusCode: http.StatusMethodNotAllowed, allow: "GET, HEAD, OPTIONS"},
+		"RetrieveHandler options":    {handler: retrieve, method: "OPTIONS", path: "/short/CSl5Ow", statusCode: http.StatusNoContent, allow: "GET, HEAD, OPTIONS"},
+		"RetrieveHandler delete":     {handler: retrieve, method: "DELETE", path: "/short/CSl5Ow", statusCode: http.StatusMethodNotAllowed, allow: "GET, HEAD, OPTIONS"},
+		"Shortener options":          {handler: shortener, method: "OPTIONS", path: "/shorten", statusCode: http.StatusNoContent, allow: "POST, OPTIONS"},
+		"Shortener get":              {handler: shortener, method: "GET", path: "/shorten", statusCode: http.StatusMethodNotAllowed, allow: "POST, OPTIONS"},
+		"ShortenerHome options":      {handler: urlshort.ShortenerHome, method: "OPTIONS", path: "/home", statusCode: http.StatusNoContent, allow: "GET, HEAD, OPTIONS"},
+		"ShortenerHome post":         {handler: urlshort.ShortenerHome, method: "POST", path: "/home", statusCode: http.StatusMethodNotAllowed, allow: "GET, HEAD, OPTIONS"},
+		"CreateLinkHandler get":      {handler: create, method: "GET", path: "/api/v1/links", statusCode: http.StatusMethodNotAllowed, allow: "POST, OPTIONS"},
+		"ExistsHandler get":          {handler: exists, method: "GET", path: "/api/v1/links/CSl5Ow", statusCode: http.StatusMethodNotAllowed, allow: "HEAD, OPTIONS"},
+		"served method has no allow": {handler: redirect, method: "GET", path: "/urlshort", statusCode: http.StatusMovedPermanently},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			tc.handler(rr, httptest.NewRequest(tc.method, tc.path, nil))
+			if status := rr.Code; status != tc.statusCode {
+				t.Errorf("handler returned wrong status code: got %v want %v", status, tc.statusCode)
+			}
+			if allow := rr.Header().Get("Allow"); allow != tc.allow {
+				t.Errorf("handler returned wrong Allow header: got %q want %q", allow, tc.allow)
+			}
+		})
+	}
+}
@@ -0,0 +1,310 @@
+package urlshort
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// ShortenerOption configures the handlers that create shortened URLs,
+// Shortener and CreateLinkHandler.
+type ShortenerOption func(*shortenerConfig)
+
+type shortenerConfig struct {
+	keyGenerator KeyGenerator
+	deduplicate  bool
+	deduplicator UrlShortDeduplicator
+
+	defaultExpiration time.Duration
+	maxExpiration     time.Duration
+
+	pages *Pages
+}
+
+func newShortenerConfig(saver UrlShortSaver, opts []ShortenerOption) *shortenerConfig {
+	cfg := &shortenerConfig{
+		keyGenerator: NewRandomKeyGenerator(DefaultKeyLength),
+		pages:        defaultPages,
+	}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+	if cfg.maxExpiration > 0 && cfg.defaultExpiration == 0 {
+		cfg.defaultExpiration = cfg.maxExpiration
+	}
+	if cfg.maxExpiration > 0 && cfg.defaultExpiration > cfg.maxExpiration {
+		panic("urlshort: WithDefaultExpiration longer than WithMaxExpiration")
+	}
+	if cfg.deduplicate {
+		deduplicator, ok := saver.(UrlShortDeduplicator)
+		if !ok {
+			panic("urlshort: WithDeduplication requires a saver implementing UrlShortDeduplicator")
+		}
+		cfg.deduplicator = deduplicator
+	}
+	return cfg
+}
+
+// WithKeyGenerator sets the KeyGenerator used for keys of links created without an alias.
+// By default keys are DefaultKeyLength random base62 characters.
+func WithKeyGenerator(generator KeyGenerator) ShortenerOption {
+	return func(cfg *shortenerConfig) {
+		cfg.keyGenerator = generator
+	}
+}
+
+// WithDeduplication makes repeated submissions of the same url, after NormalizeURL,
+// return the existing short link instead of creating a new one. The saver must
+// implement UrlShortDeduplicator.
+func WithDeduplication() ShortenerOption {
+	return func(cfg *shortenerConfig) {
+		cfg.deduplicate = true
+	}
+}
+
+// WithPages sets the Pages Shortener renders its result with, see ParsePages.
+// By default it uses the pages embedded in the package. It panics if pages is nil.
+func WithPages(pages *Pages) ShortenerOption {
+	if pages == nil {
+		panic("urlshort: WithPages: nil Pages")
+	}
+	return func(cfg *shortenerConfig) {
+		cfg.pages = pages
+	}
+}
+
+// RetrieveOption configures RetrieveHandler.
+type RetrieveOption func(*retrieveConfig)
+
+type retrieveConfig struct {
+	expired  http.Handler
+	recorder ClickRecorder
+	status   int
+	query    QueryPolicy
+	preview  http.Handler
+	qr       http.Handler
+	ipSecret []byte
+	ipHeader string
+}
+
+func newRetrieveConfig(fallback http.Handler, opts []RetrieveOption) *retrieveConfig {
+	cfg := &retrieveConfig{
+		expired: fallback,
+		status:  DefaultRedirectStatus,
+		query:   DefaultQueryPolicy,
+	}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+	return cfg
+}
+
+// WithExpiredHandler sets the http.Handler called for keys that expired,
+// see ErrExpiredKey. By default they are handled like missing keys.
+func WithExpiredHandler(h http.Handler) RetrieveOption {
+	return func(cfg *retrieveConfig) {
+		cfg.expired = h
+	}
+}
+
+// WithPreview hands requests for previews to h, usually a PreviewHandler: those
+// for a key followed by +, such as /short/abc123+, or with a preview=1 query,
+// and those for links saved with Preview. Clicks are not recorded for them.
+// By default links are always redirected.
+func WithPreview(h http.Handler) RetrieveOption {
+	return func(cfg *retrieveConfig) {
+		cfg.preview = h
+	}
+}
+
+// WithQRCode hands requests for the QR code of a key, such as /short/abc123/qr,
+// to h, usually a QRCodeHandler. By default they are handled like missing keys.
+func WithQRCode(h http.Handler) RetrieveOption {
+	return func(cfg *retrieveConfig) {
+		cfg.qr = h
+	}
+}
+
+// WithClickRecorder records every redirect with recorder, see Click. Failing to
+// record a click is logged and doesn't prevent the redirect.
+func WithClickRecorder(recorder ClickRecorder) RetrieveOption {
+	return func(cfg *retrieveConfig) {
+		cfg.recorder = recorder
+	}
+}
+
+// WithClickIPHash sets the IPHash of recorded clicks to the HMAC-SHA256 of the
+// client IP keyed with secret, which must be kept private and stable for the
+// hashes of a visitor to match. By default clicks have no IPHash. It panics if
+// secret is empty.
+func WithClickIPHash(secret []byte) RetrieveOption {
+	if len(secret) == 0 {
+		panic("urlshort: WithClickIPHash: empty secret")
+	}
+	return func(cfg *retrieveConfig) {
+		cfg.ipSecret = secret
+	}
+}
+
+// WithClickIPHeader reads the client IP hashed by WithClickIPHash from header,
+// the last one when it holds a list, like WithClientIPHeader does for rate
+// limits. It must only be used behind a proxy setting header, as clients can
+// send any value. By default the address of the connection is hashed. It
+// panics if header is empty.
+func WithClickIPHeader(header string) RetrieveOption {
+	if header == "" {
+		panic("urlshort: WithClickIPHeader: empty header")
+	}
+	return func(cfg *retrieveConfig) {
+		cfg.ipHeader = header
+	}
+}
+
+// WithRedirectStatus sets the status of redirects to links saved without their
+// own, see Link. It is DefaultRedirectStatus by default and panics unless status
+// is a redirect status accepted by ValidateRedirectStatus.
+func WithRedirectStatus(status int) RetrieveOption {
+	mustBeRedirectStatus("WithRedirectStatus", status)
+	return func(cfg *retrieveConfig) {
+		cfg.status = redirectStatus(status, DefaultRedirectStatus)
+	}
+}
+
+// PreviewOption configures PreviewHandler.
+type PreviewOption func(*previewConfig)
+
+type previewConfig struct {
+	expired http.Handler
+	stats   ClickStatsGetter
+	pages   *Pages
+}
+
+func newPreviewConfig(fallback http.Handler, opts []PreviewOption) *previewConfig {
+	cfg := &previewConfig{
+		expired: fallback,
+		pages:   defaultPages,
+	}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+	return cfg
+}
+
+// WithPreviewExpiredHandler sets the http.Handler called for keys that expired,
+// see ErrExpiredKey. By default they are handled like missing keys.
+func WithPreviewExpiredHandler(h http.Handler) PreviewOption {
+	return func(cfg *previewConfig) {
+		cfg.expired = h
+	}
+}
+
+// WithPreviewClickStats shows the number of clicks of the link, read from getter.
+// Failing to read them is logged and the page is shown without them.
+func WithPreviewClickStats(getter ClickStatsGetter) PreviewOption {
+	return func(cfg *previewConfig) {
+		cfg.stats = getter
+	}
+}
+
+// WithPreviewPages sets the Pages the preview is rendered with, see ParsePages.
+// By default it uses the pages embedded in the package. It panics if pages is nil.
+func WithPreviewPages(pages *Pages) PreviewOption {
+	if pages == nil {
+		panic("urlshort: WithPreviewPages: nil Pages")
+	}
+	return func(cfg *previewConfig) {
+		cfg.pages = pages
+	}
+}
+
+// RateLimitOption configures LimitRate.
+type RateLimitOption func(*rateLimitConfig)
+
+type rateLimitConfig struct {
+	ipHeader string
+}
+
+func newRateLimitConfig(opts []RateLimitOption) *rateLimitConfig {
+	cfg := &rateLimitConfig{}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+	return cfg
+}
+
+// WithClientIPHeader reads the client IP from header, the last one when it
+// holds a list like X-Forwarded-For does, which is the one added by the proxy
+// while the others come from the client. It must only be used behind a proxy
+// setting header, such as Fly-Client-IP or X-Real-IP, as clients can send any
+// value. Requests without header, and all of them by default, are limited by
+// the address of the connection. It panics if header is empty.
+func WithClientIPHeader(header string) RateLimitOption {
+	if header == "" {
+		panic("urlshort: WithClientIPHeader: empty header")
+	}
+	return func(cfg *rateLimitConfig) {
+		cfg.ipHeader = header
+	}
+}
+
+// MapOption configures MapHandler and the handlers built on it: FilesHandler,
+// YAMLHandler, JSONHandler, CSVHandler and TOMLHandler.
+type MapOption func(*mapConfig)
+
+type mapConfig struct {
+	status int
+	query  QueryPolicy
+}
+
+func newMapConfig(opts []MapOption) *mapConfig {
+	cfg := &mapConfig{
+		status: DefaultRedirectStatus,
+		query:  DefaultQueryPolicy,
+	}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+	return cfg
+}
+
+// WithMapRedirectStatus sets the status of redirects of mappings without their
+// own status. It is DefaultRedirectStatus by default and panics unless status
+// is a redirect status accepted by ValidateRedirectStatus.
+func WithMapRedirectStatus(status int) MapOption {
+	mustBeRedirectStatus("WithMapRedirectStatus", status)
+	return func(cfg *mapConfig) {
+		cfg.status = redirectStatus(status, DefaultRedirectStatus)
+	}
+}
+
+// WithQueryPolicy sets how the query of requests is combined with the url of
+// links saved without their own policy, see Link. It is DefaultQueryPolicy by
+// default and panics unless ValidateQueryPolicy accepts policy.
+func WithQueryPolicy(policy QueryPolicy) RetrieveOption {
+	mustBeQueryPolicy("WithQueryPolicy", policy)
+	return func(cfg *retrieveConfig) {
+		cfg.query = queryPolicy(policy, DefaultQueryPolicy)
+	}
+}
+
+// WithMapQueryPolicy sets how the query of requests is combined with the url of
+// mappings without their own policy. It is DefaultQueryPolicy by default and
+// panics unless ValidateQueryPolicy accepts policy.
+func WithMapQueryPolicy(policy QueryPolicy) MapOption {
+	mustBeQueryPolicy("WithMapQueryPolicy", policy)
+	return func(cfg *mapConfig) {
+		cfg.query = queryPolicy(policy, DefaultQueryPolicy)
+	}
+}
+
+func mustBeQueryPolicy(option string, policy QueryPolicy) {
+	if err := ValidateQueryPolicy(policy); err != nil {
+		panic(fmt.Sprintf("urlshort: %s: %v", option, err))
+	}
+}
+
+func mustBeRedirectStatus(option string, status int) {
+	if err := ValidateRedirectStatus(status); err != nil {
+		panic(fmt.Sprintf("urlshort: %s: %v", option, err))
+	}
+}
@@ -0,0 +1,113 @@
+package urlshort
+
+import (
+	"embed"
+	"errors"
+	"fmt"
+	"html/template"
+	"io/fs"
+	"net/http"
+	"path"
+)
+
+//go:embed html/*.html
+var embeddedPages embed.FS
+
+// Pages are the HTML pages served by ShortenerHome, Shortener, PreviewHandler,
+// ExpiredUrlHandler, MissingUrlHandler and InvalidUrlHandler, parsed once. The
+// package functions use the pages embedded from the html directory, and
+// ParsePages replaces them.
+type Pages struct {
+	home    *template.Template
+	shorten *template.Template
+	preview *template.Template
+	expired *template.Template
+	missing *template.Template
+	invalid *template.Template
+}
+
+// defaultPages are the embedded pages, parsed when the package is loaded.
+var defaultPages = mustParsePages()
+
+func mustParsePages() *Pages {
+	pages, err := ParsePages(nil)
+	if err != nil {
+		panic(fmt.Sprintf("urlshort: parsing embedded pages: %v", err))
+	}
+	return pages
+}
+
+// ParsePages parses the html/template pages found at the root of fsys:
+// home.html, shorten.html, preview.html, expired.html, fallback.html and error.html.
+// Pages missing from fsys, or all of them when it is nil, are the ones embedded
+// in the package, so a custom look only needs the pages it changes.
+// shorten.html is executed with the fields OriginalUrl, ShortUrl and QRCodeUrl,
+// strings, and ExpiresAt, a time.Time that is zero for links that never expire.
+// preview.html is executed with the fields Key and URL, strings, CreatedAt and
+// ExpiresAt, zero when unknown or never, and Stats, a *ClickStats that is nil
+// unless WithPreviewClickStats is given.
+func ParsePages(fsys fs.FS) (*Pages, error) {
+	pages := &Pages{}
+	for name, tmpl := range map[string]**template.Template{
+		"home.html":     &pages.home,
+		"shorten.html":  &pages.shorten,
+		"preview.html":  &pages.preview,
+		"expired.html":  &pages.expired,
+		"fallback.html": &pages.missing,
+		"error.html":    &pages.invalid,
+	} {
+		var err error
+		if *tmpl, err = parsePage(fsys, name); err != nil {
+			return nil, err
+		}
+	}
+	return pages, nil
+}
+
+// parsePage parses the page name from fsys or, when it is not there, from the embedded pages.
+func parsePage(fsys fs.FS, name string) (*template.Template, error) {
+	data, err := fs.ReadFile(embeddedPages, path.Join("html", name))
+	if fsys != nil {
+		custom, customErr := fs.ReadFile(fsys, name)
+		if customErr == nil {
+			data, err = custom, nil
+		} else if !errors.Is(customErr, fs.ErrNotExist) {
+			return nil, customErr
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	return template.New(name).Parse(string(data))
+}
+
+// execute writes tmpl executed with data, answering 500 if it fails.
+func execute(w http.ResponseWriter, tmpl *template.Template, data any) {
+	if err := tmpl.Execute(w, data); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// ShortenerHome is the ShortenerHome function serving the home page of p.
+func (p *Pages) ShortenerHome(w http.ResponseWriter, r *http.Request) {
+	if !allowMethods(w, r, methodNotAllowed, http.MethodGet, http.MethodHead) {
+		return
+	}
+	execute(w, p.home, nil)
+}
+
+// ExpiredUrlHandler is the ExpiredUrlHandler function serving the expired page of p.
+func (p *Pages) ExpiredUrlHandler(w http.ResponseWriter, r *http.Request) {
+	w.WriteHeader(http.StatusGone)
+	execute(w, p.expired, nil)
+}
+
+// MissingUrlHandler is the MissingUrlHandler function serving the fallback page of p.
+func (p *Pages) MissingUrlHandler(w http.ResponseWriter, r *http.Request) {
+	execute(w, p.missing, nil)
+}
+
+// InvalidUrlHandler is the InvalidUrlHandler function serving the error page of p.
+func (p *Pages) InvalidUrlHandler(w http.ResponseWriter, r *http.Request) {
+	execute(w, p.invalid, nil)
+}
@@ -0,0 +1,111 @@
+package urlshort_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"urlshort"
+)
+
+func TestParsePages(t *testing.T) {
+	pages, err := urlshort.ParsePages(fstest.MapFS{
+		"home.html":    {Data: []byte(`<h1>Acme links</h1>`)},
+		"shorten.html": {Data: []byte(`<a href="{{.ShortUrl}}">{{.OriginalUrl}}</a>`)},
+		"other.html":   {Data: []byte(`{{.Ignored`)},
+	})
+	if err != nil {
+		t.Fatalf("error was not expected but got: %s", err.Error())
+	}
+
+	tests := map[string]struct {
+		handler    http.HandlerFunc
+		method     string
+		path       string
+		statusCode int
+		body       string
+	}{
+		"custom home": {
+			handler:    pages.ShortenerHome,
+			method:     "GET",
+			path:       "/home",
+			statusCode: http.StatusOK,
+			body:       "<h1>Acme links</h1>",
+		},
+		"custom shorten": {
+			handler:    urlshort.Shortener(&mockSaver{}, "http://localhost:8080", http.HandlerFunc(statusBadRequestHandlerMock), urlshort.WithPages(pages)),
+			method:     "POST",
+			path:       "/shorten?url=http://www.google.com",
+			statusCode: http.StatusOK,
+			body:       `">http://www.google.com</a>`,
+		},
+		"embedded fallback": {
+			handler:    pages.MissingUrlHandler,
+			method:     "GET",
+			path:       "/short/CSl5Ow",
+			statusCode: http.StatusOK,
+			body:       "The URL you entered is not available.",
+		},
+		"embedded expired": {
+			handler:    pages.ExpiredUrlHandler,
+			method:     "GET",
+			path:       "/short/CSl5Ow",
+			statusCode: http.StatusGone,
+			body:       "The URL you entered has expired.",
+		},
+		"default pages": {
+			handler:    urlshort.ShortenerHome,
+			method:     "GET",
+			path:       "/home",
+			statusCode: http.StatusOK,
+			body:       "<title>URL Shortener</title>",
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			tc.handler(rr, httptest.NewRequest(tc.method, tc.path, nil))
+			if status := rr.Code; status != tc.statusCode {
+				t.Errorf("handler returned wrong status code: got %v want %v", status, tc.statusCode)
+			}
+			if !strings.Contains(rr.Body.String(), tc.body) {
+				t.Errorf("expected body to contain %q, got %q", tc.body, rr.Body.String())
+			}
+		})
+	}
+}
+
+func TestShortenFormsMatch(t *testing.T) {
+	rr := httptest.NewRecorder()
+	urlshort.ShortenerHome(rr, httptest.NewRequest("GET", "/home", nil))
+	home := rr.Body.String()
+	rr = httptest.NewRecorder()
+	urlshort.Shortener(&mockSaver{}, "http://localhost:8080", http.HandlerFunc(statusBadRequestHandlerMock))(rr, httptest.NewRequest("POST", "/shorten?url=http://www.google.com", nil))
+	shorten := rr.Body.String()
+
+	for _, field := range []string{"url", "alias", "expires_in", "status", "query", "preview", "api_key"} {
+		if !strings.Contains(home, `name="`+field+`"`) || !strings.Contains(shorten, `name="`+field+`"`) {
+			t.Errorf("expected the forms of the home and shorten pages to have a %s field", field)
+		}
+	}
+}
+
+func TestParsePagesInvalidTemplate(t *testing.T) {
+	_, err := urlshort.ParsePages(fstest.MapFS{
+		"error.html": {Data: []byte(`<p>{{.Message</p>`)},
+	})
+	if err == nil {
+		t.Error("expected an error for an invalid template")
+	}
+}
+
+func TestWithPagesRequiresPages(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("expected WithPages to panic")
+		}
+	}()
+	urlshort.WithPages(nil)
+}
@@ -0,0 +1,93 @@
+package urlshort
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// previewSuffix follows the key in the path of requests for its preview, such as /short/abc123+.
+const previewSuffix = "+"
+
+// parsePreview parses the optional preview form value, false when it is empty.
+func parsePreview(value string) (bool, error) {
+	if value == "" {
+		return false, nil
+	}
+	preview, err := strconv.ParseBool(value)
+	if err != nil {
+		return false, fmt.Errorf("invalid preview: %q, expected true or false", value)
+	}
+	return preview, nil
+}
+
+// isPreviewRequest reports whether r asks for the preview of a link rather than
+// being redirected to it.
+func isPreviewRequest(r *http.Request) bool {
+	return strings.HasSuffix(strings.TrimRight(r.URL.Path, "/ "), previewSuffix) || r.URL.Query().Get("preview") == "1"
+}
+
+// PreviewHandler will return an http.HandlerFunc that answers GET and HEAD
+// requests with a page describing the link of the key at the end of the
+// request path, optionally followed by +, instead of redirecting to it: its
+// url, when it was created and expires, and its clicks when
+// WithPreviewClickStats is given, along with a button to continue to the url.
+// If the key is not found by getter, then the fallback http.Handler will be
+// called instead. Expired keys are handled by the fallback too unless
+// WithPreviewExpiredHandler is given.
+// Handler must be attached to route /anypath/{key} or it won't work properly,
+// see WithPreview to share the route of RetrieveHandler.
+func PreviewHandler(getter UrlShortGetter, fallback http.Handler, opts ...PreviewOption) http.HandlerFunc {
+	cfg := newPreviewConfig(fallback, opts)
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !allowMethods(w, r, methodNotAllowed, http.MethodGet, http.MethodHead) {
+			return
+		}
+		paths := strings.SplitN(strings.Trim(r.URL.Path, "/ "), "/", 2)
+		if len(paths) != 2 {
+			http.NotFound(w, r)
+			return
+		}
+		key := strings.TrimSuffix(paths[1], previewSuffix)
+		link, err := getter.Get(r.Context(), key)
+		if errors.Is(err, ErrMissingKey) {
+			fallback.ServeHTTP(w, r)
+			return
+		}
+		if errors.Is(err, ErrExpiredKey) {
+			cfg.expired.ServeHTTP(w, r)
+			return
+		}
+		if err != nil {
+			internalError(w, "getting "+key, err)
+			return
+		}
+
+		var stats *ClickStats
+		if cfg.stats != nil {
+			s, err := cfg.stats.ClickStats(r.Context(), key)
+			if err != nil {
+				log.Printf("urlshort: reading clicks of %s: %v", key, err)
+			} else {
+				stats = &s
+			}
+		}
+		execute(w, cfg.pages.preview, struct {
+			Key       string
+			URL       string
+			CreatedAt time.Time
+			ExpiresAt time.Time
+			Stats     *ClickStats
+		}{
+			Key:       key,
+			URL:       link.URL,
+			CreatedAt: link.CreatedAt,
+			ExpiresAt: link.ExpiresAt,
+			Stats:     stats,
+		})
+	}
+}
@@ -0,0 +1,218 @@
+package urlshort_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+	"urlshort"
+)
+
+type mockPreviewGetter struct {
+	preview bool
+}
+
+func (m *mockPreviewGetter) Get(ctx context.Context, key string) (urlshort.Link, error) {
+	if key != "CSl5Ow" {
+		return urlshort.Link{}, urlshort.ErrMissingKey
+	}
+	createdAt := time.Date(2024, time.March, 1, 12, 30, 0, 0, time.UTC)
+	return urlshort.Link{Key: key, URL: "http://www.google.com/?q=go&lang=en", Preview: m.preview, CreatedAt: createdAt}, nil
+}
+
+func TestPreviewHandler(t *testing.T) {
+	tests := map[string]struct {
+		getter     urlshort.UrlShortGetter
+		opts       []urlshort.PreviewOption
+		path       string
+		statusCode int
+		contains   []string
+		excludes   []string
+	}{
+		"preview": {
+			path:       "/short/CSl5Ow",
+			statusCode: http.StatusOK,
+			contains:   []string{`href="http://www.google.com/?q=go&amp;lang=en"`, "Created at: 2024-03-01 12:30 UTC"},
+			excludes:   []string{"Clicks:"},
+		},
+		"key followed by +": {
+			path:       "/short/CSl5Ow+",
+			statusCode: http.StatusOK,
+			contains:   []string{"CSl5Ow leads to"},
+		},
+		"clicks": {
+			opts:       []urlshort.PreviewOption{urlshort.WithPreviewClickStats(&mockClickStatsGetter{})},
+			path:       "/short/CSl5Ow",
+			statusCode: http.StatusOK,
+			contains:   []string{"Clicks: 3"},
+		},
+		"clicks failing": {
+			opts:       []urlshort.PreviewOption{urlshort.WithPreviewClickStats(&mockClickStatsGetter{err: errors.New("unavailable")})},
+			path:       "/short/CSl5Ow",
+			statusCode: http.StatusOK,
+			excludes:   []string{"Clicks:"},
+		},
+		"missing key": {
+			path:       "/short/other",
+			statusCode: http.StatusBadRequest,
+		},
+		"storage failing": {
+			getter:     &mockGetterError{},
+			path:       "/short/CSl5Ow",
+			statusCode: http.StatusInternalServerError,
+			excludes:   []string{"some error"},
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			if tc.getter == nil {
+				tc.getter = &mockPreviewGetter{}
+			}
+			handler := urlshort.PreviewHandler(tc.getter, http.HandlerFunc(statusBadRequestHandlerMock), tc.opts...)
+			rr := httptest.NewRecorder()
+			handler(rr, httptest.NewRequest("GET", tc.path, nil))
+			if status := rr.Code; status != tc.statusCode {
+				t.Fatalf("handler returned wrong status code: got %v want %v", status, tc.statusCode)
+			}
+			for _, s := range tc.contains {
+				if !strings.Contains(rr.Body.String(), s) {
+					t.Errorf("expected body to contain %q, got %q", s, rr.Body.String())
+				}
+			}
+			for _, s := range tc.excludes {
+				if strings.Contains(rr.Body.String(), s) {
+					t.Errorf("expected body not to contain %q, got %q", s, rr.Body.String())
+				}
+			}
+		})
+	}
+}
+
+func TestRetrieveHandlerPreview(t *testing.T) {
+	preview := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+
+	tests := map[string]struct {
+		getter     urlshort.UrlShortGetter
+		opts       []urlshort.RetrieveOption
+		path       string
+		statusCode int
+		clicks     int
+	}{
+		"redirect": {
+			getter:     &mockPreviewGetter{},
+			opts:       []urlshort.RetrieveOption{urlshort.WithPreview(preview)},
+			path:       "/short/CSl5Ow",
+			statusCode: http.StatusMovedPermanently,
+			clicks:     1,
+		},
+		"key followed by +": {
+			getter:     &mockPreviewGetter{},
+			opts:       []urlshort.RetrieveOption{urlshort.WithPreview(preview)},
+			path:       "/short/CSl5Ow+",
+			statusCode: http.StatusOK,
+		},
+		"preview query": {
+			getter:     &mockPreviewGetter{},
+			opts:       []urlshort.RetrieveOption{urlshort.WithPreview(preview)},
+			path:       "/short/CSl5Ow?preview=1",
+			statusCode: http.StatusOK,
+		},
+		"link always previewed": {
+			getter:     &mockPreviewGetter{preview: true},
+			opts:       []urlshort.RetrieveOption{urlshort.WithPreview(preview)},
+			path:       "/short/CSl5Ow",
+			statusCode: http.StatusOK,
+		},
+		"link previewed without preview handler": {
+			getter:     &mockPreviewGetter{preview: true},
+			path:       "/short/CSl5Ow",
+			statusCode: http.StatusMovedPermanently,
+			clicks:     1,
+		},
+		"key followed by + without preview handler": {
+			getter:     &mockPreviewGetter{},
+			path:       "/short/CSl5Ow+",
+			statusCode: http.StatusBadRequest,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			recorder := &mockClickRecorder{}
+			opts := append([]urlshort.RetrieveOption{urlshort.WithClickRecorder(recorder)}, tc.opts...)
+			handler := urlshort.RetrieveHandler(tc.getter, http.HandlerFunc(statusBadRequestHandlerMock), opts...)
+			rr := httptest.NewRecorder()
+			handler(rr, httptest.NewRequest("GET", tc.path, nil))
+			if status := rr.Code; status != tc.statusCode {
+				t.Errorf("handler returned wrong status code: got %v want %v", status, tc.statusCode)
+			}
+			if len(recorder.clicks) != tc.clicks {
+				t.Errorf("expected %d clicks to be recorded, got %d", tc.clicks, len(recorder.clicks))
+			}
+		})
+	}
+}
+
+func TestCreateLinkHandlerPreview(t *testing.T) {
+	saver := &mockSaverCollision{}
+	handler := urlshort.CreateLinkHandler(saver, "http://localhost:8080")
+	rr := httptest.NewRecorder()
+	before := time.Now()
+	handler(rr, httptest.NewRequest("POST", "/api/v1/links", strings.NewReader(`{"url": "http://www.google.com", "preview": true}`)))
+	if status := rr.Code; status != http.StatusCreated {
+		t.Fatalf("handler returned wrong status code: got %v want %v", status, http.StatusCreated)
+	}
+	var link urlshort.LinkResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &link); err != nil {
+		t.Fatal(err)
+	}
+	if !link.Preview || !saver.link.Preview {
+		t.Errorf("expected the link to be saved with a preview")
+	}
+	if link.CreatedAt == nil || link.CreatedAt.Before(before.Truncate(time.Second)) || !link.CreatedAt.Equal(saver.link.CreatedAt) {
+		t.Errorf("expected the creation time of the saved link, got %v and %v saved", link.CreatedAt, saver.link.CreatedAt)
+	}
+}
+
+func TestShortenerPreview(t *testing.T) {
+	tests := map[string]struct {
+		preview    string
+		statusCode int
+		saved      bool
+	}{
+		"no preview":      {preview: "", statusCode: http.StatusOK},
+		"preview":         {preview: "true", statusCode: http.StatusOK, saved: true},
+		"invalid preview": {preview: "maybe", statusCode: http.StatusBadRequest},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			saver := &mockSaverCollision{}
+			handler := urlshort.Shortener(saver, "http://localhost:8080", http.HandlerFunc(statusBadRequestHandlerMock))
+			rr := httptest.NewRecorder()
+			handler(rr, httptest.NewRequest("POST", "/shorten?url=http://www.google.com&preview="+tc.preview, nil))
+			if status := rr.Code; status != tc.statusCode {
+				t.Fatalf("handler returned wrong status code: got %v want %v", status, tc.statusCode)
+			}
+			if saver.link.Preview != tc.saved {
+				t.Errorf("saver got wrong preview: got %v want %v", saver.link.Preview, tc.saved)
+			}
+		})
+	}
+}
+
+func TestWithPreviewPagesRequiresPages(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("expected WithPreviewPages to panic")
+		}
+	}()
+	urlshort.WithPreviewPages(nil)
+}
@@ -0,0 +1,159 @@
+package urlshort
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/skip2/go-qrcode"
+)
+
+// qrSuffix follows the key in the path of requests for its QR code, such as /short/abc123/qr.
+const qrSuffix = "/qr"
+
+// DefaultQRCodeSize is the width and height in pixels of QR codes requested
+// without a size, which must be between MinQRCodeSize and MaxQRCodeSize.
+const (
+	DefaultQRCodeSize = 256
+	MinQRCodeSize     = 64
+	MaxQRCodeSize     = 2048
+)
+
+// qrLevels are the error correction levels of QR codes by the letter they are requested with.
+var qrLevels = map[string]qrcode.RecoveryLevel{
+	"L": qrcode.Low,
+	"M": qrcode.Medium,
+	"Q": qrcode.High,
+	"H": qrcode.Highest,
+}
+
+// isQRCodeRequest reports whether r asks for the QR code of a link rather than
+// being redirected to it.
+func isQRCodeRequest(r *http.Request) bool {
+	_, ok := qrCodeKey(r.URL.Path)
+	return ok
+}
+
+// qrCodeKey returns the key whose QR code path asks for, the segments after the
+// route followed by qrSuffix, and whether there is one. A key named like the
+// suffix, as in /short/qr, is not a request for a QR code.
+func qrCodeKey(path string) (string, bool) {
+	paths := strings.SplitN(strings.Trim(path, "/ "), "/", 2)
+	if len(paths) != 2 || !strings.HasSuffix(paths[1], qrSuffix) {
+		return "", false
+	}
+	key := strings.TrimSuffix(paths[1], qrSuffix)
+	return key, key != ""
+}
+
+// parseQRCodeSize parses the optional size query parameter, DefaultQRCodeSize when it is empty.
+func parseQRCodeSize(value string) (int, error) {
+	if value == "" {
+		return DefaultQRCodeSize, nil
+	}
+	size, err := strconv.Atoi(value)
+	if err != nil || size < MinQRCodeSize || size > MaxQRCodeSize {
+		return 0, fmt.Errorf("invalid size: %q, expected a number of pixels from %d to %d", value, MinQRCodeSize, MaxQRCodeSize)
+	}
+	return size, nil
+}
+
+// parseQRCodeLevel parses the optional level query parameter, M when it is empty.
+func parseQRCodeLevel(value string) (qrcode.RecoveryLevel, error) {
+	if value == "" {
+		return qrcode.Medium, nil
+	}
+	level, ok := qrLevels[strings.ToUpper(value)]
+	if !ok {
+		return 0, fmt.Errorf("invalid level: %q, expected L, M, Q or H", value)
+	}
+	return level, nil
+}
+
+// QRCodeHandler will return an http.HandlerFunc that answers GET and HEAD
+// requests for /anypath/{key}/qr with a QR code of the shortened url of key,
+// built from host like Shortener does, so scanning it is recorded as a click.
+// The optional format query parameter chooses between png, the default, and
+// svg, the optional size parameter the width and height of the code in pixels,
+// from MinQRCodeSize to MaxQRCodeSize and DefaultQRCodeSize by default, and
+// the optional level parameter its error correction level: L, M (the default),
+// Q or H. Invalid parameters are answered with 400 Bad Request. If the key is
+// not found by getter, or has expired, then the fallback http.Handler will be
+// called instead. See WithQRCode to share the route of RetrieveHandler.
+func QRCodeHandler(getter UrlShortGetter, host string, fallback http.Handler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !allowMethods(w, r, methodNotAllowed, http.MethodGet, http.MethodHead) {
+			return
+		}
+		key, ok := qrCodeKey(r.URL.Path)
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+
+		query := r.URL.Query()
+		format := query.Get("format")
+		if format != "" && format != "png" && format != "svg" {
+			http.Error(w, fmt.Sprintf("invalid format: %q, expected png or svg", format), http.StatusBadRequest)
+			return
+		}
+		size, err := parseQRCodeSize(query.Get("size"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		level, err := parseQRCodeLevel(query.Get("level"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		_, err = getter.Get(r.Context(), key)
+		if errors.Is(err, ErrMissingKey) || errors.Is(err, ErrExpiredKey) {
+			fallback.ServeHTTP(w, r)
+			return
+		}
+		if err != nil {
+			internalError(w, "getting "+key, err)
+			return
+		}
+
+		code, err := qrcode.New(fmt.Sprintf("%s/short/%s", host, key), level)
+		if err != nil {
+			internalError(w, "encoding QR code of "+key, err)
+			return
+		}
+		if format == "svg" {
+			w.Header().Set("Content-Type", "image/svg+xml")
+			w.Write(qrCodeSVG(code.Bitmap(), size))
+			return
+		}
+		png, err := code.PNG(size)
+		if err != nil {
+			internalError(w, "rendering QR code of "+key, err)
+			return
+		}
+		w.Header().Set("Content-Type", "image/png")
+		w.Write(png)
+	}
+}
+
+// qrCodeSVG draws bitmap, quiet zone included, as an SVG image size pixels wide
+// and high, with one unit of its view box per module.
+func qrCodeSVG(bitmap [][]bool, size int) []byte {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d" shape-rendering="crispEdges">`, size, size, len(bitmap), len(bitmap))
+	buf.WriteString(`<rect width="100%" height="100%" fill="#fff"/><path fill="#000" d="`)
+	for y, row := range bitmap {
+		for x, dark := range row {
+			if dark {
+				fmt.Fprintf(&buf, "M%d %dh1v1h-1z", x, y)
+			}
+		}
+	}
+	buf.WriteString(`"/></svg>`)
+	return buf.Bytes()
+}
@@ -0,0 +1,178 @@
+package urlshort_test
+
+import (
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"urlshort"
+)
+
+func TestQRCodeHandler(t *testing.T) {
+	tests := map[string]struct {
+		getter      urlshort.UrlShortGetter
+		method      string
+		path        string
+		statusCode  int
+		contentType string
+		size        int
+	}{
+		"png": {
+			getter:      &mockGetter{},
+			method:      "GET",
+			path:        "/short/CSl5Ow/qr",
+			statusCode:  http.StatusOK,
+			contentType: "image/png",
+			size:        urlshort.DefaultQRCodeSize,
+		},
+		"png with size and level": {
+			getter:      &mockGetter{},
+			method:      "GET",
+			path:        "/short/CSl5Ow/qr?format=png&size=512&level=h",
+			statusCode:  http.StatusOK,
+			contentType: "image/png",
+			size:        512,
+		},
+		"svg": {
+			getter:      &mockGetter{},
+			method:      "GET",
+			path:        "/short/CSl5Ow/qr?format=svg&size=128&level=L",
+			statusCode:  http.StatusOK,
+			contentType: "image/svg+xml",
+		},
+		"head": {
+			getter:      &mockGetter{},
+			method:      "HEAD",
+			path:        "/short/CSl5Ow/qr",
+			statusCode:  http.StatusOK,
+			contentType: "image/png",
+		},
+		"invalid format": {
+			getter:     &mockGetter{},
+			method:     "GET",
+			path:       "/short/CSl5Ow/qr?format=gif",
+			statusCode: http.StatusBadRequest,
+		},
+		"size too small": {
+			getter:     &mockGetter{},
+			method:     "GET",
+			path:       "/short/CSl5Ow/qr?size=10",
+			statusCode: http.StatusBadRequest,
+		},
+		"invalid level": {
+			getter:     &mockGetter{},
+			method:     "GET",
+			path:       "/short/CSl5Ow/qr?level=X",
+			statusCode: http.StatusBadRequest,
+		},
+		"missing key": {
+			getter:     &mockGetterMissingKey{},
+			method:     "GET",
+			path:       "/short/CSl5Ow/qr",
+			statusCode: http.StatusBadRequest,
+		},
+		"expired key": {
+			getter:     &mockGetterExpiredKey{},
+			method:     "GET",
+			path:       "/short/CSl5Ow/qr",
+			statusCode: http.StatusBadRequest,
+		},
+		"storage failing": {
+			getter:     &mockGetterError{},
+			method:     "GET",
+			path:       "/short/CSl5Ow/qr",
+			statusCode: http.StatusInternalServerError,
+		},
+		"method not allowed": {
+			getter:     &mockGetter{},
+			method:     "POST",
+			path:       "/short/CSl5Ow/qr",
+			statusCode: http.StatusMethodNotAllowed,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			handler := urlshort.QRCodeHandler(tc.getter, "http://localhost:8080", http.HandlerFunc(statusBadRequestHandlerMock))
+			rr := httptest.NewRecorder()
+			handler(rr, httptest.NewRequest(tc.method, tc.path, nil))
+			if status := rr.Code; status != tc.statusCode {
+				t.Fatalf("handler returned wrong status code: got %v want %v", status, tc.statusCode)
+			}
+			if contentType := rr.Header().Get("Content-Type"); tc.contentType != "" && contentType != tc.contentType {
+				t.Errorf("handler returned wrong content type: got %q want %q", contentType, tc.contentType)
+			}
+			if tc.size != 0 {
+				img, err := png.Decode(rr.Body)
+				if err != nil {
+					t.Fatalf("error was not expected but got: %s", err.Error())
+				}
+				if bounds := img.Bounds(); bounds.Dx() != tc.size || bounds.Dy() != tc.size {
+					t.Errorf("handler returned wrong image size: got %v want %dx%d", bounds.Size(), tc.size, tc.size)
+				}
+			}
+			if strings.Contains(rr.Body.String(), "some error") {
+				t.Errorf("expected the storage error not to be sent, got %q", rr.Body.String())
+			}
+			if tc.contentType == "image/svg+xml" && !strings.HasPrefix(rr.Body.String(), `<svg xmlns="http://www.w3.org/2000/svg" width="128" height="128"`) {
+				t.Errorf("expected an svg image 128 pixels wide, got %q", rr.Body.String())
+			}
+		})
+	}
+}
+
+func TestRetrieveHandlerQRCode(t *testing.T) {
+	qr := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+
+	tests := map[string]struct {
+		opts       []urlshort.RetrieveOption
+		path       string
+		statusCode int
+		clicks     int
+	}{
+		"redirect": {
+			opts:       []urlshort.RetrieveOption{urlshort.WithQRCode(qr)},
+			path:       "/short/CSl5Ow",
+			statusCode: http.StatusMovedPermanently,
+			clicks:     1,
+		},
+		"qr code": {
+			opts:       []urlshort.RetrieveOption{urlshort.WithQRCode(qr)},
+			path:       "/short/CSl5Ow/qr?size=512",
+			statusCode: http.StatusOK,
+		},
+		"qr code without qr code handler": {
+			path:       "/short/CSl5Ow/qr",
+			statusCode: http.StatusBadRequest,
+		},
+		"key named qr": {
+			opts:       []urlshort.RetrieveOption{urlshort.WithQRCode(qr)},
+			path:       "/short/qr",
+			statusCode: http.StatusBadRequest,
+		},
+		"qr code without key": {
+			opts:       []urlshort.RetrieveOption{urlshort.WithQRCode(qr)},
+			path:       "/short//qr",
+			statusCode: http.StatusBadRequest,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			recorder := &mockClickRecorder{}
+			opts := append([]urlshort.RetrieveOption{urlshort.WithClickRecorder(recorder)}, tc.opts...)
+			handler := urlshort.RetrieveHandler(&mockPreviewGetter{}, http.HandlerFunc(statusBadRequestHandlerMock), opts...)
+			rr := httptest.NewRecorder()
+			handler(rr, httptest.NewRequest("GET", tc.path, nil))
+			if status := rr.Code; status != tc.statusCode {
+				t.Errorf("handler returned wrong status code: got %v want %v", status, tc.statusCode)
+			}
+			if len(recorder.clicks) != tc.clicks {
+				t.Errorf("expected %d clicks to be recorded, got %d", tc.clicks, len(recorder.clicks))
+			}
+		})
+	}
+}
@@ -0,0 +1,95 @@
+package urlshort
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// QueryPolicy decides what happens to the query string of a request when it is
+// redirected to a url, which may have a query of its own.
+type QueryPolicy string
+
+const (
+	// QueryDrop ignores the query of the request, redirecting to the url as is.
+	QueryDrop QueryPolicy = "drop"
+	// QueryAppend adds the parameters of the request after those of the url,
+	// keeping both values of parameters found in both.
+	QueryAppend QueryPolicy = "append"
+	// QueryOverride adds the parameters of the request after those of the url,
+	// dropping the parameters of the url the request also has.
+	QueryOverride QueryPolicy = "override"
+)
+
+// DefaultQueryPolicy is the policy of redirects to links and mappings that
+// don't choose their own, see WithQueryPolicy and WithMapQueryPolicy.
+const DefaultQueryPolicy = QueryDrop
+
+// ErrInvalidQueryPolicy is returned for query policies other than QueryDrop, QueryAppend and QueryOverride.
+var ErrInvalidQueryPolicy = errors.New("invalid query policy")
+
+// ValidateQueryPolicy checks that policy is QueryDrop, QueryAppend, QueryOverride
+// or empty for the default policy. The returned error wraps ErrInvalidQueryPolicy.
+func ValidateQueryPolicy(policy QueryPolicy) error {
+	switch policy {
+	case "", QueryDrop, QueryAppend, QueryOverride:
+		return nil
+	}
+	return fmt.Errorf("%w: %q, expected drop, append or override", ErrInvalidQueryPolicy, string(policy))
+}
+
+// queryPolicy returns policy, or def when it is empty.
+func queryPolicy(policy, def QueryPolicy) QueryPolicy {
+	if policy == "" {
+		return def
+	}
+	return policy
+}
+
+// mergeQuery combines the raw query of a request with the query of rawURL
+// according to policy. The url is otherwise kept verbatim, fragment included,
+// and the parameters keep their order and encoding.
+func mergeQuery(rawURL, query string, policy QueryPolicy) string {
+	if query == "" || policy == QueryDrop {
+		return rawURL
+	}
+	base, fragment, hasFragment := strings.Cut(rawURL, "#")
+	base, own, _ := strings.Cut(base, "?")
+	if policy == QueryOverride {
+		own = withoutParams(own, query)
+	}
+	if own != "" {
+		query = own + "&" + query
+	}
+	merged := base + "?" + query
+	if hasFragment {
+		merged += "#" + fragment
+	}
+	return merged
+}
+
+// withoutParams returns the raw query own without the parameters named in the
+// raw query other.
+func withoutParams(own, other string) string {
+	names := make(map[string]bool)
+	for _, param := range strings.Split(other, "&") {
+		names[paramName(param)] = true
+	}
+	var kept []string
+	for _, param := range strings.Split(own, "&") {
+		if param != "" && !names[paramName(param)] {
+			kept = append(kept, param)
+		}
+	}
+	return strings.Join(kept, "&")
+}
+
+// paramName returns the unescaped name of a raw name=value query parameter.
+func paramName(param string) string {
+	name, _, _ := strings.Cut(param, "=")
+	if unescaped, err := url.QueryUnescape(name); err == nil {
+		return unescaped
+	}
+	return name
+}
@@ -0,0 +1,262 @@
+package urlshort_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"urlshort"
+)
+
+type mockQueryGetter struct {
+	url   string
+	query urlshort.QueryPolicy
+}
+
+func (m *mockQueryGetter) Get(ctx context.Context, key string) (urlshort.Link, error) {
+	return urlshort.Link{Key: key, URL: m.url, Query: m.query}, nil
+}
+
+func TestValidateQueryPolicy(t *testing.T) {
+	for _, policy := range []urlshort.QueryPolicy{"", urlshort.QueryDrop, urlshort.QueryAppend, urlshort.QueryOverride} {
+		if err := urlshort.ValidateQueryPolicy(policy); err != nil {
+			t.Errorf("error was not expected for %q but got: %s", policy, err.Error())
+		}
+	}
+	for _, policy := range []urlshort.QueryPolicy{"merge", "Append", " "} {
+		if err := urlshort.ValidateQueryPolicy(policy); !errors.Is(err, urlshort.ErrInvalidQueryPolicy) {
+			t.Errorf("expected ErrInvalidQueryPolicy for %q but got: %v", policy, err)
+		}
+	}
+}
+
+func TestRetrieveHandlerQuery(t *testing.T) {
+	tests := map[string]struct {
+		url      string
+		query    urlshort.QueryPolicy
+		opts     []urlshort.RetrieveOption
+		request  string
+		location string
+	}{
+		"dropped by default": {
+			url:      "https://www.example.com/page?ref=short",
+			request:  "/short/abc123?utm_source=newsletter",
+			location: "https://www.example.com/page?ref=short",
+		},
+		"appended": {
+			url:      "https://www.example.com/page?ref=short",
+			query:    urlshort.QueryAppend,
+			request:  "/short/abc123?utm_source=newsletter&ref=mail",
+			location: "https://www.example.com/page?ref=short&utm_source=newsletter&ref=mail",
+		},
+		"overridden": {
+			url:      "https://www.example.com/page?ref=short&lang=en",
+			query:    urlshort.QueryOverride,
+			request:  "/short/abc123?ref=mail&utm_source=newsletter",
+			location: "https://www.example.com/page?lang=en&ref=mail&utm_source=newsletter",
+		},
+		"url without query": {
+			url:      "https://www.example.com/page",
+			query:    urlshort.QueryOverride,
+			request:  "/short/abc123?utm_source=newsletter",
+			location: "https://www.example.com/page?utm_source=newsletter",
+		},
+		"fragment kept after the query": {
+			url:      "https://www.example.com/page?ref=short#pricing",
+			query:    urlshort.QueryAppend,
+			request:  "/short/abc123?utm_source=news%20letter",
+			location: "https://www.example.com/page?ref=short&utm_source=news%20letter#pricing",
+		},
+		"escaped names overridden": {
+			url:      "https://www.example.com/page?a%20b=1&c=2",
+			query:    urlshort.QueryOverride,
+			request:  "/short/abc123?a+b=3",
+			location: "https://www.example.com/page?c=2&a+b=3",
+		},
+		"request without query": {
+			url:      "https://www.example.com/page?ref=short",
+			query:    urlshort.QueryAppend,
+			request:  "/short/abc123",
+			location: "https://www.example.com/page?ref=short",
+		},
+		"configured default policy": {
+			url:      "https://www.example.com/page",
+			opts:     []urlshort.RetrieveOption{urlshort.WithQueryPolicy(urlshort.QueryAppend)},
+			request:  "/short/abc123?utm_source=newsletter",
+			location: "https://www.example.com/page?utm_source=newsletter",
+		},
+		"policy of the link over configured default": {
+			url:      "https://www.example.com/page",
+			query:    urlshort.QueryDrop,
+			opts:     []urlshort.RetrieveOption{urlshort.WithQueryPolicy(urlshort.QueryAppend)},
+			request:  "/short/abc123?utm_source=newsletter",
+			location: "https://www.example.com/page",
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			getter := &mockQueryGetter{url: tc.url, query: tc.query}
+			handler := urlshort.RetrieveHandler(getter, http.HandlerFunc(statusBadRequestHandlerMock), tc.opts...)
+			rr := httptest.NewRecorder()
+			handler(rr, httptest.NewRequest("GET", tc.request, nil))
+			if location := rr.Header().Get("Location"); location != tc.location {
+				t.Errorf("handler redirected to wrong location: got %v want %v", location, tc.location)
+			}
+		})
+	}
+}
+
+func TestMapHandlerQuery(t *testing.T) {
+	yaml := []byte(`
+- path: /default
+  url: https://www.example.com/default?ref=short
+- path: /append
+  url: https://www.example.com/append?ref=short
+  query: append
+- path: /docs/*
+  url: https://docs.example.com?lang=en
+  query: override
+- path: /gh/{owner}
+  url: https://github.com/{owner}?tab=repositories
+  query: append
+`)
+	tests := map[string]struct {
+		opts     []urlshort.MapOption
+		request  string
+		location string
+	}{
+		"dropped by default":        {request: "/default?utm_source=newsletter", location: "https://www.example.com/default?ref=short"},
+		"policy of the mapping":     {request: "/append?utm_source=newsletter", location: "https://www.example.com/append?ref=short&utm_source=newsletter"},
+		"policy of a prefix":        {request: "/docs/intro?lang=fr", location: "https://docs.example.com/intro?lang=fr"},
+		"policy of a template":      {request: "/gh/gophercises?q=url", location: "https://github.com/gophercises?tab=repositories&q=url"},
+		"configured default policy": {opts: []urlshort.MapOption{urlshort.WithMapQueryPolicy(urlshort.QueryOverride)}, request: "/default?ref=mail", location: "https://www.example.com/default?ref=mail"},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			handler, err := urlshort.YAMLHandler(yaml, http.HandlerFunc(statusBadRequestHandlerMock), tc.opts...)
+			if err != nil {
+				t.Fatalf("error was not expected but got: %s", err.Error())
+			}
+			rr := httptest.NewRecorder()
+			handler(rr, httptest.NewRequest("GET", tc.request, nil))
+			if location := rr.Header().Get("Location"); location != tc.location {
+				t.Errorf("handler redirected to wrong location: got %v want %v", location, tc.location)
+			}
+		})
+	}
+}
+
+func TestQueryPolicyOptionsRequireQueryPolicy(t *testing.T) {
+	for name, option := range map[string]func(){
+		"WithQueryPolicy":    func() { urlshort.WithQueryPolicy("merge") },
+		"WithMapQueryPolicy": func() { urlshort.WithMapQueryPolicy("merge") },
+	} {
+		t.Run(name, func(t *testing.T) {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("expected %s to panic", name)
+				}
+			}()
+			option()
+		})
+	}
+}
+
+func TestCreateLinkHandlerQuery(t *testing.T) {
+	tests := map[string]struct {
+		body       string
+		statusCode int
+		query      urlshort.QueryPolicy
+	}{
+		"no policy":      {body: `{"url": "http://www.google.com"}`, statusCode: http.StatusCreated},
+		"valid policy":   {body: `{"url": "http://www.google.com", "query": "append"}`, statusCode: http.StatusCreated, query: urlshort.QueryAppend},
+		"invalid policy": {body: `{"url": "http://www.google.com", "query": "merge"}`, statusCode: http.StatusBadRequest},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			saver := &mockSaverCollision{}
+			handler := urlshort.CreateLinkHandler(saver, "http://localhost:8080")
+			rr := httptest.NewRecorder()
+			handler(rr, httptest.NewRequest("POST", "/api/v1/links", strings.NewReader(tc.body)))
+			if status := rr.Code; status != tc.statusCode {
+				t.Fatalf("handler returned wrong status code: got %v want %v", status, tc.statusCode)
+			}
+			if tc.statusCode != http.StatusCreated {
+				var body apiErrorBody
+				if err := json.Unmarshal(rr.Body.Bytes(), &body); err != nil {
+					t.Fatal(err)
+				}
+				if body.Error.Code != "invalid_query_policy" {
+					t.Errorf("handler returned wrong error code: got %v want %v", body.Error.Code, "invalid_query_policy")
+				}
+				return
+			}
+			var link urlshort.LinkResponse
+			if err := json.Unmarshal(rr.Body.Bytes(), &link); err != nil {
+				t.Fatal(err)
+			}
+			if link.Query != tc.query || saver.link.Query != tc.query {
+				t.Errorf("expected query policy %q, got %q in the response and %q saved", tc.query, link.Query, saver.link.Query)
+			}
+		})
+	}
+}
+
+func TestCSVHandlerQuery(t *testing.T) {
+	csv := []byte("path,url,query\n/append,https://www.example.com/append?ref=short,append\n/default,https://www.example.com/default?ref=short,\n")
+	handler, err := urlshort.CSVHandler(csv, http.HandlerFunc(statusBadRequestHandlerMock))
+	if err != nil {
+		t.Fatalf("error was not expected but got: %s", err.Error())
+	}
+
+	tests := map[string]struct {
+		request  string
+		location string
+	}{
+		"query column": {request: "/append?utm_source=newsletter", location: "https://www.example.com/append?ref=short&utm_source=newsletter"},
+		"empty query":  {request: "/default?utm_source=newsletter", location: "https://www.example.com/default?ref=short"},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			handler(rr, httptest.NewRequest("GET", tc.request, nil))
+			if location := rr.Header().Get("Location"); location != tc.location {
+				t.Errorf("handler redirected to wrong location: got %v want %v", location, tc.location)
+			}
+		})
+	}
+}
+
+func TestShortenerQuery(t *testing.T) {
+	tests := map[string]struct {
+		query      string
+		statusCode int
+		saved      urlshort.QueryPolicy
+	}{
+		"no policy":      {query: "", statusCode: http.StatusOK},
+		"valid policy":   {query: "override", statusCode: http.StatusOK, saved: urlshort.QueryOverride},
+		"invalid policy": {query: "merge", statusCode: http.StatusBadRequest},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			saver := &mockSaverCollision{}
+			handler := urlshort.Shortener(saver, "http://localhost:8080", http.HandlerFunc(statusBadRequestHandlerMock))
+			rr := httptest.NewRecorder()
+			handler(rr, httptest.NewRequest("POST", "/shorten?url=http://www.google.com&query="+tc.query, nil))
+			if status := rr.Code; status != tc.statusCode {
+				t.Fatalf("handler returned wrong status code: got %v want %v", status, tc.statusCode)
+			}
+			if saver.link.Query != tc.saved {
+				t.Errorf("saver got wrong query policy: got %v want %v", saver.link.Query, tc.saved)
+			}
+		})
+	}
+}
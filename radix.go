@@ -0,0 +1,74 @@
+package urlshort
+
+// radixTree is a compressed prefix tree used to find the longest key that is a
+// prefix of a path in time proportional to the length of the path, however
+// many keys are stored.
+type radixTree[V any] struct {
+	root radixNode[V]
+}
+
+type radixNode[V any] struct {
+	// label is the part of the key between the parent node and this one.
+	label    string
+	children []*radixNode[V]
+	value    V
+	hasValue bool
+}
+
+// child returns the child whose label starts with b, nil if there is none.
+func (n *radixNode[V]) child(b byte) *radixNode[V] {
+	for _, c := range n.children {
+		if c.label[0] == b {
+			return c
+		}
+	}
+	return nil
+}
+
+// insert stores value under key, replacing any value already stored under it.
+func (t *radixTree[V]) insert(key string, value V) {
+	n := &t.root
+	for key != "" {
+		c := n.child(key[0])
+		if c == nil {
+			n.children = append(n.children, &radixNode[V]{label: key, value: value, hasValue: true})
+			return
+		}
+
+		common := 0
+		for common < len(key) && common < len(c.label) && key[common] == c.label[common] {
+			common++
+		}
+		if common < len(c.label) {
+			// split c where key diverges from its label, moving what it holds below
+			rest := &radixNode[V]{label: c.label[common:], children: c.children, value: c.value, hasValue: c.hasValue}
+			var zero V
+			c.label, c.children, c.value, c.hasValue = c.label[:common], []*radixNode[V]{rest}, zero, false
+		}
+		n = c
+		key = key[common:]
+	}
+	n.value, n.hasValue = value, true
+}
+
+// longestPrefix returns the value of the longest key that is a prefix of path
+// ending at a segment boundary, that is, followed in path by a slash or by
+// nothing at all, along with the length of that key.
+func (t *radixTree[V]) longestPrefix(path string) (value V, length int, ok bool) {
+	n := &t.root
+	depth := 0
+	for {
+		if n.hasValue && (depth == len(path) || path[depth] == '/') {
+			value, length, ok = n.value, depth, true
+		}
+		if depth == len(path) {
+			return
+		}
+		c := n.child(path[depth])
+		if c == nil || len(path)-depth < len(c.label) || path[depth:depth+len(c.label)] != c.label {
+			return
+		}
+		depth += len(c.label)
+		n = c
+	}
+}
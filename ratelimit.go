@@ -0,0 +1,90 @@
+package urlshort
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// RateLimit is a token bucket: it holds up to Burst requests and is refilled
+// with Rate requests per second.
+type RateLimit struct {
+	// Name tells the buckets of the limit apart from those of other limits sharing a RateLimiter.
+	Name  string
+	Rate  float64
+	Burst int
+}
+
+// RateLimiter defines a contract for types that know how to keep the token
+// buckets of rate limits, see LimitRate.
+type RateLimiter interface {
+	// Allow takes a token from the bucket key of limit, which starts full, reporting
+	// whether there was one and otherwise how long until there is.
+	Allow(ctx context.Context, key string, limit RateLimit) (bool, time.Duration, error)
+}
+
+// rateLimitKey returns the key of the bucket of r: the ID of its APIKey, see
+// RequireAPIKey, or its client IP, kept only until the bucket is full again.
+func rateLimitKey(r *http.Request, cfg *rateLimitConfig) string {
+	if key, ok := APIKeyFromContext(r.Context()); ok {
+		return "key:" + key.ID
+	}
+	return "ip:" + requestIP(r, cfg.ipHeader)
+}
+
+// requestIP returns the client IP of r, read from header when it is set and r
+// has it or the address of the connection otherwise.
+func requestIP(r *http.Request, header string) string {
+	if header != "" {
+		// Proxies append the address they got the request from, anything
+		// before it came from the client.
+		value := r.Header.Get(header)
+		if ip := strings.TrimSpace(value[strings.LastIndex(value, ",")+1:]); ip != "" {
+			return ip
+		}
+	}
+	return clientIP(r.RemoteAddr)
+}
+
+// clientIP returns the host part of remoteAddr.
+func clientIP(remoteAddr string) string {
+	host, _, err := net.SplitHostPort(remoteAddr)
+	if err != nil {
+		return remoteAddr
+	}
+	return host
+}
+
+// LimitRate will return an http.HandlerFunc that calls next for the requests
+// limiter allows according to limit, and answers the others with 429 Too Many
+// Requests in the JSON error format of the API, with a Retry-After header telling
+// the seconds to wait. Requests authenticated by RequireAPIKey before reaching it
+// are limited per API key and others per client IP, see WithClientIPHeader:
+// wrapping RequireAPIKey with it also counts failed attempts, and wrapping it
+// with RequireAPIKey limits every key whatever the addresses it is used from.
+// Both can be combined. Failing to reach limiter is logged and lets requests through.
+// It panics unless limit has a positive Rate and Burst.
+func LimitRate(limiter RateLimiter, limit RateLimit, next http.Handler, opts ...RateLimitOption) http.HandlerFunc {
+	if limit.Rate <= 0 || limit.Burst <= 0 {
+		panic(fmt.Sprintf("urlshort: LimitRate: invalid limit %+v, expected a positive Rate and Burst", limit))
+	}
+	cfg := newRateLimitConfig(opts)
+	return func(w http.ResponseWriter, r *http.Request) {
+		key := limit.Name + ":" + rateLimitKey(r, cfg)
+		allowed, retryAfter, err := limiter.Allow(r.Context(), key, limit)
+		if err != nil {
+			log.Printf("urlshort: rate limiting %s: %v", key, err)
+		} else if !allowed {
+			w.Header().Set("Retry-After", strconv.FormatInt(max(1, int64(math.Ceil(retryAfter.Seconds()))), 10))
+			writeJSONError(w, http.StatusTooManyRequests, "rate_limited", "too many requests, retry later")
+			return
+		}
+		next.ServeHTTP(w, r)
+	}
+}
@@ -0,0 +1,125 @@
+package urlshort_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+	"urlshort"
+)
+
+type mockRateLimiter struct {
+	allowed    bool
+	retryAfter time.Duration
+	err        error
+	keys       []string
+}
+
+func (m *mockRateLimiter) Allow(ctx context.Context, key string, limit urlshort.RateLimit) (bool, time.Duration, error) {
+	m.keys = append(m.keys, key)
+	return m.allowed, m.retryAfter, m.err
+}
+
+func TestLimitRate(t *testing.T) {
+	tests := map[string]struct {
+		limiter    *mockRateLimiter
+		opts       []urlshort.RateLimitOption
+		header     http.Header
+		statusCode int
+		retryAfter string
+		keyPrefix  string
+	}{
+		"allowed": {
+			limiter:    &mockRateLimiter{allowed: true},
+			statusCode: http.StatusOK,
+			keyPrefix:  "create:ip:",
+		},
+		"denied": {
+			limiter:    &mockRateLimiter{retryAfter: 1500 * time.Millisecond},
+			statusCode: http.StatusTooManyRequests,
+			retryAfter: "2",
+		},
+		"denied for less than a second": {
+			limiter:    &mockRateLimiter{retryAfter: time.Millisecond},
+			statusCode: http.StatusTooManyRequests,
+			retryAfter: "1",
+		},
+		"limiter failing": {
+			limiter:    &mockRateLimiter{err: errors.New("unavailable")},
+			statusCode: http.StatusOK,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			handler := urlshort.LimitRate(tc.limiter, urlshort.RateLimit{Name: "create", Rate: 1, Burst: 5}, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}), tc.opts...)
+			rr := httptest.NewRecorder()
+			handler(rr, httptest.NewRequest("POST", "/shorten", nil))
+			if status := rr.Code; status != tc.statusCode {
+				t.Fatalf("handler returned wrong status code: got %v want %v", status, tc.statusCode)
+			}
+			if retryAfter := rr.Header().Get("Retry-After"); retryAfter != tc.retryAfter {
+				t.Errorf("handler returned wrong Retry-After: got %q want %q", retryAfter, tc.retryAfter)
+			}
+			if len(tc.limiter.keys) != 1 || !strings.HasPrefix(tc.limiter.keys[0], tc.keyPrefix) {
+				t.Errorf("expected one bucket starting with %q, got %v", tc.keyPrefix, tc.limiter.keys)
+			}
+		})
+	}
+}
+
+func TestLimitRateKeys(t *testing.T) {
+	getter, token, _ := newMockAPIKeyGetter(t)
+	id, _, _ := strings.Cut(token, ".")
+	limit := urlshort.RateLimit{Name: "create", Rate: 1, Burst: 5}
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+
+	limiter := &mockRateLimiter{allowed: true}
+	handler := urlshort.RequireAPIKey(getter, urlshort.LimitRate(limiter, limit, next))
+	req := httptest.NewRequest("POST", "/api/v1/links", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	handler(httptest.NewRecorder(), req)
+	if len(limiter.keys) != 1 || limiter.keys[0] != "create:key:"+id {
+		t.Errorf("expected the bucket of the api key, got %v", limiter.keys)
+	}
+
+	// limiting both before and after authenticating counts failed attempts per ip
+	limiter = &mockRateLimiter{allowed: true}
+	handler = urlshort.LimitRate(limiter, limit, urlshort.RequireAPIKey(getter, urlshort.LimitRate(limiter, limit, next)))
+	for _, authorization := range []string{"Bearer " + token, "Bearer " + id + ".wrong"} {
+		req = httptest.NewRequest("POST", "/api/v1/links", nil)
+		req.RemoteAddr = "192.0.2.1:1234"
+		req.Header.Set("Authorization", authorization)
+		handler(httptest.NewRecorder(), req)
+	}
+	if strings.Join(limiter.keys, " ") != "create:ip:192.0.2.1 create:key:"+id+" create:ip:192.0.2.1" {
+		t.Errorf("expected the buckets of the ip and the api key, then of the ip alone, got %v", limiter.keys)
+	}
+
+	limiter = &mockRateLimiter{allowed: true}
+	handler = urlshort.LimitRate(limiter, limit, next, urlshort.WithClientIPHeader("X-Forwarded-For"))
+	for _, forwardedFor := range []string{"203.0.113.7", "198.51.100.1, 203.0.113.7", "203.0.113.7, 10.0.0.2", ""} {
+		req = httptest.NewRequest("POST", "/shorten", nil)
+		req.RemoteAddr = "10.0.0.1:1234"
+		req.Header.Set("X-Forwarded-For", forwardedFor)
+		handler(httptest.NewRecorder(), req)
+	}
+	if len(limiter.keys) != 4 || limiter.keys[0] != "create:ip:203.0.113.7" || limiter.keys[1] != limiter.keys[0] {
+		t.Errorf("expected the first two requests to share the bucket of the ip added by the proxy, got %v", limiter.keys)
+	}
+	if limiter.keys[2] != "create:ip:10.0.0.2" || limiter.keys[3] != "create:ip:10.0.0.1" {
+		t.Errorf("expected the ip added by the proxy, or the connection address without one, got %v", limiter.keys[2:])
+	}
+}
+
+func TestLimitRateRequiresLimit(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("expected LimitRate to panic")
+		}
+	}()
+	urlshort.LimitRate(&mockRateLimiter{}, urlshort.RateLimit{Name: "create", Burst: 5}, http.NotFoundHandler())
+}
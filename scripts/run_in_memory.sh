@@ -0,0 +1,7 @@
+#!/bin/sh
+export HOST=http://localhost:8080
+export PORT=8080
+export STORAGE=memory
+export REDIS_EXPIRATION_MINUTES=60
+
+go run ./cmd/redis
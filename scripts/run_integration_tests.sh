@@ -1,7 +1,6 @@
 #!/bin/sh
 export REDIS_HOST=localhost
 export REDIS_PORT=6379
-export REDIS_EXPIRATION_MINUTES=60
 export RUN_INTEGRATION_TESTS=true
 
 docker compose -f docker/redis/redis.yaml up -d
@@ -0,0 +1,8 @@
+#!/bin/sh
+export HOST=http://localhost:8080
+export PORT=8080
+export STORAGE=disk
+export DISK_PATH=urlshort.db
+export REDIS_EXPIRATION_MINUTES=60
+
+go run ./cmd/redis
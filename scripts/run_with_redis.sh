@@ -7,4 +7,4 @@ export REDIS_EXPIRATION_MINUTES=60
 
 docker compose -f docker/redis/redis.yaml up -d
 
-go run cmd/redis/main.go
\ No newline at end of file
+go run ./cmd/redis
\ No newline at end of file
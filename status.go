@@ -0,0 +1,47 @@
+package urlshort
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+)
+
+// DefaultRedirectStatus is the status of redirects to links and mappings that
+// don't choose their own, see WithRedirectStatus and WithMapRedirectStatus.
+const DefaultRedirectStatus = http.StatusMovedPermanently
+
+// ErrInvalidStatus is returned for status codes links and mappings can't redirect with.
+var ErrInvalidStatus = errors.New("invalid redirect status")
+
+// ValidateRedirectStatus checks that status can be used to redirect to a link
+// or mapping: 301 or 308, which browsers may cache for good, 302 or 307, which
+// they ask for every time, or 0 for the default status. 307 and 308 keep the
+// method of the request. The returned error wraps ErrInvalidStatus.
+func ValidateRedirectStatus(status int) error {
+	switch status {
+	case 0, http.StatusMovedPermanently, http.StatusFound, http.StatusTemporaryRedirect, http.StatusPermanentRedirect:
+		return nil
+	}
+	return fmt.Errorf("%w: %d, expected 301, 302, 307 or 308", ErrInvalidStatus, status)
+}
+
+// parseRedirectStatus parses the optional status form value, 0 when it is empty.
+func parseRedirectStatus(value string) (int, error) {
+	if value == "" {
+		return 0, nil
+	}
+	status, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, fmt.Errorf("%w: %q is not a number", ErrInvalidStatus, value)
+	}
+	return status, ValidateRedirectStatus(status)
+}
+
+// redirectStatus returns status, or def when it is 0.
+func redirectStatus(status, def int) int {
+	if status == 0 {
+		return def
+	}
+	return status
+}
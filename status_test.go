@@ -0,0 +1,198 @@
+package urlshort_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"urlshort"
+)
+
+type mockStatusGetter struct {
+	status int
+}
+
+func (m *mockStatusGetter) Get(ctx context.Context, key string) (urlshort.Link, error) {
+	return urlshort.Link{Key: key, URL: "http://www.google.com", Status: m.status}, nil
+}
+
+func TestValidateRedirectStatus(t *testing.T) {
+	for _, status := range []int{0, 301, 302, 307, 308} {
+		if err := urlshort.ValidateRedirectStatus(status); err != nil {
+			t.Errorf("error was not expected for %d but got: %s", status, err.Error())
+		}
+	}
+	for _, status := range []int{200, 303, 304, 404, -1} {
+		if err := urlshort.ValidateRedirectStatus(status); !errors.Is(err, urlshort.ErrInvalidStatus) {
+			t.Errorf("expected ErrInvalidStatus for %d but got: %v", status, err)
+		}
+	}
+}
+
+func TestRetrieveHandlerStatus(t *testing.T) {
+	tests := map[string]struct {
+		getter     urlshort.UrlShortGetter
+		opts       []urlshort.RetrieveOption
+		statusCode int
+	}{
+		"default status": {
+			getter:     &mockStatusGetter{},
+			statusCode: http.StatusMovedPermanently,
+		},
+		"status of the link": {
+			getter:     &mockStatusGetter{status: http.StatusTemporaryRedirect},
+			statusCode: http.StatusTemporaryRedirect,
+		},
+		"configured default status": {
+			getter:     &mockStatusGetter{},
+			opts:       []urlshort.RetrieveOption{urlshort.WithRedirectStatus(http.StatusFound)},
+			statusCode: http.StatusFound,
+		},
+		"status of the link over configured default": {
+			getter:     &mockStatusGetter{status: http.StatusPermanentRedirect},
+			opts:       []urlshort.RetrieveOption{urlshort.WithRedirectStatus(http.StatusFound)},
+			statusCode: http.StatusPermanentRedirect,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			handler := urlshort.RetrieveHandler(tc.getter, http.HandlerFunc(statusBadRequestHandlerMock), tc.opts...)
+			rr := httptest.NewRecorder()
+			handler(rr, httptest.NewRequest("GET", "/short/CSl5Ow", nil))
+			if status := rr.Code; status != tc.statusCode {
+				t.Errorf("handler returned wrong status code: got %v want %v", status, tc.statusCode)
+			}
+		})
+	}
+}
+
+func TestMapHandlerStatus(t *testing.T) {
+	yaml := []byte(`
+- path: /default
+  url: https://www.example.com/default
+- path: /temporary
+  url: https://www.example.com/temporary
+  status: 302
+- path: /docs/*
+  url: https://docs.example.com
+  status: 307
+- path: /gh/{owner}
+  url: https://github.com/{owner}
+  status: 308
+`)
+	tests := map[string]struct {
+		opts       []urlshort.MapOption
+		path       string
+		statusCode int
+	}{
+		"default status":                    {path: "/default", statusCode: http.StatusMovedPermanently},
+		"status of the mapping":             {path: "/temporary", statusCode: http.StatusFound},
+		"status of a prefix":                {path: "/docs/intro", statusCode: http.StatusTemporaryRedirect},
+		"status of a template":              {path: "/gh/gophercises", statusCode: http.StatusPermanentRedirect},
+		"configured default status":         {opts: []urlshort.MapOption{urlshort.WithMapRedirectStatus(http.StatusFound)}, path: "/default", statusCode: http.StatusFound},
+		"status of the mapping over option": {opts: []urlshort.MapOption{urlshort.WithMapRedirectStatus(http.StatusPermanentRedirect)}, path: "/temporary", statusCode: http.StatusFound},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			handler, err := urlshort.YAMLHandler(yaml, http.HandlerFunc(statusBadRequestHandlerMock), tc.opts...)
+			if err != nil {
+				t.Fatalf("error was not expected but got: %s", err.Error())
+			}
+			rr := httptest.NewRecorder()
+			handler(rr, httptest.NewRequest("GET", tc.path, nil))
+			if status := rr.Code; status != tc.statusCode {
+				t.Errorf("handler returned wrong status code: got %v want %v", status, tc.statusCode)
+			}
+		})
+	}
+}
+
+func TestRedirectStatusOptionsRequireRedirectStatus(t *testing.T) {
+	for name, option := range map[string]func(){
+		"WithRedirectStatus":    func() { urlshort.WithRedirectStatus(http.StatusOK) },
+		"WithMapRedirectStatus": func() { urlshort.WithMapRedirectStatus(http.StatusNotFound) },
+	} {
+		t.Run(name, func(t *testing.T) {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("expected %s to panic", name)
+				}
+			}()
+			option()
+		})
+	}
+}
+
+func TestCreateLinkHandlerStatus(t *testing.T) {
+	tests := map[string]struct {
+		body       string
+		statusCode int
+		status     int
+	}{
+		"no status":      {body: `{"url": "http://www.google.com"}`, statusCode: http.StatusCreated},
+		"valid status":   {body: `{"url": "http://www.google.com", "status": 302}`, statusCode: http.StatusCreated, status: 302},
+		"invalid status": {body: `{"url": "http://www.google.com", "status": 200}`, statusCode: http.StatusBadRequest},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			saver := &mockSaverCollision{}
+			handler := urlshort.CreateLinkHandler(saver, "http://localhost:8080")
+			rr := httptest.NewRecorder()
+			handler(rr, httptest.NewRequest("POST", "/api/v1/links", strings.NewReader(tc.body)))
+			if status := rr.Code; status != tc.statusCode {
+				t.Fatalf("handler returned wrong status code: got %v want %v", status, tc.statusCode)
+			}
+			if tc.statusCode != http.StatusCreated {
+				var body apiErrorBody
+				if err := json.Unmarshal(rr.Body.Bytes(), &body); err != nil {
+					t.Fatal(err)
+				}
+				if body.Error.Code != "invalid_status" {
+					t.Errorf("handler returned wrong error code: got %v want %v", body.Error.Code, "invalid_status")
+				}
+				return
+			}
+			var link urlshort.LinkResponse
+			if err := json.Unmarshal(rr.Body.Bytes(), &link); err != nil {
+				t.Fatal(err)
+			}
+			if link.Status != tc.status || saver.link.Status != tc.status {
+				t.Errorf("expected status %d, got %d in the response and %d saved", tc.status, link.Status, saver.link.Status)
+			}
+		})
+	}
+}
+
+func TestShortenerStatus(t *testing.T) {
+	tests := map[string]struct {
+		status     string
+		statusCode int
+		saved      int
+	}{
+		"no status":      {status: "", statusCode: http.StatusOK},
+		"valid status":   {status: "307", statusCode: http.StatusOK, saved: 307},
+		"invalid status": {status: "200", statusCode: http.StatusBadRequest},
+		"not a number":   {status: "found", statusCode: http.StatusBadRequest},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			saver := &mockSaverCollision{}
+			handler := urlshort.Shortener(saver, "http://localhost:8080", http.HandlerFunc(statusBadRequestHandlerMock))
+			rr := httptest.NewRecorder()
+			handler(rr, httptest.NewRequest("POST", "/shorten?url=http://www.google.com&status="+tc.status, nil))
+			if status := rr.Code; status != tc.statusCode {
+				t.Fatalf("handler returned wrong status code: got %v want %v", status, tc.statusCode)
+			}
+			if saver.link.Status != tc.saved {
+				t.Errorf("saver got wrong status: got %v want %v", saver.link.Status, tc.saved)
+			}
+		})
+	}
+}
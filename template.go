@@ -0,0 +1,144 @@
+package urlshort
+
+import (
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// urlPlaceholderPattern matches the {name} placeholders of the url of a path template.
+var urlPlaceholderPattern = regexp.MustCompile(`\{([^{}]*)\}`)
+
+// placeholderNamePattern matches valid placeholder names.
+var placeholderNamePattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// isTemplate reports whether path has placeholders, see MapHandler.
+func isTemplate(path string) bool {
+	return strings.ContainsAny(path, "{}")
+}
+
+// placeholderName returns the name of segment if it is a {name} placeholder.
+func placeholderName(segment string) (string, bool) {
+	if len(segment) < 2 || segment[0] != '{' || segment[len(segment)-1] != '}' {
+		return "", false
+	}
+	return segment[1 : len(segment)-1], true
+}
+
+// templateKey returns path with the names of its placeholders dropped, so
+// templates matching the same requests have the same key.
+func templateKey(path string) string {
+	if !isTemplate(path) {
+		return path
+	}
+	segments := strings.Split(path, "/")
+	for i, segment := range segments {
+		if _, ok := placeholderName(segment); ok {
+			segments[i] = "{}"
+		}
+	}
+	return strings.Join(segments, "/")
+}
+
+// templateTree matches request paths against path templates segment by
+// segment, so a request is only compared to the templates sharing its
+// leading segments.
+type templateTree struct {
+	root templateNode
+}
+
+type templateNode struct {
+	literals map[string]*templateNode
+	param    *templateNode
+	// names are the placeholders of the template ending at this node, in
+	// order, and target is where that template redirects to.
+	names     []string
+	target    redirect
+	hasTarget bool
+}
+
+// insert adds the template path redirecting to target.
+func (t *templateTree) insert(path string, target redirect) {
+	n := &t.root
+	var names []string
+	for _, segment := range strings.Split(strings.TrimPrefix(path, "/"), "/") {
+		if name, ok := placeholderName(segment); ok {
+			names = append(names, name)
+			if n.param == nil {
+				n.param = &templateNode{}
+			}
+			n = n.param
+			continue
+		}
+		if n.literals == nil {
+			n.literals = make(map[string]*templateNode)
+		}
+		child, ok := n.literals[segment]
+		if !ok {
+			child = &templateNode{}
+			n.literals[segment] = child
+		}
+		n = child
+	}
+	n.names, n.target, n.hasTarget = names, target, true
+}
+
+// match returns the target of the template matching path with the
+// placeholders of its url replaced by the segments they matched. Literal
+// segments are preferred over placeholders, which only match non empty segments.
+func (t *templateTree) match(path string) (redirect, bool) {
+	segments := strings.Split(strings.TrimPrefix(path, "/"), "/")
+	n, values := t.root.match(segments, make([]string, 0, len(segments)))
+	if n == nil {
+		return redirect{}, false
+	}
+	target := n.target
+	target.url = expandURL(target.url, n.names, values)
+	return target, true
+}
+
+func (n *templateNode) match(segments, values []string) (*templateNode, []string) {
+	if len(segments) == 0 {
+		if n.hasTarget {
+			return n, values
+		}
+		return nil, nil
+	}
+	if child, ok := n.literals[segments[0]]; ok {
+		if m, v := child.match(segments[1:], values); m != nil {
+			return m, v
+		}
+	}
+	if n.param != nil && segments[0] != "" {
+		return n.param.match(segments[1:], append(values, segments[0]))
+	}
+	return nil, nil
+}
+
+// expandURL replaces the {name} placeholders of rawURL by the value of the
+// matching name, escaped for the path or, after the ?, for the query.
+func expandURL(rawURL string, names, values []string) string {
+	byName := make(map[string]string, len(names))
+	for i, name := range names {
+		byName[name] = values[i]
+	}
+	query := strings.IndexByte(rawURL, '?')
+
+	var b strings.Builder
+	last := 0
+	for _, loc := range urlPlaceholderPattern.FindAllStringSubmatchIndex(rawURL, -1) {
+		value, ok := byName[rawURL[loc[2]:loc[3]]]
+		if !ok {
+			continue
+		}
+		b.WriteString(rawURL[last:loc[0]])
+		if query >= 0 && loc[0] > query {
+			b.WriteString(url.QueryEscape(value))
+		} else {
+			b.WriteString(url.PathEscape(value))
+		}
+		last = loc[1]
+	}
+	b.WriteString(rawURL[last:])
+	return b.String()
+}
@@ -0,0 +1,150 @@
+package urlshort
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// Problems found validating the entries of mapping documents, wrapped in a MappingError.
+var (
+	ErrRepeatedPath       = errors.New("repeated path")
+	ErrMissingPath        = errors.New("missing path")
+	ErrInvalidPath        = errors.New("invalid path")
+	ErrMissingURL         = errors.New("missing url")
+	ErrMalformedURL       = errors.New("malformed url")
+	ErrUnsupportedScheme  = errors.New("unsupported url scheme")
+	ErrUnknownPlaceholder = errors.New("unknown placeholder")
+)
+
+// MappingError is a problem with a single entry of a mapping document.
+type MappingError struct {
+	// File is the name of the document, see MappingFile. It is empty for the
+	// documents given to YAMLHandler and JSONHandler.
+	File string
+	// Index is the position of the entry within its document, starting at 0.
+	Index int
+	// Line and Column locate the entry in YAML and CSV documents, starting at 1.
+	// They are 0 for other formats.
+	Line   int
+	Column int
+	// Err is the problem, one of ErrRepeatedPath, ErrMissingPath, ErrInvalidPath,
+	// ErrMissingURL, ErrMalformedURL, ErrUnsupportedScheme, ErrUnknownPlaceholder,
+	// ErrInvalidStatus or ErrInvalidQueryPolicy.
+	Err error
+	// Detail describes the offending value.
+	Detail string
+}
+
+func (e *MappingError) Error() string {
+	msg := fmt.Sprintf("%s: %v", formatLocation(e.File, e.Index, e.Line, e.Column), e.Err)
+	if e.Detail != "" {
+		msg += ": " + e.Detail
+	}
+	return msg
+}
+
+func (e *MappingError) Unwrap() error {
+	return e.Err
+}
+
+// MappingErrors are all the problems found validating mapping documents, in the
+// order of the entries. errors.Is and errors.As look into every one of them.
+type MappingErrors []*MappingError
+
+func (e MappingErrors) Error() string {
+	msgs := make([]string, len(e))
+	for i, err := range e {
+		msgs[i] = err.Error()
+	}
+	return strings.Join(msgs, "\n")
+}
+
+func (e MappingErrors) Unwrap() []error {
+	errs := make([]error, len(e))
+	for i, err := range e {
+		errs[i] = err
+	}
+	return errs
+}
+
+// formatLocation describes where an entry was read from, like paths.yml[2] (line 5, column 3).
+func formatLocation(file string, index, line, column int) string {
+	location := fmt.Sprintf("%s[%d]", file, index)
+	if line > 0 {
+		location += fmt.Sprintf(" (line %d, column %d)", line, column)
+	}
+	return location
+}
+
+// validate returns the problems of the entry on its own, regardless of the rest.
+func (m uRLMapper) validate() []*MappingError {
+	var errs []*MappingError
+	placeholders := make(map[string]bool)
+	if m.Path == "" {
+		errs = append(errs, m.mappingError(ErrMissingPath, ""))
+	} else if !strings.HasPrefix(m.Path, "/") {
+		errs = append(errs, m.mappingError(ErrInvalidPath, fmt.Sprintf("%q must start with /", m.Path)))
+	} else if strings.Contains(strings.TrimSuffix(m.Path, "/*"), "*") {
+		errs = append(errs, m.mappingError(ErrInvalidPath, fmt.Sprintf("%q can only end in /* to map every path below it", m.Path)))
+	} else if isTemplate(m.Path) {
+		if detail := parsePlaceholders(m.Path, placeholders); detail != "" {
+			errs = append(errs, m.mappingError(ErrInvalidPath, detail))
+		}
+	}
+	if ValidateRedirectStatus(m.Status) != nil {
+		errs = append(errs, m.mappingError(ErrInvalidStatus, fmt.Sprintf("%d, expected 301, 302, 307 or 308", m.Status)))
+	}
+	if ValidateQueryPolicy(m.Query) != nil {
+		errs = append(errs, m.mappingError(ErrInvalidQueryPolicy, fmt.Sprintf("%q, expected drop, append or override", string(m.Query))))
+	}
+
+	if m.URL == "" {
+		return append(errs, m.mappingError(ErrMissingURL, ""))
+	}
+	for _, match := range urlPlaceholderPattern.FindAllStringSubmatch(m.URL, -1) {
+		if !placeholders[match[1]] {
+			errs = append(errs, m.mappingError(ErrUnknownPlaceholder, fmt.Sprintf("%s in url is not a placeholder of path %q", match[0], m.Path)))
+		}
+	}
+	// placeholders are checked above, the rest of the url must be valid whatever they are replaced by
+	u, err := url.Parse(urlPlaceholderPattern.ReplaceAllString(m.URL, "placeholder"))
+	switch {
+	case err != nil:
+		errs = append(errs, m.mappingError(ErrMalformedURL, err.Error()))
+	case u.Scheme == "":
+		errs = append(errs, m.mappingError(ErrMalformedURL, fmt.Sprintf("%q is not absolute", m.URL)))
+	case u.Scheme != "http" && u.Scheme != "https":
+		errs = append(errs, m.mappingError(ErrUnsupportedScheme, fmt.Sprintf("%q, expected http or https", u.Scheme)))
+	case u.Host == "":
+		errs = append(errs, m.mappingError(ErrMalformedURL, fmt.Sprintf("%q has no host", m.URL)))
+	}
+	return errs
+}
+
+// parsePlaceholders adds the placeholders of the template path to names and
+// describes what is wrong with them, if anything.
+func parsePlaceholders(path string, names map[string]bool) string {
+	if strings.HasSuffix(path, "/*") {
+		return fmt.Sprintf("%q can't have placeholders and end in /*", path)
+	}
+	for _, segment := range strings.Split(path, "/") {
+		if !strings.ContainsAny(segment, "{}") {
+			continue
+		}
+		name, ok := placeholderName(segment)
+		if !ok || !placeholderNamePattern.MatchString(name) {
+			return fmt.Sprintf("%q placeholders must be whole segments like {name}, made of letters, digits and _", path)
+		}
+		if names[name] {
+			return fmt.Sprintf("%q repeats placeholder {%s}", path, name)
+		}
+		names[name] = true
+	}
+	return ""
+}
+
+func (m uRLMapper) mappingError(err error, detail string) *MappingError {
+	return &MappingError{File: m.source, Index: m.index, Line: m.line, Column: m.column, Err: err, Detail: detail}
+}
@@ -0,0 +1,205 @@
+package urlshort_test
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+	"urlshort"
+)
+
+func TestMappingValidation(t *testing.T) {
+	tests := map[string]struct {
+		file     urlshort.MappingFile
+		expected []urlshort.MappingError
+	}{
+		"valid yaml": {
+			file: urlshort.MappingFile{Format: urlshort.FormatYAML, Data: []byte(`
+- path: /urlshort
+  url: https://github.com/gophercises/urlshort
+`)},
+		},
+		"every problem in yaml": {
+			file: urlshort.MappingFile{Name: "paths.yml", Format: urlshort.FormatYAML, Data: []byte(`
+- path: /urlshort
+  url: https://github.com/gophercises/urlshort
+- path: /urlshort
+  url: https://www.example.com
+- url: https://www.example.com
+- path: urlshort
+- path: /relative
+  url: github.com/gophercises/urlshort
+- path: /ftp
+  url: ftp://example.com/file
+- path: /bad-escape
+  url: "https://example.com/%zz"
+-   path: /no-host
+    url: "https://"
+- path: /docs/*/guide
+  url: https://docs.example.com
+- path: /docs/*
+  url: https://docs.example.com
+`)},
+			expected: []urlshort.MappingError{
+				{File: "paths.yml", Index: 1, Line: 4, Column: 3, Err: urlshort.ErrRepeatedPath},
+				{File: "paths.yml", Index: 2, Line: 6, Column: 3, Err: urlshort.ErrMissingPath},
+				{File: "paths.yml", Index: 3, Line: 7, Column: 3, Err: urlshort.ErrInvalidPath},
+				{File: "paths.yml", Index: 3, Line: 7, Column: 3, Err: urlshort.ErrMissingURL},
+				{File: "paths.yml", Index: 4, Line: 8, Column: 3, Err: urlshort.ErrMalformedURL},
+				{File: "paths.yml", Index: 5, Line: 10, Column: 3, Err: urlshort.ErrUnsupportedScheme},
+				{File: "paths.yml", Index: 6, Line: 12, Column: 3, Err: urlshort.ErrMalformedURL},
+				{File: "paths.yml", Index: 7, Line: 14, Column: 5, Err: urlshort.ErrMalformedURL},
+				{File: "paths.yml", Index: 8, Line: 16, Column: 3, Err: urlshort.ErrInvalidPath},
+			},
+		},
+		"valid templates": {
+			file: urlshort.MappingFile{Format: urlshort.FormatYAML, Data: []byte(`
+- path: /gh/{owner}/{repo}
+  url: https://github.com/{owner}/{repo}?ref={owner}
+- path: /team/{team}
+  url: https://{team}.example.com
+- path: /gh/{owner}/stars
+  url: https://github.com/{owner}?tab=stars
+`)},
+		},
+		"problems in templates": {
+			file: urlshort.MappingFile{Name: "paths.yml", Format: urlshort.FormatYAML, Data: []byte(`
+- path: /gh/{owner}/{repo}
+  url: https://github.com/{owner}/{repo}
+- path: /gh/{user}/{name}
+  url: https://github.com/{user}/{name}
+- path: /gh/{owner}
+  url: https://github.com/{owner}/{repo}
+- path: /gh/x{owner}
+  url: https://github.com
+- path: /gh/{owner}/{owner}
+  url: https://github.com
+- path: /gh/{owner}/*
+  url: https://github.com
+- path: /gh/{}/y
+  url: https://github.com
+`)},
+			expected: []urlshort.MappingError{
+				{File: "paths.yml", Index: 1, Line: 4, Column: 3, Err: urlshort.ErrRepeatedPath},
+				{File: "paths.yml", Index: 2, Line: 6, Column: 3, Err: urlshort.ErrUnknownPlaceholder},
+				{File: "paths.yml", Index: 3, Line: 8, Column: 3, Err: urlshort.ErrInvalidPath},
+				{File: "paths.yml", Index: 4, Line: 10, Column: 3, Err: urlshort.ErrInvalidPath},
+				{File: "paths.yml", Index: 5, Line: 12, Column: 3, Err: urlshort.ErrInvalidPath},
+				{File: "paths.yml", Index: 6, Line: 14, Column: 3, Err: urlshort.ErrInvalidPath},
+			},
+		},
+		"problems in csv": {
+			file: urlshort.MappingFile{Name: "paths.csv", Format: urlshort.FormatCSV, Data: []byte(`path,url,notes
+/urlshort,https://github.com/gophercises/urlshort,"spans
+two lines"
+/urlshort,https://www.example.com,
+/other,,
+`)},
+			expected: []urlshort.MappingError{
+				{File: "paths.csv", Index: 1, Line: 4, Column: 1, Err: urlshort.ErrRepeatedPath},
+				{File: "paths.csv", Index: 2, Line: 5, Column: 1, Err: urlshort.ErrMissingURL},
+			},
+		},
+		"invalid status": {
+			file: urlshort.MappingFile{Name: "paths.yml", Format: urlshort.FormatYAML, Data: []byte(`
+- path: /urlshort
+  url: https://github.com/gophercises/urlshort
+  status: 302
+- path: /other
+  url: https://www.example.com
+  status: 200
+`)},
+			expected: []urlshort.MappingError{
+				{File: "paths.yml", Index: 1, Line: 5, Column: 3, Err: urlshort.ErrInvalidStatus},
+			},
+		},
+		"invalid query policy": {
+			file: urlshort.MappingFile{Name: "paths.yml", Format: urlshort.FormatYAML, Data: []byte(`
+- path: /urlshort
+  url: https://github.com/gophercises/urlshort
+  query: merge
+`)},
+			expected: []urlshort.MappingError{
+				{File: "paths.yml", Index: 0, Line: 2, Column: 3, Err: urlshort.ErrInvalidQueryPolicy},
+			},
+		},
+		"problems in toml": {
+			file: urlshort.MappingFile{Name: "paths.toml", Format: urlshort.FormatTOML, Data: []byte(`
+[[mappings]]
+path = "/urlshort"
+`)},
+			expected: []urlshort.MappingError{
+				{File: "paths.toml", Index: 0, Err: urlshort.ErrMissingURL},
+			},
+		},
+		"problems in json": {
+			file: urlshort.MappingFile{Name: "paths.json", Format: urlshort.FormatJSON, Data: []byte(`[
+	{"path": "/urlshort", "url": "https://github.com/gophercises/urlshort"},
+	{"path": "", "url": "mailto:someone@example.com"}
+]`)},
+			expected: []urlshort.MappingError{
+				{File: "paths.json", Index: 1, Err: urlshort.ErrMissingPath},
+				{File: "paths.json", Index: 1, Err: urlshort.ErrUnsupportedScheme},
+			},
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			_, err := urlshort.FilesHandler([]urlshort.MappingFile{tc.file}, http.HandlerFunc(statusBadRequestHandlerMock))
+			if len(tc.expected) == 0 {
+				if err != nil {
+					t.Fatalf("error was not expected but got: %s", err.Error())
+				}
+				return
+			}
+
+			var errs urlshort.MappingErrors
+			if !errors.As(err, &errs) {
+				t.Fatalf("expected MappingErrors but got: %v", err)
+			}
+			if len(errs) != len(tc.expected) {
+				t.Fatalf("expected %d problems but got %d: %v", len(tc.expected), len(errs), err)
+			}
+			for i, want := range tc.expected {
+				got := errs[i]
+				if got.File != want.File || got.Index != want.Index || got.Line != want.Line || got.Column != want.Column || !errors.Is(got, want.Err) {
+					t.Errorf("problem %d: got %+v want %+v", i, *got, want)
+				}
+			}
+			if !errors.Is(err, tc.expected[0].Err) {
+				t.Errorf("expected errors.Is to find %v in %v", tc.expected[0].Err, err)
+			}
+		})
+	}
+}
+
+func TestMappingError(t *testing.T) {
+	tests := map[string]struct {
+		err      error
+		expected string
+	}{
+		"yaml entry": {
+			err:      &urlshort.MappingError{File: "paths.yml", Index: 2, Line: 5, Column: 3, Err: urlshort.ErrUnsupportedScheme, Detail: `"ftp", expected http or https`},
+			expected: `paths.yml[2] (line 5, column 3): unsupported url scheme: "ftp", expected http or https`,
+		},
+		"json entry without detail": {
+			err:      &urlshort.MappingError{File: "paths.json", Index: 0, Err: urlshort.ErrMissingURL},
+			expected: "paths.json[0]: missing url",
+		},
+		"several problems": {
+			err: urlshort.MappingErrors{
+				{Index: 0, Err: urlshort.ErrMissingPath},
+				{Index: 1, Err: urlshort.ErrMissingURL},
+			},
+			expected: "[0]: missing path\n[1]: missing url",
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			if got := tc.err.Error(); got != tc.expected {
+				t.Errorf("got %q want %q", got, tc.expected)
+			}
+		})
+	}
+}